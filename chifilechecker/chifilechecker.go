@@ -0,0 +1,24 @@
+// Package chifilechecker adapts filechecker to chi, whose middlewares are
+// plain net/http ones: a middleware checking multipart uploads, to mount with
+// Use or With.
+package chifilechecker
+
+import (
+	"net/http"
+
+	"github.com/nadimattari/filechecker"
+)
+
+// Middleware checks the files of multipart requests before the next
+// handler, e.g. r.With(chifilechecker.Middleware(options)).Post(...).
+// Rejected uploads are answered with a problem+json error; authorised ones go
+// on with the report in the context (see Report).
+func Middleware(options filechecker.MiddlewareOptions) func(http.Handler) http.Handler {
+	return filechecker.Middleware(options)
+}
+
+// Report returns the report of the files of the request, as stored by the
+// middleware.
+func Report(r *http.Request) (*filechecker.FormReport, bool) {
+	return filechecker.ReportFromContext(r.Context())
+}
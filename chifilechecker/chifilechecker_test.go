@@ -0,0 +1,62 @@
+package chifilechecker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/internal/fctest"
+)
+
+func TestMiddleware(t *testing.T) {
+	var (
+		router = chi.NewRouter()
+		png    = fctest.File{Field: "avatar", Filename: "me.png", Data: fctest.PNG(t)}
+		gif    = fctest.File{Field: "avatar", Filename: "me.gif", Data: fctest.GIF(t)}
+		ok     = func(w http.ResponseWriter, r *http.Request) {
+			if report, found := Report(r); !found || !report.Authorised {
+				t.Errorf("Report() = %+v, %v", report, found)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	)
+
+	router.With(Middleware(filechecker.MiddlewareOptions{})).Post("/avatar", ok)
+	router.With(Middleware(filechecker.MiddlewareOptions{
+		Policy: filechecker.Policy{SetExtensions: []string{filechecker.ExtImgGIF}},
+	})).Post("/animation", ok)
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		status  int
+		reason  filechecker.Reason
+	}{
+		{name: "authorised", request: fctest.Request(t, "/avatar", png), status: http.StatusNoContent},
+		{name: "rejected", request: fctest.Request(t, "/avatar", gif), status: http.StatusUnprocessableEntity, reason: filechecker.ReasonExtensionNotAuthorised},
+		{name: "per-route-policy", request: fctest.Request(t, "/animation", gif), status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, tt.request)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.reason == "" {
+				return
+			}
+
+			var problem filechecker.Problem
+			if err := json.NewDecoder(w.Body).Decode(&problem); err != nil || problem.Reason != tt.reason {
+				t.Errorf("problem = %+v, %v, want %s", problem, err, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/nadimattari/filechecker/chifilechecker
+
+go 1.19
+
+require (
+	github.com/go-chi/chi/v5 v5.1.0
+	github.com/nadimattari/filechecker v1.0.0
+)
+
+require github.com/h2non/filetype v1.1.3 // indirect
@@ -0,0 +1,242 @@
+// Package clamav scans files with ClamAV, streaming them to clamd with the
+// INSTREAM command over a Unix or TCP socket. Clients are scanners of
+// filechecker policies (see filechecker.Policy.Scanners).
+package clamav
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/nadimattari/filechecker"
+)
+
+const (
+	// name of the scanner in verdicts
+	scannerName = "clamav"
+
+	// defaults, StreamMaxLength being 25 MiB by default in clamd.conf
+	defaultTimeout   = 30 * time.Second
+	defaultMaxSize   = 25 << 20
+	defaultChunkSize = 32 << 10
+)
+
+var (
+	// ErrTooLarge is returned when files are larger than the client or
+	// clamd streams.
+	ErrTooLarge = errors.New("clamav: file too large to be scanned")
+
+	// ErrUnexpectedReply is returned when clamd replies something else than
+	// the protocol says.
+	ErrUnexpectedReply = errors.New("clamav: unexpected reply")
+)
+
+// Client is a clamd client.
+type Client struct {
+	// "unix" or "tcp", and the address of clamd (e.g.
+	// "/run/clamav/clamd.ctl", "127.0.0.1:3310")
+	Network string
+	Address string
+
+	// maximum duration of a scan, connecting included (30 seconds by
+	// default)
+	Timeout time.Duration
+
+	// maximum size of the files streamed, larger ones are not scanned (25
+	// MiB by default, as StreamMaxLength of clamd)
+	MaxSize int64
+
+	// bytes sent per chunk (32 KiB by default)
+	ChunkSize int
+}
+
+// New returns a client of clamd, at the address on the network ("unix" or
+// "tcp").
+func New(network, address string) *Client {
+	return &Client{Network: network, Address: address}
+}
+
+// Name implements filechecker.Scanner.
+func (c *Client) Name() string {
+	return scannerName
+}
+
+// Scan implements filechecker.Scanner, streaming the file to clamd. Viruses
+// are detected, named after their signature; files larger than MaxSize (or
+// than clamd streams) fail with ErrTooLarge.
+func (c *Client) Scan(ctx context.Context, r io.ReaderAt, size int64) (*filechecker.ScanResult, error) {
+	var (
+		err       error
+		conn      net.Conn
+		reply     string
+		maxSize   = c.MaxSize
+		chunkSize = c.ChunkSize
+	)
+
+	if maxSize == 0 {
+		maxSize = defaultMaxSize
+	}
+	if chunkSize == 0 {
+		chunkSize = defaultChunkSize
+	}
+	if size > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	if conn, err = c.dial(ctx); err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	// clamd may reply (e.g. size limit exceeded) and close the connection
+	// before the whole file is sent
+	if err = instream(conn, io.NewSectionReader(r, 0, size), chunkSize); err != nil {
+		if reply, rerr := readReply(conn); rerr == nil {
+			return parseReply(reply)
+		}
+		return nil, fmt.Errorf("clamav: %w", err)
+	}
+	if reply, err = readReply(conn); err != nil {
+		return nil, err
+	}
+
+	return parseReply(reply)
+}
+
+// Ping tells whether clamd is reachable, and answers.
+func (c *Client) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err = io.WriteString(conn, "zPING\x00"); err != nil {
+		return err
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("%w: %q", ErrUnexpectedReply, reply)
+	}
+	return nil
+}
+
+// dial connects to clamd, the connection being closed at the earliest of
+// the timeout and the end of the context.
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	var (
+		dialer  net.Dialer
+		timeout = c.Timeout
+	)
+
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("clamav: %w", err)
+	}
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	// ends pending reads and writes once the context is done
+	go func() {
+		<-ctx.Done()
+		_ = conn.SetDeadline(time.Now())
+	}()
+
+	return &contextConn{Conn: conn, cancel: cancel}, nil
+}
+
+// contextConn is a connection ending its context once closed.
+type contextConn struct {
+	net.Conn
+	cancel context.CancelFunc
+}
+
+func (c *contextConn) Close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
+
+// instream sends the INSTREAM command, then the content in chunks (each
+// prefixed with its size, as a 4-byte big-endian integer), then a chunk of
+// size zero.
+func instream(w io.Writer, r io.Reader, chunkSize int) error {
+	var (
+		bw     = bufio.NewWriterSize(w, chunkSize+4)
+		chunk  = make([]byte, chunkSize)
+		length [4]byte
+	)
+
+	if _, err := bw.WriteString("zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(length[:], uint32(n))
+			_, _ = bw.Write(length[:])
+			if _, werr := bw.Write(chunk[:n]); werr != nil {
+				return werr
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	binary.BigEndian.PutUint32(length[:], 0)
+	_, _ = bw.Write(length[:])
+	return bw.Flush()
+}
+
+// readReply reads a reply of clamd, terminated by a null byte (z-prefixed
+// commands).
+func readReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(r).ReadString(0)
+	if err != nil {
+		return "", fmt.Errorf("clamav: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimSuffix(reply, "\x00")), nil
+}
+
+// parseReply maps a reply to INSTREAM to a result, e.g.
+//
+//	stream: OK
+//	stream: Win.Test.EICAR_HDB-1 FOUND
+//	INSTREAM size limit exceeded. ERROR
+func parseReply(reply string) (*filechecker.ScanResult, error) {
+	switch {
+	case reply == "stream: OK":
+		return &filechecker.ScanResult{}, nil
+	case strings.HasPrefix(reply, "stream: ") && strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return &filechecker.ScanResult{Detected: true, Signature: signature}, nil
+	case strings.HasPrefix(reply, "INSTREAM size limit exceeded"):
+		return nil, ErrTooLarge
+	case strings.HasSuffix(reply, " ERROR"):
+		return nil, fmt.Errorf("clamav: %s", strings.TrimSuffix(reply, " ERROR"))
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnexpectedReply, reply)
+	}
+}
@@ -0,0 +1,216 @@
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/internal/fctest"
+)
+
+const (
+	// content fakeClamd detects, and replies slowly to
+	testVirus = "X5O!P%@AP[4\\PZX54(P^)7CC)7}$TEST"
+	testSlow  = "SLOW"
+
+	// bytes fakeClamd streams at most
+	testStreamMaxLength = 1 << 16
+)
+
+// fakeClamd speaks the clamd protocol (PING, INSTREAM) on the network.
+func fakeClamd(t *testing.T, network string) string {
+	address := "127.0.0.1:0"
+	if network == "unix" {
+		address = filepath.Join(t.TempDir(), "clamd.sock")
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// serveClamd serves a command.
+func serveClamd(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+
+	switch command {
+	case "zPING\x00":
+		_, _ = io.WriteString(conn, "PONG\x00")
+	case "zINSTREAM\x00":
+		var content bytes.Buffer
+		for {
+			var length uint32
+			if err = binary.Read(r, binary.BigEndian, &length); err != nil {
+				return
+			}
+			if length == 0 {
+				break
+			}
+			if content.Len()+int(length) > testStreamMaxLength {
+				_, _ = io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+				return
+			}
+			if _, err = io.CopyN(&content, r, int64(length)); err != nil {
+				return
+			}
+		}
+
+		switch {
+		case strings.Contains(content.String(), testVirus):
+			_, _ = io.WriteString(conn, "stream: Win.Test.EICAR_HDB-1 FOUND\x00")
+		case strings.Contains(content.String(), testSlow):
+			time.Sleep(time.Second)
+			_, _ = io.WriteString(conn, "stream: OK\x00")
+		default:
+			_, _ = io.WriteString(conn, "stream: OK\x00")
+		}
+	default:
+		_, _ = io.WriteString(conn, "UNKNOWN COMMAND\x00")
+	}
+}
+
+func TestClient_Scan(t *testing.T) {
+	png := fctest.PNG(t)
+
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			client := New(network, fakeClamd(t, network))
+			client.ChunkSize = 16
+
+			tests := []struct {
+				name      string
+				client    *Client
+				data      []byte
+				detected  bool
+				signature string
+				err       error
+			}{
+				{name: "clean", client: client, data: png},
+				{name: "empty", client: client, data: []byte{}},
+				{name: "virus", client: client, data: append(append([]byte{}, png...), testVirus...), detected: true, signature: "Win.Test.EICAR_HDB-1"},
+				{name: "too-large-for-clamd", client: client, data: make([]byte, testStreamMaxLength+1), err: ErrTooLarge},
+				{name: "too-large", client: &Client{Network: network, Address: client.Address, MaxSize: 8}, data: png, err: ErrTooLarge},
+				{name: "timeout", client: &Client{Network: network, Address: client.Address, Timeout: 50 * time.Millisecond}, data: []byte(testSlow), err: errTimeout},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					result, err := tt.client.Scan(context.Background(), bytes.NewReader(tt.data), int64(len(tt.data)))
+
+					switch {
+					case tt.err == errTimeout:
+						var netErr net.Error
+						if !errors.As(err, &netErr) || !netErr.Timeout() {
+							t.Errorf("Scan() = %v, want timeout", err)
+						}
+					case tt.err != nil:
+						if !errors.Is(err, tt.err) {
+							t.Errorf("Scan() = %v, want %v", err, tt.err)
+						}
+					case err != nil:
+						t.Errorf("Scan() = %v, want nil", err)
+					case result.Detected != tt.detected || result.Signature != tt.signature:
+						t.Errorf("Scan() = %+v, want detected %v (%s)", result, tt.detected, tt.signature)
+					}
+				})
+			}
+		})
+	}
+}
+
+// errTimeout stands for timeouts in tests.
+var errTimeout = errors.New("timeout")
+
+func TestClient_Scan_Unreachable(t *testing.T) {
+	client := New("unix", filepath.Join(t.TempDir(), "missing.sock"))
+
+	if _, err := client.Scan(context.Background(), bytes.NewReader(nil), 0); err == nil {
+		t.Error("Scan() = nil, want error")
+	}
+}
+
+func TestClient_Ping(t *testing.T) {
+	if err := New("tcp", fakeClamd(t, "tcp")).Ping(context.Background()); err != nil {
+		t.Errorf("Ping() = %v, want nil", err)
+	}
+}
+
+func TestClient_Policy(t *testing.T) {
+	var (
+		client = New("tcp", fakeClamd(t, "tcp"))
+		png    = fctest.PNG(t)
+	)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		reason filechecker.Reason
+	}{
+		{name: "clean", data: png},
+		{name: "virus", data: append(append([]byte{}, png...), testVirus...), reason: filechecker.ReasonMalware},
+		{name: "too-large", data: append(append([]byte{}, png...), make([]byte, testStreamMaxLength)...), reason: filechecker.ReasonScanFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := filechecker.GetFileChecker(fctest.FileHeader(t, "me.png", tt.data))
+			fc.SetPolicy(filechecker.Policy{Scanners: []filechecker.Scanner{client}})
+
+			verdict := fc.Check()
+			if verdict.Reason != tt.reason || len(verdict.Scans) != 1 || verdict.Scans[0].Scanner != "clamav" {
+				t.Errorf("Check() = %+v (%v), want %q", verdict, verdict.Scans, tt.reason)
+			}
+		})
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply    string
+		detected bool
+		err      bool
+	}{
+		{reply: "stream: OK"},
+		{reply: "stream: Eicar-Signature FOUND", detected: true},
+		{reply: "INSTREAM size limit exceeded. ERROR", err: true},
+		{reply: "Can't allocate memory ERROR", err: true},
+		{reply: "PONG", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reply, func(t *testing.T) {
+			result, err := parseReply(tt.reply)
+			if (err != nil) != tt.err || (err == nil && result.Detected != tt.detected) {
+				t.Errorf("parseReply() = %+v, %v", result, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/icap"
+)
+
+// names of the ICAP services, and of their policies
+const (
+	serviceREQMOD  = "reqmod"
+	serviceRESPMOD = "respmod"
+)
+
+// runICAP runs the icap command: an ICAP server checking the bodies of the
+// requests (icap://host/reqmod) and responses (icap://host/respmod) of a
+// proxy, until interrupted.
+func runICAP(args []string, stderr io.Writer) int {
+	var (
+		err      error
+		listener net.Listener
+		policies = map[string]filechecker.Policy{}
+		flags    = flag.NewFlagSet("filechecker icap", flag.ContinueOnError)
+
+		addr         = flags.String("addr", ":1344", "address to listen on")
+		policiesFile = flags.String("policies", "", "policies by name (JSON): "+serviceREQMOD+", "+serviceRESPMOD+", "+defaultPolicy+" for both otherwise")
+		maxBodySize  = flags.Int64("max-body-size", 32<<20, "maximum size of bodies, in bytes")
+		istag        = flags.String("istag", "", "ISTag of the services, to change when policies do")
+		inline       = flags.Bool("inline", false, "check inline responses (pages) too, not only downloads")
+		timeout      = flags.Duration("shutdown-timeout", 10*time.Second, "time given to requests in flight when shutting down")
+	)
+
+	flags.SetOutput(stderr)
+	if err = flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	if *policiesFile != "" {
+		if policies, err = readPolicies(*policiesFile); err != nil {
+			fmt.Fprintf(stderr, "filechecker: %v\n", err)
+			return exitError
+		}
+	}
+
+	server := &icap.Server{
+		Services: map[string]icap.Service{
+			serviceREQMOD:  {Method: icap.MethodREQMOD, Policy: servicePolicy(policies, serviceREQMOD)},
+			serviceRESPMOD: {Method: icap.MethodRESPMOD, Policy: servicePolicy(policies, serviceRESPMOD)},
+		},
+		ISTag:       *istag,
+		MaxBodySize: *maxBodySize,
+	}
+	if !*inline {
+		respmod := server.Services[serviceRESPMOD]
+		respmod.Skip = icap.Inline
+		server.Services[serviceRESPMOD] = respmod
+	}
+
+	if listener, err = net.Listen("tcp", *addr); err != nil {
+		fmt.Fprintf(stderr, "filechecker: %v\n", err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+	fmt.Fprintf(stderr, "filechecker: ICAP listening on %s\n", listener.Addr())
+
+	select {
+	case err = <-served:
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		if err = server.Shutdown(shutdownCtx); err == nil {
+			err = <-served
+		}
+	}
+
+	if err != nil && !errors.Is(err, icap.ErrServerClosed) {
+		fmt.Fprintf(stderr, "filechecker: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// servicePolicy returns the policy of the service, the default one if it
+// has none.
+func servicePolicy(policies map[string]filechecker.Policy, service string) filechecker.Policy {
+	if policy, found := policies[service]; found {
+		return policy
+	}
+	return policies[defaultPolicy]
+}
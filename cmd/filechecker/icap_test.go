@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nadimattari/filechecker"
+)
+
+func TestRunICAP(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		invalid = filepath.Join(dir, "invalid.json")
+	)
+
+	if err := os.WriteFile(invalid, []byte(`{"reqmod": [`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "flag", args: []string{"-unknown"}},
+		{name: "policies-missing", args: []string{"-policies", filepath.Join(dir, "missing.json")}},
+		{name: "policies-invalid", args: []string{"-policies", invalid}},
+		{name: "address", args: []string{"-addr", "256.0.0.1:1344"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			if got := run(append([]string{"icap"}, tt.args...), &stderr, &stderr); got != exitError {
+				t.Errorf("run() = %d, want %d", got, exitError)
+			}
+		})
+	}
+}
+
+func TestServicePolicy(t *testing.T) {
+	policies := map[string]filechecker.Policy{
+		defaultPolicy: {MaxFileSize: 1},
+		serviceREQMOD: {MaxFileSize: 2},
+	}
+
+	if got := servicePolicy(policies, serviceREQMOD).MaxFileSize; got != 2 {
+		t.Errorf("servicePolicy(%s) = %d, want 2", serviceREQMOD, got)
+	}
+	if got := servicePolicy(policies, serviceRESPMOD).MaxFileSize; got != 1 {
+		t.Errorf("servicePolicy(%s) = %d, want 1", serviceRESPMOD, got)
+	}
+}
@@ -0,0 +1,186 @@
+// Command filechecker checks files and directories against a policy, e.g.
+//
+//	filechecker -set gif -unset pdf -format jsonl uploads/ 'exports/*.png'
+//
+// It exits with 0 when all files are authorised, 1 when some are rejected,
+// and 2 on errors (invalid flags or policy, missing paths).
+//
+// The serve command runs an HTTP service checking the files posted to it:
+//
+//	filechecker serve -addr :8080 -policies policies.json
+//
+// The icap command runs an ICAP server checking the bodies of the requests
+// and responses of proxies:
+//
+//	filechecker icap -addr :1344 -policies policies.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/report"
+)
+
+const (
+	exitOK       = 0
+	exitRejected = 1
+	exitError    = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command with the given arguments, and returns its exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	var (
+		err     error
+		policy  filechecker.Policy
+		paths   []string
+		results []report.Result
+		failed  bool
+		flags   = flag.NewFlagSet("filechecker", flag.ContinueOnError)
+
+		policyFile = flags.String("policy", "", "policy file (JSON)")
+		set        = flags.String("set", "", "comma-separated extensions to authorise")
+		unset      = flags.String("unset", "", "comma-separated extensions to unauthorise")
+		format     = flags.String("format", formatTable, "output format: "+strings.Join(formatNames(), ", "))
+		workers    = flags.Int("workers", runtime.NumCPU(), "number of files checked at once")
+		hashes     = flags.Bool("hashes", false, "compute the SHA-256, SHA-1 and MD5 digests of files")
+		denyList   = flags.String("deny-list", "", "file of digests of files to reject")
+		allowList  = flags.String("allow-list", "", "file of digests of files not to inspect further")
+	)
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "serve":
+			return runServe(args[1:], stderr)
+		case "icap":
+			return runICAP(args[1:], stderr)
+		}
+	}
+
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: filechecker [flags] path|glob|directory...")
+		fmt.Fprintln(stderr, "       filechecker serve [flags]")
+		fmt.Fprintln(stderr, "       filechecker icap [flags]")
+		flags.PrintDefaults()
+	}
+
+	if err = flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitError
+	}
+
+	newFormatter, found := formats[*format]
+	if !found {
+		fmt.Fprintf(stderr, "filechecker: unknown format %q\n", *format)
+		return exitError
+	}
+
+	if *policyFile != "" {
+		if policy, err = readPolicy(*policyFile); err != nil {
+			fmt.Fprintf(stderr, "filechecker: %v\n", err)
+			return exitError
+		}
+	}
+	policy.SetExtensions = append(policy.SetExtensions, splitList(*set)...)
+	policy.UnsetExtensions = append(policy.UnsetExtensions, splitList(*unset)...)
+	policy.Hashes = policy.Hashes || *hashes
+
+	if *denyList != "" {
+		if policy.DenyList, err = filechecker.LoadHashList(*denyList); err != nil {
+			fmt.Fprintf(stderr, "filechecker: %v\n", err)
+			return exitError
+		}
+	}
+	if *allowList != "" {
+		if policy.AllowList, err = filechecker.LoadHashList(*allowList); err != nil {
+			fmt.Fprintf(stderr, "filechecker: %v\n", err)
+			return exitError
+		}
+	}
+
+	// paths are resolved first, so that missing ones are reported, but the
+	// others still checked
+	for _, arg := range flags.Args() {
+		matched, errs := expand(arg)
+		for _, err := range errs {
+			fmt.Fprintf(stderr, "filechecker: %v\n", err)
+			failed = true
+		}
+		paths = append(paths, matched...)
+	}
+
+	results = scan(paths, policy, *workers)
+
+	formatter := newFormatter(stdout)
+	for _, r := range results {
+		if err = formatter.Write(r); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = formatter.Close()
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "filechecker: %v\n", err)
+		return exitError
+	}
+
+	switch {
+	case failed:
+		return exitError
+	case rejected(results):
+		return exitRejected
+	default:
+		return exitOK
+	}
+}
+
+// readPolicy reads a policy from a JSON file.
+func readPolicy(name string) (filechecker.Policy, error) {
+	var policy filechecker.Policy
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return policy, err
+	}
+	if err = json.Unmarshal(data, &policy); err != nil {
+		return policy, fmt.Errorf("invalid policy %s: %w", name, err)
+	}
+	return policy, nil
+}
+
+// splitList splits a comma-separated list, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// rejected tells whether any of the files was rejected.
+func rejected(results []report.Result) bool {
+	for _, r := range results {
+		if !r.Verdict.Authorised {
+			return true
+		}
+	}
+	return false
+}
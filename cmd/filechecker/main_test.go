@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testTree copies the assets in a temporary directory, with a sub-directory:
+//
+//	nadim.jpg
+//	nadim.png
+//	docs/nadim.pdf
+//	docs/fake.png
+func testTree(t *testing.T) string {
+	dir := t.TempDir()
+
+	for name, asset := range map[string]string{
+		"nadim.jpg":      "nadim.jpg",
+		"nadim.png":      "nadim.png",
+		"docs/nadim.pdf": "nadim.pdf",
+		"docs/fake.png":  "fake.png",
+	} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "assets", asset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	var (
+		dir    = testTree(t)
+		policy = filepath.Join(dir, "policy.json")
+	)
+
+	if err := os.WriteFile(policy, []byte(`{"unset_extensions": ["pdf"], "max_file_size": 2048}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// lists of digests, out of the tree
+	jpg, err := os.ReadFile(filepath.Join(dir, "nadim.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		lists    = t.TempDir()
+		denyList = filepath.Join(lists, "deny.txt")
+		badList  = filepath.Join(lists, "bad.txt")
+	)
+	if err = os.WriteFile(denyList, []byte(fmt.Sprintf("# known bad\n%x  nadim.jpg\n", sha256.Sum256(jpg))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(badList, []byte("not-a-hash\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// symbolic links, out of the tree: followed when given as arguments,
+	// skipped within directories
+	links := t.TempDir()
+	if err = os.Symlink(filepath.Join(dir, "nadim.jpg"), filepath.Join(links, "photo.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(filepath.Join(dir, "docs"), filepath.Join(links, "docs")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(links, "nadim.jpg"), jpg, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	linked := func(name string) string {
+		rel, _ := filepath.Rel(dir, filepath.Join(links, name))
+		return filepath.ToSlash(rel)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     int
+		rejected []string
+	}{
+		{name: "file", args: []string{filepath.Join(dir, "nadim.jpg")}, want: exitOK},
+		{name: "directory", args: []string{dir}, want: exitRejected, rejected: []string{"docs/fake.png", "policy.json"}},
+		{name: "glob", args: []string{filepath.Join(dir, "*.png")}, want: exitOK},
+		{name: "unset", args: []string{"-unset", "jpg, png", filepath.Join(dir, "nadim.jpg"), filepath.Join(dir, "nadim.png")}, want: exitRejected, rejected: []string{"nadim.jpg", "nadim.png"}},
+		{name: "policy", args: []string{"-policy", policy, "-workers", "1", filepath.Join(dir, "docs")}, want: exitRejected, rejected: []string{"docs/fake.png", "docs/nadim.pdf"}},
+		{name: "missing", args: []string{filepath.Join(dir, "missing.png"), filepath.Join(dir, "nadim.jpg")}, want: exitError},
+		{name: "symlink", args: []string{filepath.Join(links, "photo.jpg")}, want: exitOK},
+		{name: "symlink-directory", args: []string{"-unset", "pdf", filepath.Join(links, "docs")}, want: exitRejected, rejected: []string{linked("docs/fake.png"), linked("docs/nadim.pdf")}},
+		{name: "symlinks-skipped", args: []string{links}, want: exitError},
+		{name: "no-match", args: []string{filepath.Join(dir, "*.gif")}, want: exitError},
+		{name: "no-path", args: nil, want: exitError},
+		{name: "format", args: []string{"-format", "xml", dir}, want: exitError},
+		{name: "deny-list", args: []string{"-deny-list", denyList, filepath.Join(dir, "nadim.jpg"), filepath.Join(dir, "nadim.png")}, want: exitRejected, rejected: []string{"nadim.jpg"}},
+		{name: "deny-list-invalid", args: []string{"-deny-list", badList, dir}, want: exitError},
+		{name: "policy-missing", args: []string{"-policy", filepath.Join(dir, "missing.json"), dir}, want: exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			args := append([]string{"-format", formatJSONL}, tt.args...)
+			if got := run(args, &stdout, &stderr); got != tt.want {
+				t.Fatalf("run() = %d, want %d (stderr: %s)", got, tt.want, stderr.String())
+			}
+
+			var rejected []string
+			for scanner := bufio.NewScanner(&stdout); scanner.Scan(); {
+				var line struct {
+					Path       string `json:"path"`
+					Authorised bool   `json:"authorised"`
+				}
+				if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+					t.Fatal(err)
+				}
+				if !line.Authorised {
+					rel, _ := filepath.Rel(dir, line.Path)
+					rejected = append(rejected, filepath.ToSlash(rel))
+				}
+			}
+			if strings.Join(rejected, ",") != strings.Join(tt.rejected, ",") {
+				t.Errorf("rejected = %v, want %v", rejected, tt.rejected)
+			}
+		})
+	}
+}
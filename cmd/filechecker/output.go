@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/report"
+)
+
+// output formats
+const (
+	formatTable = "table"
+	formatJSONL = "jsonl"
+	formatCSV   = "csv"
+	formatSARIF = "sarif"
+	formatJUnit = "junit"
+)
+
+// formatter writes the results in a format.
+type formatter interface {
+	Write(r report.Result) error
+
+	// Close flushes what is left to write.
+	Close() error
+}
+
+// formats are the output formats, by name.
+var formats = map[string]func(w io.Writer) formatter{
+	formatTable: newTableFormatter,
+	formatJSONL: newJSONLFormatter,
+	formatCSV:   newCSVFormatter,
+	formatSARIF: func(w io.Writer) formatter { return &batchFormatter{w: w, write: report.WriteSARIF} },
+	formatJUnit: func(w io.Writer) formatter { return &batchFormatter{w: w, write: report.WriteJUnit} },
+}
+
+// csvHeader is the header of CSV output.
+var csvHeader = []string{"path", "authorised", "reason", "type", "extension", "mime", "size", "error"}
+
+// formatNames returns the names of the output formats, sorted.
+func formatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// status tells whether the file was authorised, for humans.
+func status(v *filechecker.Verdict) string {
+	if v.Authorised {
+		return "ok"
+	}
+	return "rejected"
+}
+
+// errorOf returns the message of the underlying error of the verdict, if
+// any.
+func errorOf(v *filechecker.Verdict) string {
+	if v.Err == nil {
+		return ""
+	}
+	return v.Err.Error()
+}
+
+// tableFormatter writes aligned columns.
+type tableFormatter struct {
+	w *tabwriter.Writer
+}
+
+func newTableFormatter(w io.Writer) formatter {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "PATH\tSTATUS\tREASON\tEXTENSION\tSIZE")
+	return &tableFormatter{w: tw}
+}
+
+func (f *tableFormatter) Write(r report.Result) error {
+	var (
+		v      = r.Verdict
+		reason = string(v.Reason)
+	)
+
+	if v.Err != nil {
+		reason += ": " + v.Err.Error()
+	}
+
+	_, err := fmt.Fprintf(f.w, "%s\t%s\t%s\t%s\t%d\n", r.Path, status(v), reason, v.Extension, v.Size)
+	return err
+}
+
+func (f *tableFormatter) Close() error {
+	return f.w.Flush()
+}
+
+// jsonlFormatter writes a JSON object per line: the verdict, its path and
+// error.
+type jsonlFormatter struct {
+	encoder *json.Encoder
+}
+
+func newJSONLFormatter(w io.Writer) formatter {
+	return &jsonlFormatter{encoder: json.NewEncoder(w)}
+}
+
+func (f *jsonlFormatter) Write(r report.Result) error {
+	return f.encoder.Encode(struct {
+		Path string `json:"path"`
+		*filechecker.Verdict
+		Error string `json:"error,omitempty"`
+	}{r.Path, r.Verdict, errorOf(r.Verdict)})
+}
+
+func (f *jsonlFormatter) Close() error {
+	return nil
+}
+
+// csvFormatter writes CSV records, after a header.
+type csvFormatter struct {
+	w *csv.Writer
+}
+
+func newCSVFormatter(w io.Writer) formatter {
+	cw := csv.NewWriter(w)
+	_ = cw.Write(csvHeader)
+	return &csvFormatter{w: cw}
+}
+
+func (f *csvFormatter) Write(r report.Result) error {
+	v := r.Verdict
+	return f.w.Write([]string{
+		r.Path, strconv.FormatBool(v.Authorised), string(v.Reason), v.Type, v.Extension, v.MIME,
+		strconv.FormatInt(v.Size, 10), errorOf(v),
+	})
+}
+
+func (f *csvFormatter) Close() error {
+	f.w.Flush()
+	return f.w.Error()
+}
+
+// batchFormatter writes all the results at once, as reports do (see
+// report.WriteSARIF, report.WriteJUnit).
+type batchFormatter struct {
+	w       io.Writer
+	write   func(w io.Writer, results []report.Result) error
+	results []report.Result
+}
+
+func (f *batchFormatter) Write(r report.Result) error {
+	f.results = append(f.results, r)
+	return nil
+}
+
+func (f *batchFormatter) Close() error {
+	return f.write(f.w, f.results)
+}
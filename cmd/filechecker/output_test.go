@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/report"
+)
+
+func TestFormats(t *testing.T) {
+	results := []report.Result{
+		{Path: "a/me.png", Verdict: &filechecker.Verdict{Authorised: true, Filename: "me.png", Size: 10, Type: filechecker.TypeIMAGE, Extension: "png", MIME: "image/png"}},
+		{Path: "a/me.gif", Verdict: &filechecker.Verdict{Reason: filechecker.ReasonUnreadable, Filename: "me.gif", Err: errors.New("denied")}},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: formatTable,
+			want: "PATH      STATUS    REASON              EXTENSION  SIZE\n" +
+				"a/me.png  ok                            png        10\n" +
+				"a/me.gif  rejected  unreadable: denied             0\n",
+		},
+		{
+			format: formatJSONL,
+			want: `{"path":"a/me.png","authorised":true,"filename":"me.png","size":10,"type":"Image","extension":"png","mime":"image/png"}` + "\n" +
+				`{"path":"a/me.gif","authorised":false,"reason":"unreadable","filename":"me.gif","size":0,"error":"denied"}` + "\n",
+		},
+		{
+			format: formatCSV,
+			want: "path,authorised,reason,type,extension,mime,size,error\n" +
+				"a/me.png,true,,Image,png,image/png,10,\n" +
+				"a/me.gif,false,unreadable,,,,0,denied\n",
+		},
+		{
+			format: formatJUnit,
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="filechecker" tests="2" failures="0" errors="1">
+  <testsuite name="filechecker" tests="2" failures="0" errors="1">
+    <testcase name="a/me.png" classname="filechecker"></testcase>
+    <testcase name="a/me.gif" classname="filechecker">
+      <error message="The file could not be read." type="unreadable">a/me.gif: The file could not be read. denied</error>
+    </testcase>
+  </testsuite>
+</testsuites>
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			f := formats[tt.format](&buf)
+			for _, r := range results {
+				if err := f.Write(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
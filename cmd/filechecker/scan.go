@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/report"
+)
+
+// expand returns the files of the argument: the file itself, the files of
+// the directory (recursively), or the files matching the glob. Symbolic
+// links given as arguments are followed, those within directories are not.
+// Paths that are not checked (e.g. missing, links, devices) are reported as
+// errors.
+func expand(arg string) ([]string, []error) {
+	var (
+		err     error
+		errs    []error
+		matches = []string{arg}
+		paths   []string
+	)
+
+	if strings.ContainsAny(arg, "*?[") {
+		if matches, err = filepath.Glob(arg); err != nil {
+			return nil, []error{fmt.Errorf("invalid pattern %q: %w", arg, err)}
+		}
+		if len(matches) == 0 {
+			return nil, []error{fmt.Errorf("no match for %q", arg)}
+		}
+	}
+
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case info.Mode().IsRegular():
+			paths = append(paths, match)
+		case info.IsDir():
+			dir, dirErrs := walk(match)
+			paths, errs = append(paths, dir...), append(errs, dirErrs...)
+		default:
+			errs = append(errs, fmt.Errorf("%s: skipped, not a regular file", match))
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, errs
+}
+
+// walk returns the regular files of the directory, recursively, and the
+// errors of the paths that are not.
+func walk(dir string) ([]string, []error) {
+	var (
+		paths []string
+		errs  []error
+	)
+
+	// the directory may be a symbolic link, not followed by WalkDir: its
+	// target is walked, under the name of the link
+	target, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	_ = filepath.WalkDir(target, func(path string, entry fs.DirEntry, err error) error {
+		if rel, relErr := filepath.Rel(target, path); relErr == nil {
+			path = filepath.Join(dir, rel)
+		}
+
+		switch {
+		case err != nil:
+			// unreadable directories are skipped
+			errs = append(errs, err)
+		case entry.Type().IsRegular():
+			paths = append(paths, path)
+		case !entry.IsDir():
+			errs = append(errs, fmt.Errorf("%s: skipped, not a regular file", path))
+		}
+		return nil
+	})
+	return paths, errs
+}
+
+// scan checks the files with a pool of workers, and returns the results in
+// the order of the paths.
+func scan(paths []string, policy filechecker.Policy, workers int) []report.Result {
+	var (
+		results = make([]report.Result, len(paths))
+		jobs    = make(chan int)
+		wg      sync.WaitGroup
+	)
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				results[i] = report.Result{Path: paths[i], Verdict: check(paths[i], policy)}
+			}
+		}()
+	}
+
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// check checks a file against the policy, reading it from the disk as
+// needed.
+func check(path string, policy filechecker.Policy) *filechecker.Verdict {
+	var (
+		err  error
+		info os.FileInfo
+		file *os.File
+		name = filepath.Base(path)
+	)
+
+	if file, err = os.Open(path); err != nil {
+		return &filechecker.Verdict{Filename: name, Reason: filechecker.ReasonUnreadable, Err: err}
+	}
+	defer func() { _ = file.Close() }()
+
+	if info, err = file.Stat(); err != nil {
+		return &filechecker.Verdict{Filename: name, Reason: filechecker.ReasonUnreadable, Err: err}
+	}
+
+	fc := filechecker.GetFileCheckerAt(name, file, info.Size())
+	fc.SetPolicy(policy)
+	return fc.Check()
+}
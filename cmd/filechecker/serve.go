@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/nadimattari/filechecker"
+)
+
+const (
+	// name of the policy applied when requests do not name one
+	defaultPolicy = "default"
+
+	// bytes of multipart bodies kept in memory, the rest is stored on disk
+	maxMemory = 32 << 20
+
+	// reason for rejecting requests naming a policy that does not exist
+	reasonUnknownPolicy filechecker.Reason = "unknown_policy"
+)
+
+// server checks the files posted to it, against named policies.
+type server struct {
+	policies    map[string]filechecker.Policy
+	maxBodySize int64
+
+	// store of the rejected files, if any
+	quarantine filechecker.QuarantineStore
+
+	// whether the server accepts requests (1), 0 when shutting down
+	ready int32
+}
+
+// newServer returns a ready server.
+func newServer(policies map[string]filechecker.Policy, maxBodySize int64) *server {
+	s := &server{policies: policies, maxBodySize: maxBodySize}
+	atomic.StoreInt32(&s.ready, 1)
+	return s
+}
+
+// runServe runs the serve command: an HTTP service checking files, until
+// interrupted.
+func runServe(args []string, stderr io.Writer) int {
+	var (
+		err      error
+		listener net.Listener
+		policies = map[string]filechecker.Policy{}
+		flags    = flag.NewFlagSet("filechecker serve", flag.ContinueOnError)
+
+		addr         = flags.String("addr", ":8080", "address to listen on")
+		policiesFile = flags.String("policies", "", "policies by name (JSON), "+defaultPolicy+" applying when requests do not name one")
+		maxBodySize  = flags.Int64("max-body-size", 32<<20, "maximum size of request bodies, in bytes")
+		delay        = flags.Duration("shutdown-delay", 0, "time the server keeps serving once not ready, for load balancers to notice, when shutting down")
+		timeout      = flags.Duration("shutdown-timeout", 10*time.Second, "time given to requests in flight when shutting down")
+		quarantine   = flags.String("quarantine", "", "directory keeping the rejected files, with their verdict")
+		retention    = flags.Duration("quarantine-retention", 30*24*time.Hour, "time the rejected files are kept")
+	)
+
+	flags.SetOutput(stderr)
+	if err = flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	if *policiesFile != "" {
+		if policies, err = readPolicies(*policiesFile); err != nil {
+			fmt.Fprintf(stderr, "filechecker: %v\n", err)
+			return exitError
+		}
+	}
+
+	if listener, err = net.Listen("tcp", *addr); err != nil {
+		fmt.Fprintf(stderr, "filechecker: %v\n", err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := newServer(policies, *maxBodySize)
+	if *quarantine != "" {
+		store, err := filechecker.NewFSQuarantine(*quarantine)
+		if err != nil {
+			fmt.Fprintf(stderr, "filechecker: %v\n", err)
+			return exitError
+		}
+		s.quarantine = store
+		go filechecker.RunQuarantineCleanup(ctx, store, *retention, time.Hour)
+	}
+
+	fmt.Fprintf(stderr, "filechecker: listening on %s\n", listener.Addr())
+	if err = s.serve(ctx, listener, *delay, *timeout); err != nil {
+		fmt.Fprintf(stderr, "filechecker: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// readPolicies reads policies by name from a JSON file.
+func readPolicies(name string) (map[string]filechecker.Policy, error) {
+	var policies map[string]filechecker.Policy
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("invalid policies %s: %w", name, err)
+	}
+	return policies, nil
+}
+
+// serve serves requests on the listener until the context is done, then
+// shuts down gracefully: the server stops being ready but keeps serving for
+// the delay, then requests in flight are given the timeout to complete.
+func (s *server) serve(ctx context.Context, listener net.Listener, delay, timeout time.Duration) error {
+	var (
+		srv    = &http.Server{Handler: s.routes(), ReadHeaderTimeout: 10 * time.Second}
+		served = make(chan error, 1)
+	)
+
+	go func() { served <- srv.Serve(listener) }()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	atomic.StoreInt32(&s.ready, 0)
+
+	// load balancers are given the delay to stop sending requests
+	select {
+	case err := <-served:
+		return err
+	case <-time.After(delay):
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// routes returns the handler of the endpoints of the server.
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/check", s.post(s.handleCheck))
+	mux.HandleFunc("/check/batch", s.post(s.handleBatch))
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
+	return mux
+}
+
+// post restricts the handler to POST requests, with bodies of at most the
+// maximum size.
+func (s *server) post(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if s.maxBodySize > 0 {
+			r.Body = filechecker.MaxBodyReader(r.Body, s.maxBodySize)
+		}
+		handler(w, r)
+	}
+}
+
+// handleCheck checks a file, sent as the body of the request (named by the
+// filename parameter) or as the first file of a multipart form, and answers
+// its verdict.
+func (s *server) handleCheck(w http.ResponseWriter, r *http.Request) {
+	var (
+		err    error
+		data   []byte
+		files  []*multipart.FileHeader
+		file   *multipart.FileHeader
+		policy filechecker.Policy
+	)
+
+	if policy, err = s.policy(r); err != nil {
+		filechecker.WriteProblem(w, filechecker.NewProblem(http.StatusBadRequest, reasonUnknownPolicy, err.Error()))
+		return
+	}
+
+	if filechecker.IsMultipart(r) {
+		if files, err = s.parseForm(w, r); err != nil {
+			return
+		}
+		defer func() { _ = r.MultipartForm.RemoveAll() }()
+
+		if len(files) == 0 {
+			filechecker.WriteProblem(w, filechecker.NewProblem(http.StatusBadRequest, filechecker.ReasonNoFile, "the form has no file"))
+			return
+		}
+		file = files[0]
+	} else {
+		if data, err = io.ReadAll(r.Body); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		if file, err = filechecker.NewFileHeader(r.URL.Query().Get("filename"), data); err != nil {
+			filechecker.WriteProblem(w, filechecker.NewProblem(http.StatusInternalServerError, filechecker.ReasonUnreadable, err.Error()))
+			return
+		}
+	}
+
+	fc := filechecker.GetFileChecker(file)
+	fc.SetPolicy(policy)
+	writeJSON(w, http.StatusOK, fc.CheckContext(filechecker.WithQuarantineMetadata(r.Context(), filechecker.RequestMetadata(r))))
+}
+
+// handleBatch checks the files of a multipart form, and answers the report
+// of its fields.
+func (s *server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	policy, err := s.policy(r)
+	if err != nil {
+		filechecker.WriteProblem(w, filechecker.NewProblem(http.StatusBadRequest, reasonUnknownPolicy, err.Error()))
+		return
+	}
+
+	if !filechecker.IsMultipart(r) {
+		filechecker.WriteProblem(w, filechecker.NewProblem(http.StatusUnsupportedMediaType, filechecker.ReasonMalformedUpload, "batches are multipart/form-data"))
+		return
+	}
+	if _, err = s.parseForm(w, r); err != nil {
+		return
+	}
+	defer func() { _ = r.MultipartForm.RemoveAll() }()
+
+	options := filechecker.MiddlewareOptions{Policy: policy}
+	ctx := filechecker.WithQuarantineMetadata(r.Context(), filechecker.RequestMetadata(r))
+	writeJSON(w, http.StatusOK, filechecker.CheckFormContext(ctx, r.MultipartForm, options.Policies(r.MultipartForm)))
+}
+
+// handleHealth tells the server is alive.
+func (s *server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady tells whether the server accepts requests.
+func (s *server) handleReady(w http.ResponseWriter, _ *http.Request) {
+	if atomic.LoadInt32(&s.ready) == 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "shutting_down"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// policy returns the policy named by the request (policy parameter), the
+// default one otherwise, rejected files going to the quarantine of the
+// server.
+func (s *server) policy(r *http.Request) (filechecker.Policy, error) {
+	name := r.URL.Query().Get("policy")
+	if name == "" {
+		// no default policy configured, the default rules apply
+		name = defaultPolicy
+	}
+
+	policy, found := s.policies[name]
+	if !found && name != defaultPolicy {
+		return policy, fmt.Errorf("no policy named %q", name)
+	}
+
+	policy.Quarantine = s.quarantine
+	return policy, nil
+}
+
+// parseForm parses the multipart form of the request, and returns its
+// files, sorted by field. Errors are answered.
+func (s *server) parseForm(w http.ResponseWriter, r *http.Request) ([]*multipart.FileHeader, error) {
+	var (
+		files  []*multipart.FileHeader
+		fields []string
+	)
+
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		writeBodyError(w, err)
+		return nil, err
+	}
+
+	for field := range r.MultipartForm.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		files = append(files, r.MultipartForm.File[field]...)
+	}
+	return files, nil
+}
+
+// writeBodyError answers an error reading the body of the request.
+func writeBodyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, filechecker.ErrBodyTooLarge) {
+		filechecker.WriteProblem(w, filechecker.NewProblem(http.StatusRequestEntityTooLarge, filechecker.ReasonBodyTooLarge, err.Error()))
+		return
+	}
+	filechecker.WriteProblem(w, filechecker.NewProblem(http.StatusBadRequest, filechecker.ReasonMalformedUpload, err.Error()))
+}
+
+// writeJSON answers the value as JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
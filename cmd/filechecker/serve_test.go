@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/internal/fctest"
+)
+
+func TestServer(t *testing.T) {
+	var (
+		png    = fctest.File{Field: "file", Filename: "me.png", Data: fctest.PNG(t)}
+		gif    = fctest.File{Field: "file", Filename: "me.gif", Data: fctest.GIF(t)}
+		other  = fctest.File{Field: "other", Filename: "you.png", Data: fctest.PNG(t)}
+		server = newServer(map[string]filechecker.Policy{
+			"animations": {SetExtensions: []string{filechecker.ExtImgGIF}},
+		}, 1<<10)
+		handler = server.routes()
+	)
+
+	raw := func(target string, data []byte) *http.Request {
+		return httptest.NewRequest(http.MethodPost, target, bytes.NewReader(data))
+	}
+
+	tests := []struct {
+		name       string
+		request    *http.Request
+		status     int
+		authorised bool
+		reason     filechecker.Reason
+	}{
+		{name: "raw", request: raw("/check?filename=me.png", png.Data), status: http.StatusOK, authorised: true},
+		{name: "raw-rejected", request: raw("/check", gif.Data), status: http.StatusOK, reason: filechecker.ReasonExtensionNotAuthorised},
+		{name: "raw-policy", request: raw("/check?policy=animations", gif.Data), status: http.StatusOK, authorised: true},
+		{name: "raw-too-large", request: raw("/check", make([]byte, 2<<10)), status: http.StatusRequestEntityTooLarge, reason: filechecker.ReasonBodyTooLarge},
+		{name: "unknown-policy", request: raw("/check?policy=videos", png.Data), status: http.StatusBadRequest, reason: reasonUnknownPolicy},
+		{name: "multipart", request: fctest.Request(t, "/check", png, gif), status: http.StatusOK, authorised: true},
+		{name: "multipart-no-file", request: fctest.Request(t, "/check"), status: http.StatusBadRequest, reason: filechecker.ReasonNoFile},
+		{name: "method", request: httptest.NewRequest(http.MethodGet, "/check", nil), status: http.StatusMethodNotAllowed},
+		{name: "batch", request: fctest.Request(t, "/check/batch", png, other), status: http.StatusOK, authorised: true},
+		{name: "batch-rejected", request: fctest.Request(t, "/check/batch", png, gif), status: http.StatusOK, reason: filechecker.ReasonFileRejected},
+		{name: "batch-raw", request: raw("/check/batch", png.Data), status: http.StatusUnsupportedMediaType, reason: filechecker.ReasonMalformedUpload},
+		{name: "health", request: httptest.NewRequest(http.MethodGet, "/healthz", nil), status: http.StatusOK},
+		{name: "ready", request: httptest.NewRequest(http.MethodGet, "/readyz", nil), status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, tt.request)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status == http.StatusMethodNotAllowed || tt.request.Method == http.MethodGet {
+				return
+			}
+
+			// verdicts, reports and problems all tell why
+			var body struct {
+				Authorised bool                                `json:"authorised"`
+				Reason     filechecker.Reason                  `json:"reason"`
+				Fields     map[string]*filechecker.FieldReport `json:"fields"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			reason := body.Reason
+			for _, field := range body.Fields {
+				if field.Reason != filechecker.ReasonNone {
+					reason = field.Reason
+				}
+			}
+			if body.Authorised != tt.authorised || reason != tt.reason {
+				t.Errorf("body = %+v (%s), want authorised %v, %s", body, reason, tt.authorised, tt.reason)
+			}
+		})
+	}
+}
+
+func TestServer_Quarantine(t *testing.T) {
+	store, err := filechecker.NewFSQuarantine(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		w      = httptest.NewRecorder()
+		server = newServer(nil, 1<<20)
+		r      = httptest.NewRequest(http.MethodPost, "/check?filename=me.gif", bytes.NewReader(fctest.GIF(t)))
+	)
+
+	server.quarantine = store
+	server.routes().ServeHTTP(w, r)
+
+	var verdict filechecker.Verdict
+	if err = json.NewDecoder(w.Body).Decode(&verdict); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := store.Get(verdict.Quarantined)
+	if err != nil {
+		t.Fatalf("Get(%q) = %v", verdict.Quarantined, err)
+	}
+	if record.Filename != "me.gif" || record.Metadata["path"] != "/check" {
+		t.Errorf("record = %+v, want the file and request", record)
+	}
+}
+
+func TestServer_serve(t *testing.T) {
+	var (
+		server      = newServer(nil, 0)
+		ctx, cancel = context.WithCancel(context.Background())
+		served      = make(chan error, 1)
+	)
+	defer cancel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { served <- server.serve(ctx, listener, time.Second, time.Second) }()
+
+	response, err := http.Get("http://" + listener.Addr().String() + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", response.StatusCode, http.StatusOK)
+	}
+
+	// no longer ready, but still serving for the delay
+	cancel()
+	for deadline := time.Now().Add(time.Second); ; {
+		if response, err = http.Get("http://" + listener.Addr().String() + "/readyz"); err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+		if response.StatusCode == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %d, want %d", response.StatusCode, http.StatusServiceUnavailable)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// shuts down gracefully
+	select {
+	case err = <-served:
+		if err != nil {
+			t.Errorf("serve() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve() did not return")
+	}
+
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
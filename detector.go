@@ -0,0 +1,293 @@
+package filechecker
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+
+	"github.com/h2non/filetype"
+	"github.com/h2non/filetype/types"
+)
+
+// Peeker gives access to the first bytes of a file without consuming them
+// (e.g. *bufio.Reader). Peek returns fewer bytes than asked, with an error,
+// when the file is shorter.
+type Peeker interface {
+	Peek(n int) ([]byte, error)
+}
+
+// Candidate is a type a detector thinks the file is of.
+type Candidate struct {
+	// detected type (e.g. ExtImgPNG, "image/png")
+	Type types.Type
+
+	// category of the type (e.g. TypeIMAGE), "" if none
+	Category string
+
+	// how confident the detector is, between 0 and 1
+	Confidence float64
+}
+
+// Detector tells the types a file may be of, from its first bytes, most
+// likely first. It returns no candidates when it cannot tell.
+type Detector interface {
+	Detect(r Peeker) ([]Candidate, error)
+}
+
+// FiletypeDetector detects types with h2non/filetype, telling apart the
+// formats it doesn't know or mixes up (APNG, AVIF, HEIC, JPEG XL). It is the
+// default detector.
+type FiletypeDetector struct{}
+
+// HTTPDetector detects types the way Go's net/http does (see
+// http.DetectContentType), which follows the WHATWG MIME sniffing algorithm
+// used by browsers.
+type HTTPDetector struct{}
+
+// ChainMode tells how a Chain combines its detectors.
+type ChainMode string
+
+const (
+	// the candidates of the first detector telling a type
+	ChainFirstMatch ChainMode = "first_match"
+
+	// the most likely candidate, provided all detectors agree on it
+	ChainAllAgree ChainMode = "all_agree"
+)
+
+// Chain combines detectors (e.g. FiletypeDetector and HTTPDetector), first
+// match by default.
+type Chain struct {
+	Detectors []Detector
+	Mode      ChainMode
+}
+
+var (
+	// categories of filetype, in the order they are looked at
+	filetypeCategories = []struct {
+		category string
+		is       func([]byte) bool
+	}{
+		{TypeAPPLICATION, filetype.IsApplication},
+		{TypeARCHIVE, filetype.IsArchive},
+		{TypeAUDIO, filetype.IsAudio},
+		{TypeDOCUMENTS, filetype.IsDocument},
+		{TypeFONT, filetype.IsFont},
+		{TypeIMAGE, filetype.IsImage},
+		{TypeVIDEO, filetype.IsVideo},
+	}
+
+	// signatures past the first bytes of the file, read when filetype cannot
+	// tell the type from the sniff window
+	rangeSignatures = []struct {
+		offset    int64
+		signature string
+		ext       string
+	}{
+		{offset: 257, signature: "ustar", ext: ExtArchiveTAR},
+		{offset: 32769, signature: "CD001", ext: ExtArchiveISO},
+		{offset: 34817, signature: "CD001", ext: ExtArchiveISO},
+		{offset: 36865, signature: "CD001", ext: ExtArchiveISO},
+	}
+
+	// extensions of the MIME types http.DetectContentType returns. Text types
+	// have extensions that are never authorised.
+	httpExtensions = map[string]string{
+		"application/ogg":               ExtAudioOGG,
+		"application/pdf":               ExtArchivePDF,
+		"application/postscript":        ExtArchivePS,
+		"application/vnd.ms-fontobject": ExtArchiveEOT,
+		"application/wasm":              ExtAppWASM,
+		"application/x-gzip":            ExtArchiveGZ,
+		"application/x-rar-compressed":  ExtArchiveRAR,
+		"application/zip":               ExtArchiveZIP,
+		"audio/aiff":                    ExtAudioAIFF,
+		"audio/midi":                    ExtAudioMID,
+		"audio/mpeg":                    ExtAudioMP3,
+		"audio/wave":                    ExtAudioWAV,
+		"font/otf":                      ExtFontOTF,
+		"font/ttf":                      ExtFontTTF,
+		"font/woff":                     ExtFontWOFF,
+		"font/woff2":                    ExtFontWOFF2,
+		"image/bmp":                     ExtImgBMP,
+		"image/gif":                     ExtImgGIF,
+		"image/jpeg":                    ExtImgJPG,
+		"image/png":                     ExtImgPNG,
+		"image/webp":                    ExtImgWEBP,
+		"image/x-icon":                  ExtImgICO,
+		"text/html":                     "html",
+		"text/plain":                    "txt",
+		"text/xml":                      "xml",
+		"video/avi":                     ExtVideoAVI,
+		"video/mp4":                     ExtVideoMP4,
+		"video/webm":                    ExtVideoWEBM,
+	}
+)
+
+// Detect implements Detector. Magic numbers are trusted fully. The whole
+// sniff window is looked at and, given a Ranger, signatures past it too.
+func (FiletypeDetector) Detect(r Peeker) ([]Candidate, error) {
+	header, err := peek(r, maxSniffWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	kind, err := filetype.Match(header)
+	if err != nil {
+		return nil, nil
+	}
+
+	// refined kinds are unknown to filetype, hence to its categories
+	if refined, found := refineKind(header, kind); found {
+		return []Candidate{{Type: refined, Category: categoryOf(refined.Extension), Confidence: 1}}, nil
+	}
+
+	if kind == filetype.Unknown {
+		return rangeCandidates(r)
+	}
+
+	for _, c := range filetypeCategories {
+		if c.is(header) {
+			return []Candidate{{Type: kind, Category: c.category, Confidence: 1}}, nil
+		}
+	}
+	return []Candidate{{Type: kind, Confidence: 1}}, nil
+}
+
+// Detect implements Detector. Text types, told by heuristics rather than
+// signatures, are half trusted.
+func (HTTPDetector) Detect(r Peeker) ([]Candidate, error) {
+	header, err := peek(r, sniffLength)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		contentType     = http.DetectContentType(header)
+		mediaType, _, _ = mime.ParseMediaType(contentType)
+		confidence      = 1.0
+	)
+
+	ext, found := httpExtensions[mediaType]
+	if !found {
+		return nil, nil
+	}
+
+	if mediaType == "text/plain" {
+		confidence = 0.5
+	}
+
+	return []Candidate{{
+		Type:       types.Type{MIME: types.NewMIME(mediaType), Extension: ext},
+		Category:   categoryOf(ext),
+		Confidence: confidence,
+	}}, nil
+}
+
+// Detect implements Detector. All detectors agreeing, the candidate is the
+// one of the first detector, with the lowest confidence of them all.
+func (c Chain) Detect(r Peeker) ([]Candidate, error) {
+	var agreed Candidate
+
+	for i, detector := range c.Detectors {
+		candidates, err := detector.Detect(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.Mode != ChainAllAgree {
+			if len(candidates) > 0 {
+				return candidates, nil
+			}
+			continue
+		}
+
+		switch {
+		case len(candidates) == 0:
+			return nil, nil
+		case i == 0:
+			agreed = candidates[0]
+		case candidates[0].Type.Extension != agreed.Type.Extension:
+			return nil, nil
+		case candidates[0].Confidence < agreed.Confidence:
+			agreed.Confidence = candidates[0].Confidence
+		}
+	}
+
+	if c.Mode != ChainAllAgree || len(c.Detectors) == 0 {
+		return nil, nil
+	}
+	return []Candidate{agreed}, nil
+}
+
+// SetDetector sets the detector telling the type of the file, FiletypeDetector
+// by default. Detectors set in the policy take precedence.
+func (fc *FileChecker) SetDetector(detector Detector) {
+	fc.detector = detector
+}
+
+// detect is a private method. Returns the candidates of the detector(s), the
+// most likely first.
+func (fc *FileChecker) detect(r Peeker) ([]Candidate, error) {
+	var detector Detector = FiletypeDetector{}
+
+	switch {
+	case len(fc.policy.Detectors) > 0:
+		detector = Chain{Detectors: fc.policy.Detectors, Mode: fc.policy.DetectorMode}
+	case fc.detector != nil:
+		detector = fc.detector
+	}
+
+	candidates, err := detector.Detect(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+	return candidates, nil
+}
+
+// rangeCandidates looks for signatures past the first bytes of the file, if
+// it can read ranges.
+func rangeCandidates(r Peeker) ([]Candidate, error) {
+	ranger, ok := r.(Ranger)
+	if !ok {
+		return nil, nil
+	}
+
+	for _, s := range rangeSignatures {
+		data, err := ranger.ReadRange(s.offset, len(s.signature))
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if string(data) == s.signature {
+			return []Candidate{{Type: filetype.GetType(s.ext), Category: categoryOf(s.ext), Confidence: 1}}, nil
+		}
+	}
+	return nil, nil
+}
+
+// peek returns up to n first bytes, fewer if the file is shorter.
+func peek(r Peeker, n int) ([]byte, error) {
+	data, err := r.Peek(n)
+	if err == io.EOF || err == bufio.ErrBufferFull {
+		err = nil
+	}
+	return data, err
+}
+
+// categoryOf returns the category (e.g. TypeIMAGE) of an extension, "" if
+// unknown.
+func categoryOf(ext string) string {
+	for typ, extensions := range availableExtensions {
+		if _, found := extensions[ext]; found {
+			return typ
+		}
+	}
+	return ""
+}
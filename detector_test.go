@@ -0,0 +1,152 @@
+package filechecker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/h2non/filetype/types"
+)
+
+// stubDetector always tells the same candidates.
+type stubDetector []Candidate
+
+func (d stubDetector) Detect(Peeker) ([]Candidate, error) { return d, nil }
+
+// failingDetector cannot peek.
+type failingDetector struct{}
+
+func (failingDetector) Detect(Peeker) ([]Candidate, error) { return nil, errors.New("cannot peek") }
+
+//nolint:funlen
+func TestDetectors(t *testing.T) {
+	var (
+		avif     = concat(ftyp("avif", "mif1", "miaf"), make([]byte, 32))
+		bothOf   = []Detector{FiletypeDetector{}, HTTPDetector{}}
+		agree    = Chain{Detectors: bothOf, Mode: ChainAllAgree}
+		first    = Chain{Detectors: bothOf, Mode: ChainFirstMatch}
+		textStub = stubDetector{{Type: types.Type{Extension: "txt"}, Confidence: 0.2}}
+	)
+
+	tests := []struct {
+		name       string
+		detector   Detector
+		data       []byte
+		extension  string
+		mime       string
+		category   string
+		confidence float64
+	}{
+		{name: "filetype-PNG", detector: FiletypeDetector{}, data: testPNG(t), extension: ExtImgPNG, mime: "image/png", category: TypeIMAGE, confidence: 1},
+		{name: "filetype-PDF", detector: FiletypeDetector{}, data: []byte("%PDF-1.7\n"), extension: ExtArchivePDF, category: TypeARCHIVE, confidence: 1},
+		{name: "filetype-AVIF", detector: FiletypeDetector{}, data: avif, extension: ExtImgAVIF, mime: "image/avif", category: TypeIMAGE, confidence: 1},
+		{name: "filetype-text", detector: FiletypeDetector{}, data: []byte("hello")},
+		{name: "http-PNG", detector: HTTPDetector{}, data: testPNG(t), extension: ExtImgPNG, mime: "image/png", category: TypeIMAGE, confidence: 1},
+		{name: "http-WAV", detector: HTTPDetector{}, data: testWAV(), extension: ExtAudioWAV, mime: "audio/wave", category: TypeAUDIO, confidence: 1},
+		{name: "http-AVIF", detector: HTTPDetector{}, data: avif},
+		{name: "http-text", detector: HTTPDetector{}, data: []byte("hello"), extension: "txt", mime: "text/plain", confidence: 0.5},
+		{name: "agree-PNG", detector: agree, data: testPNG(t), extension: ExtImgPNG, mime: "image/png", category: TypeIMAGE, confidence: 1},
+		{name: "agree-JPG", detector: agree, data: testJPEG(t), extension: ExtImgJPG, mime: "image/jpeg", category: TypeIMAGE, confidence: 1},
+		{name: "agree-AVIF", detector: agree, data: avif},
+		{name: "agree-lowest-confidence", detector: Chain{Detectors: []Detector{HTTPDetector{}, textStub}, Mode: ChainAllAgree}, data: []byte("hello"), extension: "txt", mime: "text/plain", confidence: 0.2},
+		{name: "agree-none", detector: Chain{Mode: ChainAllAgree}, data: testPNG(t)},
+		{name: "first-AVIF", detector: first, data: avif, extension: ExtImgAVIF, category: TypeIMAGE, confidence: 1},
+		{name: "first-text", detector: first, data: []byte("hello"), extension: "txt", confidence: 0.5},
+		{name: "first-default-mode", detector: Chain{Detectors: []Detector{HTTPDetector{}, FiletypeDetector{}}}, data: avif, extension: ExtImgAVIF, category: TypeIMAGE, confidence: 1},
+		{name: "first-none", detector: Chain{}, data: testPNG(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates, err := tt.detector.Detect(bufio.NewReader(bytes.NewReader(tt.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.extension == "" {
+				if len(candidates) > 0 {
+					t.Errorf("Detect() = %+v, want none", candidates)
+				}
+				return
+			}
+
+			if len(candidates) == 0 {
+				t.Fatalf("Detect() = none, want %s", tt.extension)
+			}
+
+			got := candidates[0]
+			if got.Type.Extension != tt.extension || (tt.mime != "" && got.Type.MIME.Value != tt.mime) ||
+				got.Category != tt.category || got.Confidence != tt.confidence {
+				t.Errorf("Detect() = %s (%s, %s, %v), want %s (%s, %s, %v)", got.Type.Extension, got.Type.MIME.Value,
+					got.Category, got.Confidence, tt.extension, tt.mime, tt.category, tt.confidence)
+			}
+		})
+	}
+}
+
+func TestChain_Error(t *testing.T) {
+	for _, mode := range []ChainMode{ChainFirstMatch, ChainAllAgree} {
+		chain := Chain{Detectors: []Detector{failingDetector{}, FiletypeDetector{}}, Mode: mode}
+		if _, err := chain.Detect(bufio.NewReader(bytes.NewReader(testPNG(t)))); err == nil {
+			t.Errorf("Detect(%s) = nil error, want one", mode)
+		}
+	}
+}
+
+//nolint:funlen
+func TestFileChecker_Check_Detector(t *testing.T) {
+	var (
+		avif  = concat(ftyp("avif", "mif1"), make([]byte, 32))
+		agree = []Detector{FiletypeDetector{}, HTTPDetector{}}
+	)
+
+	tests := []struct {
+		name     string
+		detector Detector
+		policy   Policy
+		filename string
+		data     []byte
+		reason   Reason
+	}{
+		{name: "default", filename: "photo.avif", data: avif},
+		{name: "http-PNG", detector: HTTPDetector{}, filename: "photo.png", data: testPNG(t)},
+		{name: "http-AVIF", detector: HTTPDetector{}, filename: "photo.avif", data: avif, reason: ReasonUnknownType},
+		{name: "http-text", detector: HTTPDetector{}, filename: "notes.txt", data: []byte("hello"), reason: ReasonTypeNotAuthorised},
+		{name: "policy-agree-PNG", policy: Policy{Detectors: agree, DetectorMode: ChainAllAgree}, filename: "photo.png", data: testPNG(t)},
+		{name: "policy-agree-AVIF", policy: Policy{Detectors: agree, DetectorMode: ChainAllAgree}, filename: "photo.avif", data: avif, reason: ReasonUnknownType},
+		{
+			name:     "policy-over-detector",
+			detector: HTTPDetector{},
+			policy:   Policy{Detectors: []Detector{FiletypeDetector{}}},
+			filename: "photo.avif",
+			data:     avif,
+		},
+		{
+			name:     "most-confident-first",
+			detector: stubDetector{{Type: types.Type{Extension: ExtImgGIF}, Category: TypeIMAGE, Confidence: 0.3}, {Type: types.Type{Extension: ExtImgPNG}, Category: TypeIMAGE, Confidence: 0.9}},
+			filename: "photo.png",
+			data:     testPNG(t),
+		},
+		{name: "detector-error", detector: failingDetector{}, filename: "photo.png", data: testPNG(t), reason: ReasonUnreadable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mpFileHeader, err := getMultipartFileHeaderFromBytes(tt.filename, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fc := GetFileChecker(mpFileHeader)
+			fc.SetExtensions([]string{ExtImgAVIF})
+			fc.SetDetector(tt.detector)
+			fc.SetPolicy(tt.policy)
+
+			got := fc.Check()
+			if got.Reason != tt.reason || got.Authorised != (tt.reason == ReasonNone) {
+				t.Errorf("Check() = %v (%s), want %s", got.Authorised, got.Reason, tt.reason)
+			}
+		})
+	}
+}
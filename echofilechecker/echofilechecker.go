@@ -0,0 +1,75 @@
+// Package echofilechecker adapts filechecker to Echo: a middleware checking
+// multipart uploads, and a validator supporting the filecheck tag.
+package echofilechecker
+
+import (
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/validation"
+)
+
+// ReportKey is the key of the form report in the Echo context.
+const ReportKey = "filechecker.report"
+
+// Validator is an echo.Validator (see Echo#Validator) checking structs with
+// go-playground/validator, file fields included, e.g.
+// `validate:"required,filecheck=images"`.
+type Validator struct {
+	validate *validator.Validate
+}
+
+// Middleware checks the files of multipart requests before the next
+// handler. Rejected uploads are answered with a problem+json error;
+// authorised ones go on with the report in the context (see Report).
+func Middleware(options filechecker.MiddlewareOptions) echo.MiddlewareFunc {
+	middleware := filechecker.Middleware(options)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var err error
+
+			middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				c.SetRequest(r)
+				if report, ok := filechecker.ReportFromContext(r.Context()); ok {
+					c.Set(ReportKey, report)
+				}
+				err = next(c)
+			})).ServeHTTP(c.Response(), c.Request())
+
+			return err
+		}
+	}
+}
+
+// Report returns the report of the files of the request, as stored by the
+// middleware.
+func Report(c echo.Context) (*filechecker.FormReport, bool) {
+	report, ok := c.Get(ReportKey).(*filechecker.FormReport)
+	return report, ok
+}
+
+// NewValidator returns a Validator checking files against the policies of
+// the given profiles, and supporting the file tags (see
+// validation.RegisterTags).
+func NewValidator(profiles map[string]filechecker.Policy) (*Validator, error) {
+	validate := validator.New()
+	if err := validation.RegisterTags(validate); err != nil {
+		return nil, err
+	}
+	if err := validation.Register(validate, profiles); err != nil {
+		return nil, err
+	}
+	return &Validator{validate: validate}, nil
+}
+
+// Validate implements echo.Validator. Failures are bad requests.
+func (v *Validator) Validate(i interface{}) error {
+	if err := v.validate.Struct(i); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	return nil
+}
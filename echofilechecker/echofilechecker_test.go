@@ -0,0 +1,101 @@
+package echofilechecker
+
+import (
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/internal/fctest"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   fctest.File
+		status int
+		reason filechecker.Reason
+	}{
+		{name: "authorised", file: fctest.File{Field: "avatar", Filename: "me.png", Data: fctest.PNG(t)}, status: http.StatusNoContent},
+		{name: "rejected", file: fctest.File{Field: "avatar", Filename: "me.gif", Data: fctest.GIF(t)}, status: http.StatusUnprocessableEntity, reason: filechecker.ReasonExtensionNotAuthorised},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w = httptest.NewRecorder()
+				e = echo.New()
+			)
+
+			e.POST("/upload", func(c echo.Context) error {
+				report, ok := Report(c)
+				if !ok || !report.Authorised {
+					t.Errorf("Report() = %+v, %v", report, ok)
+				}
+				return c.NoContent(http.StatusNoContent)
+			}, Middleware(filechecker.MiddlewareOptions{}))
+			e.ServeHTTP(w, fctest.Request(t, "/upload", tt.file))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusNoContent {
+				return
+			}
+
+			var problem filechecker.Problem
+			if err := json.NewDecoder(w.Body).Decode(&problem); err != nil || problem.Reason != tt.reason {
+				t.Errorf("problem = %+v, %v, want %s", problem, err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestValidator(t *testing.T) {
+	type upload struct {
+		Avatar *multipart.FileHeader `validate:"required,filecheck=images"`
+	}
+
+	validator, err := NewValidator(map[string]filechecker.Policy{"images": {SetExtensions: []string{filechecker.ExtImgGIF}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		file   fctest.File
+		status int
+	}{
+		{name: "authorised", file: fctest.File{Field: "avatar", Filename: "me.gif", Data: fctest.GIF(t)}, status: http.StatusNoContent},
+		{name: "rejected", file: fctest.File{Field: "avatar", Filename: "me.txt", Data: []byte("hello")}, status: http.StatusBadRequest},
+		{name: "missing", file: fctest.File{Field: "other", Filename: "me.png", Data: fctest.PNG(t)}, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w = httptest.NewRecorder()
+				e = echo.New()
+			)
+
+			e.Validator = validator
+			e.POST("/upload", func(c echo.Context) error {
+				var form upload
+				form.Avatar, _ = c.FormFile("avatar")
+				if err := c.Validate(&form); err != nil {
+					return err
+				}
+				return c.NoContent(http.StatusNoContent)
+			})
+			e.ServeHTTP(w, fctest.Request(t, "/upload", tt.file))
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d (%s), want %d", w.Code, w.Body, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+module github.com/nadimattari/filechecker/echofilechecker
+
+go 1.19
+
+require (
+	github.com/go-playground/validator/v10 v10.20.0
+	github.com/labstack/echo/v4 v4.12.0
+	github.com/nadimattari/filechecker v1.0.0
+	github.com/nadimattari/filechecker/validation v1.0.0
+)
+
+require (
+	github.com/gabriel-vasile/mimetype v1.4.3 // indirect
+	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-playground/universal-translator v0.18.1 // indirect
+	github.com/h2non/filetype v1.1.3 // indirect
+	github.com/labstack/gommon v0.4.2 // indirect
+	github.com/leodido/go-urn v1.4.0 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasttemplate v1.2.2 // indirect
+	golang.org/x/crypto v0.23.0 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
+)
@@ -0,0 +1,98 @@
+package filechecker
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+)
+
+// EICAR test file (see https://www.eicar.org/download-anti-malware-testfile/),
+// split so that this package is not itself detected by antivirus software
+const (
+	eicarHead = `X5O!P%@AP[4\PZX54(P^)7CC)7}$`
+	eicarTail = `EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+	// maximum size of the test file, trailing whitespace included
+	eicarMaxSize = 128
+
+	// limits of the archives looked into: nesting (e.g. eicar_com2.zip),
+	// size of nested archives, and entries
+	eicarMaxDepth      = 2
+	eicarMaxNestedSize = 1 << 20
+	eicarMaxEntries    = 10000
+)
+
+// isEICAR tells whether the content is the EICAR test file: the test string,
+// possibly followed by whitespace, 128 bytes at most.
+func isEICAR(data []byte) bool {
+	if len(data) > eicarMaxSize || len(data) < len(eicarHead)+len(eicarTail) {
+		return false
+	}
+	if string(data[:len(eicarHead)]) != eicarHead || string(data[len(eicarHead):len(eicarHead)+len(eicarTail)]) != eicarTail {
+		return false
+	}
+	for _, c := range data[len(eicarHead)+len(eicarTail):] {
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' && c != 0x1A {
+			return false
+		}
+	}
+	return true
+}
+
+// containsEICAR tells whether the file is the EICAR test file, or a zip
+// archive holding it (possibly in nested archives).
+func containsEICAR(r io.ReaderAt, size int64, depth int) bool {
+	head := make([]byte, eicarMaxSize+1)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+
+	if isEICAR(head) {
+		return true
+	}
+	if depth >= eicarMaxDepth || !bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		return false
+	}
+
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return false
+	}
+
+	for i, entry := range archive.File {
+		if i >= eicarMaxEntries {
+			break
+		}
+		if !entry.FileInfo().IsDir() && entryContainsEICAR(entry, depth) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryContainsEICAR tells whether the entry of a zip archive is the EICAR
+// test file, or a nested archive holding it. Only the first bytes of other
+// entries are read.
+func entryContainsEICAR(entry *zip.File, depth int) bool {
+	rc, err := entry.Open()
+	if err != nil {
+		return false
+	}
+	defer func() { _ = rc.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(rc, eicarMaxSize+1))
+	switch {
+	case err != nil:
+		return false
+	case len(data) <= eicarMaxSize:
+		return isEICAR(data)
+	case depth+1 >= eicarMaxDepth || entry.UncompressedSize64 > eicarMaxNestedSize || !bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return false
+	}
+
+	rest, err := io.ReadAll(io.LimitReader(rc, eicarMaxNestedSize-int64(len(data))))
+	if err != nil {
+		return false
+	}
+	data = append(data, rest...)
+	return containsEICAR(bytes.NewReader(data), int64(len(data)), depth+1)
+}
@@ -0,0 +1,99 @@
+package filechecker
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+// testEICAR is the EICAR test file.
+const testEICAR = eicarHead + eicarTail
+
+// testContentZip returns a zip archive of the files, by name.
+func testContentZip(t *testing.T, files map[string][]byte) []byte {
+	var (
+		buf bytes.Buffer
+		w   = zip.NewWriter(&buf)
+	)
+
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestContainsEICAR(t *testing.T) {
+	if len(testEICAR) != 68 {
+		t.Fatalf("len(testEICAR) = %d, want 68", len(testEICAR))
+	}
+
+	var (
+		zipped  = testContentZip(t, map[string][]byte{"readme.txt": []byte("hello"), "eicar.com": []byte(testEICAR)})
+		nested  = testContentZip(t, map[string][]byte{"eicarcom.zip": zipped})
+		tooDeep = testContentZip(t, map[string][]byte{"eicar_com2.zip": nested})
+	)
+
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "raw", data: []byte(testEICAR), want: true},
+		{name: "trailing-whitespace", data: []byte(testEICAR + " \r\n\x1a"), want: true},
+		{name: "trailing-content", data: []byte(testEICAR + "x")},
+		{name: "leading-content", data: []byte(" " + testEICAR)},
+		{name: "too-large", data: append([]byte(testEICAR), bytes.Repeat([]byte(" "), 61)...)},
+		{name: "truncated", data: []byte(testEICAR[:60])},
+		{name: "zip", data: zipped, want: true},
+		{name: "nested-zip", data: nested, want: true},
+		{name: "too-deep", data: tooDeep},
+		{name: "clean-zip", data: testContentZip(t, map[string][]byte{"readme.txt": []byte("hello"), "nested.zip": testContentZip(t, map[string][]byte{"a.txt": []byte("a")})})},
+		{name: "malformed-zip", data: []byte("PK\x03\x04 not a zip")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containsEICAR(bytes.NewReader(tt.data), int64(len(tt.data)), 0); got != tt.want {
+				t.Errorf("containsEICAR() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileChecker_Check_EICAR(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+	}{
+		{name: "raw", filename: "eicar.com", data: []byte(testEICAR)},
+		{name: "disguised", filename: "eicar.png", data: []byte(testEICAR + "\r\n")},
+		{name: "zip", filename: "eicar.zip", data: testContentZip(t, map[string][]byte{"eicar.com": []byte(testEICAR)})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := getMultipartFileHeaderFromBytes(tt.filename, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// rejected whatever the policy
+			fc := GetFileChecker(header)
+			fc.SetPolicy(Policy{SetExtensions: []string{ExtArchiveZIP}, AllowExecutables: []string{ExecScript}})
+
+			if verdict := fc.Check(); verdict.Reason != ReasonEICAR {
+				t.Errorf("Check() = %+v, want %q", verdict, ReasonEICAR)
+			}
+		})
+	}
+}
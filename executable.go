@@ -0,0 +1,270 @@
+package filechecker
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/h2non/filetype"
+)
+
+// Kinds of executable content, as reported in Verdict.Executable.
+const (
+	ExecAPK        = "apk"
+	ExecBatch      = "batch"
+	ExecDLL        = "dll"
+	ExecELF        = "elf"
+	ExecHTA        = "hta"
+	ExecJAR        = "jar"
+	ExecJavaClass  = "class"
+	ExecLNK        = "lnk"
+	ExecMachO      = "macho"
+	ExecMSI        = "msi"
+	ExecPE         = "pe"
+	ExecPowerShell = "powershell"
+	ExecScript     = "script"
+)
+
+const (
+	// bytes looked at to detect executable content
+	executableWindow = 4096
+
+	// fat Mach-O files hold at most this many architectures; above that,
+	// 0xCAFEBABE is a Java class file
+	maxFatArchitectures = 20
+)
+
+var (
+	// Mach-O magic numbers (32/64-bit, both endiannesses)
+	machOMagics = [][]byte{
+		{0xFE, 0xED, 0xFA, 0xCE},
+		{0xFE, 0xED, 0xFA, 0xCF},
+		{0xCE, 0xFA, 0xED, 0xFE},
+		{0xCF, 0xFA, 0xED, 0xFE},
+	}
+
+	// Windows shell link (LNK) header size and CLSID
+	lnkHeader = []byte{
+		0x4C, 0x00, 0x00, 0x00, 0x01, 0x14, 0x02, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46,
+	}
+
+	// OLE compound file, and the CLSID of Windows Installer databases
+	// ({000C1084-0000-0000-C000-000000000046}, patches and transforms
+	// differ by their first byte only)
+	cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+	msiCLSID     = []byte{0x10, 0x0C, 0x00, 0x00, 0x00, 0x00, 0x00, 0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}
+
+	// markers of PowerShell scripts, lower-cased: only those hardly found
+	// outside of (malicious) scripts, cmdlet names being common in prose
+	powerShellMarkers = []string{
+		"invoke-expression", "iex(", "| iex", "-encodedcommand", "frombase64string(",
+		"new-object system.net.webclient", "new-object net.webclient", "downloadstring(",
+		"downloadfile(", "[system.reflection.assembly]::load",
+	}
+
+	// markers of batch files, lower-cased, at the start of a line
+	batchMarkers = []string{"@echo off", "@echo on", "@rem ", "setlocal", "goto :", "call :"}
+
+	// extensions declared for scripts, by kind
+	scriptExtensions = map[string]string{
+		".ps1":  ExecPowerShell,
+		".psm1": ExecPowerShell,
+		".psd1": ExecPowerShell,
+		".bat":  ExecBatch,
+		".cmd":  ExecBatch,
+		".hta":  ExecHTA,
+	}
+)
+
+// detectExecutable tells what kind of executable content the file holds,
+// "" if none. The declared filename only helps telling scripts apart, as they
+// are plain text.
+func detectExecutable(r io.ReaderAt, size int64, filename string) string {
+	var (
+		data = make([]byte, executableWindow)
+		n, _ = r.ReadAt(data, 0)
+	)
+	data = data[:n]
+
+	switch {
+	case bytes.HasPrefix(data, []byte("MZ")):
+		return peKind(r, size)
+
+	case bytes.HasPrefix(data, []byte("\x7fELF")):
+		return ExecELF
+
+	case hasAnyPrefix(data, machOMagics):
+		return ExecMachO
+
+	case bytes.HasPrefix(data, []byte{0xCA, 0xFE, 0xBA, 0xBE}) && len(data) >= 8:
+		if binary.BigEndian.Uint32(data[4:]) < maxFatArchitectures {
+			return ExecMachO
+		}
+		return ExecJavaClass
+
+	case bytes.HasPrefix(data, []byte{0xCA, 0xFE, 0xBA, 0xBF}):
+		return ExecMachO // fat, 64-bit
+
+	case bytes.HasPrefix(data, lnkHeader):
+		return ExecLNK
+
+	case bytes.HasPrefix(data, cfbSignature):
+		if isMSI(r, data) {
+			return ExecMSI
+		}
+		return ""
+
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return zipExecutableKind(r, size)
+	}
+
+	return scriptKind(data, filename)
+}
+
+// peKind tells Windows DLLs apart from other PE executables, by the
+// characteristics of the COFF header.
+func peKind(r io.ReaderAt, size int64) string {
+	var (
+		dos    = make([]byte, 64)
+		header = make([]byte, 24)
+	)
+
+	if _, err := r.ReadAt(dos, 0); err != nil {
+		return ExecPE
+	}
+
+	offset := int64(binary.LittleEndian.Uint32(dos[0x3C:]))
+	if offset+24 > size {
+		return ExecPE
+	}
+
+	if _, err := r.ReadAt(header, offset); err != nil || !bytes.HasPrefix(header, []byte("PE\x00\x00")) {
+		return ExecPE
+	}
+
+	// IMAGE_FILE_DLL
+	if binary.LittleEndian.Uint16(header[22:])&0x2000 != 0 {
+		return ExecDLL
+	}
+	return ExecPE
+}
+
+// isMSI reads the CLSID of the root directory entry of an OLE compound file.
+func isMSI(r io.ReaderAt, header []byte) bool {
+	if len(header) < 0x34 {
+		return false
+	}
+
+	var (
+		sectorSize = int64(1) << binary.LittleEndian.Uint16(header[0x1E:])
+		directory  = int64(binary.LittleEndian.Uint32(header[0x30:]))
+		clsid      = make([]byte, 16)
+	)
+
+	if sectorSize < 128 || sectorSize > 1<<16 {
+		return false
+	}
+
+	// sectors are numbered from the end of the header (one sector long), the
+	// CLSID sits at 0x50 in the root entry
+	if _, err := r.ReadAt(clsid, (directory+1)*sectorSize+0x50); err != nil {
+		return false
+	}
+
+	return (clsid[0] == 0x84 || clsid[0] == 0x86 || clsid[0] == 0x82) && bytes.Equal(clsid[1:], msiCLSID)
+}
+
+// zipExecutableKind tells Java (JAR) and Android (APK) archives apart from
+// other ZIP files (including office documents).
+func zipExecutableKind(r io.ReaderAt, size int64) string {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return ""
+	}
+
+	var jar bool
+	for _, file := range archive.File {
+		switch {
+		case file.Name == "AndroidManifest.xml", file.Name == "classes.dex":
+			return ExecAPK
+		case file.Name == "META-INF/MANIFEST.MF", strings.HasSuffix(file.Name, ".class"):
+			jar = true
+		}
+	}
+
+	if jar {
+		return ExecJAR
+	}
+	return ""
+}
+
+// scriptKind detects scripts: shebang, HTML applications, PowerShell and
+// batch files. Binary content, and content of a known type, is never a script.
+func scriptKind(data []byte, filename string) string {
+	if bytes.IndexByte(data, 0x00) >= 0 || filetype.Matches(data) {
+		return ""
+	}
+
+	var (
+		text  = strings.ToLower(string(bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF")), " \t\r\n")))
+		ext   = strings.ToLower(filepath.Ext(filename))
+		lines = strings.Split(text, "\n")
+	)
+
+	switch {
+	case strings.HasPrefix(text, "#!"):
+		return ExecScript
+
+	case strings.Contains(text, "<hta:application"):
+		return ExecHTA
+
+	case containsAny(text, powerShellMarkers):
+		return ExecPowerShell
+	}
+
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); hasAnyStringPrefix(line, batchMarkers) {
+			return ExecBatch
+		}
+	}
+
+	// text declared as a script
+	if text != "" {
+		return scriptExtensions[ext]
+	}
+	return ""
+}
+
+// hasAnyPrefix tells whether data starts with any of prefixes.
+func hasAnyPrefix(data []byte, prefixes [][]byte) bool {
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(data, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyStringPrefix tells whether s starts with any of prefixes.
+func hasAnyStringPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny tells whether s contains any of substrings.
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
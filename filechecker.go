@@ -1,9 +1,11 @@
 package filechecker
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"mime/multipart"
 
-	"github.com/h2non/filetype"
 	"github.com/h2non/filetype/types"
 )
 
@@ -70,13 +72,17 @@ const (
 	ExtFontWOFF  = "woff"
 	ExtFontWOFF2 = "woff2"
 
+	ExtImgAPNG = "apng"
+	ExtImgAVIF = "avif"
 	ExtImgBMP  = "bmp"
 	ExtImgCR2  = "cr2"
 	ExtImgDWG  = "dwg"
 	ExtImgGIF  = "gif"
+	ExtImgHEIC = "heic"
 	ExtImgHEIF = "heif"
 	ExtImgICO  = "ico"
 	ExtImgJPG  = "jpg"
+	ExtImgJXL  = "jxl"
 	ExtImgJXR  = "jxr"
 	ExtImgPNG  = "png"
 	ExtImgPSD  = "psd"
@@ -98,6 +104,9 @@ const (
 type FileChecker struct {
 	file *multipart.FileHeader
 
+	// content of the file when not held by the header, see GetFileCheckerAt
+	source io.ReaderAt
+
 	// list of all authorised types, computed. authorisedTypes[typ] = true|false
 	authorisedTypes map[string]bool
 
@@ -108,6 +117,12 @@ type FileChecker struct {
 	// a dictionary of extensions with their corresponding file types.
 	// _dictionary[ext] = typ
 	_dictionary map[string]string
+
+	// rules applied on top of the authorised types and extensions
+	policy Policy
+
+	// tells the type of the file, FiletypeDetector if nil
+	detector Detector
 }
 
 var (
@@ -177,13 +192,17 @@ var (
 		},
 
 		TypeIMAGE: {
+			ExtImgAPNG: false,
+			ExtImgAVIF: false,
 			ExtImgBMP:  false,
 			ExtImgCR2:  false,
 			ExtImgDWG:  false,
 			ExtImgGIF:  false,
+			ExtImgHEIC: false,
 			ExtImgHEIF: false,
 			ExtImgICO:  false,
 			ExtImgJPG:  true, // allowed by default.
+			ExtImgJXL:  false,
 			ExtImgJXR:  false,
 			ExtImgPNG:  true, // allowed by default.
 			ExtImgPSD:  false,
@@ -206,6 +225,19 @@ var (
 	}
 )
 
+// AvailableExtensions returns all the extensions that can be authorised, with
+// their type. AvailableExtensions()[ext] = typ
+func AvailableExtensions() map[string]string {
+	extensions := make(map[string]string)
+
+	for typ, exts := range availableExtensions {
+		for ext := range exts {
+			extensions[ext] = typ
+		}
+	}
+	return extensions
+}
+
 // GetFileChecker returns an instance of FileChecker.
 func GetFileChecker(file *multipart.FileHeader) *FileChecker {
 	var (
@@ -233,11 +265,69 @@ func GetFileChecker(file *multipart.FileHeader) *FileChecker {
 	}
 }
 
+// GetFileCheckerAt returns a FileChecker for a file read through r (e.g. an
+// *os.File), size bytes long, so that it is not held in memory. r is not
+// closed.
+func GetFileCheckerAt(filename string, r io.ReaderAt, size int64) *FileChecker {
+	fc := GetFileChecker(&multipart.FileHeader{Filename: filename, Size: size})
+	fc.source = r
+	return fc
+}
+
 // SetFile sets the file to be checked.
 func (fc *FileChecker) SetFile(file *multipart.FileHeader) {
 	if file != nil {
-		fc.file = file
+		fc.file, fc.source = file, nil
+	}
+}
+
+// open is a private method. Opens the file, or its source if any.
+func (fc *FileChecker) open() (multipart.File, error) {
+	if fc.source != nil {
+		return sourceFile{io.NewSectionReader(fc.source, 0, fc.file.Size)}, nil
+	}
+	return fc.file.Open()
+}
+
+// sourceFile is the file of a source, left open when closed.
+type sourceFile struct {
+	*io.SectionReader
+}
+
+// Close implements io.Closer.
+func (sourceFile) Close() error { return nil }
+
+// NewFileHeader returns the header of a file held in memory, for checking
+// files that are not uploaded through multipart forms (e.g. gRPC streams).
+func NewFileHeader(filename string, data []byte) (*multipart.FileHeader, error) {
+	var (
+		err    error
+		w      io.Writer
+		form   *multipart.Form
+		body   = new(bytes.Buffer)
+		writer = multipart.NewWriter(body)
+	)
+
+	// parts without filename are values, not files: the filename is set
+	// once parsed
+	if w, err = writer.CreateFormFile("file", "file"); err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	// kept in memory, so that there is no temporary file to remove
+	if form, err = multipart.NewReader(body, writer.Boundary()).ReadForm(int64(len(data)) + 1<<20); err != nil {
+		return nil, err
 	}
+
+	header := form.File["file"][0]
+	header.Filename = filename
+	return header, nil
 }
 
 // SetExtensions sets authorised extensions.
@@ -274,79 +364,169 @@ func (fc *FileChecker) UnsetExtensions(extensions []string) {
 
 // IsAuthorised tells us whether the file is authorised (type and extension).
 func (fc *FileChecker) IsAuthorised() bool {
-	var (
-		err  error
-		file multipart.File
-		kind types.Type
+	return fc.Check().Authorised
+}
+
+// Check verifies the file (type and extension) and returns a verdict telling
+// us whether it is authorised and, if not, why.
+func (fc *FileChecker) Check() *Verdict {
+	return fc.CheckContext(context.Background())
+}
 
-		// file header, first 261 bytes (to be read further below)
-		// see https://www.garykessler.net/library/file_sigs.html
-		header = make([]byte, 261)
+// CheckContext is Check, scanners (see Policy.Scanners) being given the
+// context.
+func (fc *FileChecker) CheckContext(ctx context.Context) *Verdict {
+	var (
+		err        error
+		file       multipart.File
+		kind       types.Type
+		header     *Sample
+		candidates []Candidate
+		verdict    = &Verdict{}
 	)
 
 	// file was not provided or wrongly provided
 	if fc.file == nil {
-		return false
+		return verdict.reject(ReasonNoFile, nil)
+	}
+
+	verdict.Filename = fc.file.Filename
+	verdict.Size = fc.file.Size
+
+	// larger than authorised
+	if fc.policy.MaxFileSize > 0 && fc.file.Size > fc.policy.MaxFileSize {
+		return verdict.reject(ReasonTooLarge, nil)
 	}
 
 	// cannot open
-	if file, err = fc.file.Open(); err != nil {
-		return false
+	if file, err = fc.open(); err != nil {
+		return verdict.reject(ReasonUnreadable, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	// rejected files are quarantined, if the policy says so
+	defer func() { fc.quarantine(ctx, verdict, file) }()
+
+	// first bytes of the file (up to the sniff window), for detectors to
+	// peek at
+	// see https://www.garykessler.net/library/file_sigs.html
+	header, err = NewSample(file, fc.file.Size, fc.policy.SniffWindow)
+	if err != nil {
+		return verdict.reject(ReasonUnreadable, err)
 	}
 
 	// cannot read header
-	if _, err = file.Read(header); err != nil {
-		return false
+	if _, err = header.Peek(1); err != nil {
+		return verdict.reject(ReasonUnreadable, err)
 	}
 
-	// cannot match header
-	if kind, err = filetype.Match(header); err != nil {
-		return false
+	// digests of the file, checked against the lists of the policy
+	if verdict = fc.hash(verdict, file); verdict.Reason != ReasonNone {
+		return verdict
+	}
+
+	// EICAR test file, whatever its type
+	if containsEICAR(file, fc.file.Size, 0) {
+		return verdict.reject(ReasonEICAR, nil)
+	}
+
+	// executable content is rejected whatever the authorised types, unless
+	// the policy opts in
+	if verdict.Executable = detectExecutable(file, fc.file.Size, fc.file.Filename); verdict.Executable != "" {
+		if !containsFold(fc.policy.AllowExecutables, verdict.Executable) {
+			return verdict.reject(ReasonExecutable, nil)
+		}
+	}
+
+	// content a browser would render as HTML, whatever it is detected or
+	// declared as
+	if sniffsHTML(file) {
+		return verdict.reject(ReasonHTML, nil)
+	}
+
+	// type of the file, as told by the detector(s)
+	if candidates, err = fc.detect(header); err != nil {
+		return verdict.reject(ReasonUnreadable, err)
 	}
 
+	// magic numbers not recognised at all
+	if len(candidates) == 0 {
+		return verdict.reject(ReasonUnknownType, nil)
+	}
+
+	kind = candidates[0].Type
+	verdict.Type = candidates[0].Category
+	verdict.Extension = kind.Extension
+	verdict.MIME = kind.MIME.Value
+
 	// verify authorised types
-	if authorised := fc.isTypeAuthorised(header); !authorised {
-		return false
+	if authorised := fc.isTypeAuthorised(candidates); !authorised {
+		return verdict.reject(ReasonTypeNotAuthorised, nil)
 	}
 
 	// extension not among those available or available extension is not
 	// authorised (set to false)
-	if authorised, found := fc.authorisedExtensions[kind.Extension]; !authorised || !found {
-		return false
+	if authorised := fc.isExtensionAuthorised(kind.Extension); !authorised {
+		return verdict.reject(ReasonExtensionNotAuthorised, nil)
 	}
 
-	return true
-}
-
-// isTypeAuthorised is a private method. Checks if type of file is authorised.
-func (fc *FileChecker) isTypeAuthorised(header []byte) bool {
-	if _, authorised := fc.authorisedTypes[TypeAPPLICATION]; authorised && filetype.IsApplication(header) {
-		return true
+	// files of the allow list are not inspected further
+	if verdict.Allowlisted {
+		verdict.Authorised = true
+		return verdict
 	}
 
-	if _, authorised := fc.authorisedTypes[TypeARCHIVE]; authorised && filetype.IsArchive(header) {
-		return true
+	// limits for animated and multi-frame images
+	if limit, found := fc.frameLimit(kind.Extension); found {
+		if verdict = fc.checkFrames(verdict, limit, file); verdict.Reason != ReasonNone {
+			return verdict
+		}
 	}
 
-	if _, authorised := fc.authorisedTypes[TypeAUDIO]; authorised && filetype.IsAudio(header) {
-		return true
+	// limits for audio and video files
+	if limit, found := fc.policy.Media[kind.Extension]; found {
+		if verdict = fc.checkMedia(verdict, limit, file); verdict.Reason != ReasonNone {
+			return verdict
+		}
 	}
 
-	if _, authorised := fc.authorisedTypes[TypeDOCUMENTS]; authorised && filetype.IsDocument(header) {
-		return true
+	// content scanners (e.g. antivirus), once the file is otherwise
+	// authorised
+	if verdict = fc.scan(ctx, verdict, file); verdict.Reason != ReasonNone {
+		return verdict
 	}
 
-	if _, authorised := fc.authorisedTypes[TypeFONT]; authorised && filetype.IsFont(header) {
-		return true
-	}
+	verdict.Authorised = true
+	return verdict
+}
 
-	if _, authorised := fc.authorisedTypes[TypeIMAGE]; authorised && filetype.IsImage(header) {
-		return true
+// isTypeAuthorised is a private method. Checks if type of file (its most
+// likely candidate) is authorised.
+func (fc *FileChecker) isTypeAuthorised(candidates []Candidate) bool {
+	if len(candidates) == 0 || candidates[0].Category == "" {
+		return false
 	}
 
-	if _, authorised := fc.authorisedTypes[TypeVIDEO]; authorised && filetype.IsVideo(header) {
-		return true
+	return fc.authorisedTypes[candidates[0].Category]
+}
+
+// isExtensionAuthorised is a private method. Checks if the extension is
+// authorised. Animated PNGs are wherever PNGs are, unless ExtImgAPNG was
+// unset.
+func (fc *FileChecker) isExtensionAuthorised(ext string) bool {
+	authorised, found := fc.authorisedExtensions[ext]
+	if !found && ext == ExtImgAPNG {
+		return fc.authorisedExtensions[ExtImgPNG]
 	}
+	return authorised
+}
 
-	return false
+// frameLimit is a private method. Returns the frame limit of the extension,
+// animated PNGs without one of their own being limited as PNGs.
+func (fc *FileChecker) frameLimit(ext string) (FrameLimit, bool) {
+	limit, found := fc.policy.Frames[ext]
+	if !found && ext == ExtImgAPNG {
+		limit, found = fc.policy.Frames[ExtImgPNG]
+	}
+	return limit, found
 }
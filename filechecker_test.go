@@ -1,6 +1,7 @@
 package filechecker
 
 import (
+	"bufio"
 	"bytes"
 	"io"
 	"mime/multipart"
@@ -78,13 +79,17 @@ var (
 		ExtFontWOFF:  TypeFONT,
 		ExtFontWOFF2: TypeFONT,
 
+		ExtImgAPNG: TypeIMAGE,
+		ExtImgAVIF: TypeIMAGE,
 		ExtImgBMP:  TypeIMAGE,
 		ExtImgCR2:  TypeIMAGE,
 		ExtImgDWG:  TypeIMAGE,
 		ExtImgGIF:  TypeIMAGE,
+		ExtImgHEIC: TypeIMAGE,
 		ExtImgHEIF: TypeIMAGE,
 		ExtImgICO:  TypeIMAGE,
 		ExtImgJPG:  TypeIMAGE,
+		ExtImgJXL:  TypeIMAGE,
 		ExtImgJXR:  TypeIMAGE,
 		ExtImgPNG:  TypeIMAGE,
 		ExtImgPSD:  TypeIMAGE,
@@ -455,6 +460,62 @@ func TestFileChecker_IsAuthorised(t *testing.T) {
 	}
 }
 
+func TestFileChecker_Check(t *testing.T) {
+	type test struct {
+		name       string
+		file       *multipart.FileHeader
+		unsetExt   []string
+		authorised bool
+		reason     Reason
+		extension  string
+	}
+
+	var (
+		err          error
+		tests        = []test{{name: "NO-FILE", reason: ReasonNoFile}}
+		mpFileHeader *multipart.FileHeader
+	)
+
+	if mpFileHeader, err = getMultipartFileHeader(jpgPath); err == nil {
+		tests = append(tests, test{
+			name:       "JPG",
+			file:       mpFileHeader,
+			authorised: true,
+			extension:  ExtImgJPG,
+		})
+	}
+
+	if mpFileHeader, err = getMultipartFileHeader(fakePath); err == nil {
+		tests = append(tests, test{
+			name:   "FAKE",
+			file:   mpFileHeader,
+			reason: ReasonUnknownType,
+		})
+	}
+
+	if mpFileHeader, err = getMultipartFileHeader(pngPath); err == nil {
+		tests = append(tests, test{
+			name:      "PNG-unset",
+			file:      mpFileHeader,
+			unsetExt:  []string{ExtImgPNG},
+			reason:    ReasonExtensionNotAuthorised,
+			extension: ExtImgPNG,
+		})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := GetFileChecker(tt.file)
+			fc.UnsetExtensions(tt.unsetExt)
+
+			got := fc.Check()
+			if got.Authorised != tt.authorised || got.Reason != tt.reason || got.Extension != tt.extension {
+				t.Errorf("Check() = %+v, want authorised %v, reason %q, extension %q", got, tt.authorised, tt.reason, tt.extension)
+			}
+		})
+	}
+}
+
 //nolint:funlen
 func TestFileChecker_isTypeAuthorised(t *testing.T) {
 	// default file types authorised: TypeIMAGE & TypeARCHIVE
@@ -504,6 +565,14 @@ func TestFileChecker_isTypeAuthorised(t *testing.T) {
 			args: args{header: []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}},
 			want: false, // because TypeDOCUMENTS not authorised
 		},
+		{
+			name: "PNG-Type-Unset",
+			// TypeIMAGE set to false in authorisedTypes, as UnsetExtensions does
+			// once no image extension is left authorised
+			fields: fields{authorisedTypes: map[string]bool{TypeIMAGE: false, TypeARCHIVE: true}},
+			args:   args{header: []byte{0x89, 0x50, 0x4E, 0x47}},
+			want:   false,
+		},
 		{
 			name:   "PK-ZIP",
 			fields: fields{authorisedTypes: getTyp([]string{TypeARCHIVE})},
@@ -525,7 +594,11 @@ func TestFileChecker_isTypeAuthorised(t *testing.T) {
 			fc := &FileChecker{
 				authorisedTypes: tt.fields.authorisedTypes,
 			}
-			if got := fc.isTypeAuthorised(tt.args.header); got != tt.want {
+			candidates, err := FiletypeDetector{}.Detect(bufio.NewReader(bytes.NewReader(tt.args.header)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fc.isTypeAuthorised(candidates); got != tt.want {
 				t.Errorf("isTypeAuthorised() = %v, want %v", got, tt.want)
 			}
 		})
@@ -562,7 +635,6 @@ func mockFileUploadRequest(path string) (*bytes.Buffer, string, error) {
 		err       error
 		file      *os.File
 		fInfo     os.FileInfo
-		ioWriter  io.Writer
 		fContents []byte
 	)
 
@@ -579,12 +651,18 @@ func mockFileUploadRequest(path string) (*bytes.Buffer, string, error) {
 		return nil, "", err
 	}
 
+	return mockUploadRequest(fInfo.Name(), fContents)
+}
+
+func mockUploadRequest(filename string, fContents []byte) (*bytes.Buffer, string, error) {
 	var (
-		body   = new(bytes.Buffer)
-		writer = multipart.NewWriter(body)
+		err      error
+		ioWriter io.Writer
+		body     = new(bytes.Buffer)
+		writer   = multipart.NewWriter(body)
 	)
 
-	if ioWriter, err = writer.CreateFormFile(formFieldName, fInfo.Name()); err != nil {
+	if ioWriter, err = writer.CreateFormFile(formFieldName, filename); err != nil {
 		return nil, "", err
 	}
 
@@ -601,17 +679,80 @@ func getMultipartFileHeader(path string) (*multipart.FileHeader, error) {
 		err      error
 		body     *bytes.Buffer
 		boundary string
-
-		mpReader *multipart.Reader
-		mpForm   *multipart.Form
 	)
 
 	if body, boundary, err = mockFileUploadRequest(path); err != nil {
 		return nil, err
 	}
 
+	return readMultipartFileHeader(body, boundary)
+}
+
+func getMultipartFileHeaderFromBytes(filename string, fContents []byte) (*multipart.FileHeader, error) {
+	var (
+		err      error
+		body     *bytes.Buffer
+		boundary string
+	)
+
+	if body, boundary, err = mockUploadRequest(filename, fContents); err != nil {
+		return nil, err
+	}
+
+	return readMultipartFileHeader(body, boundary)
+}
+
+func readMultipartFileHeader(body *bytes.Buffer, boundary string) (*multipart.FileHeader, error) {
+	var (
+		mpReader *multipart.Reader
+		mpForm   *multipart.Form
+	)
+
 	mpReader = multipart.NewReader(body, boundary)
 	mpForm, _ = mpReader.ReadForm(1024)
 
 	return mpForm.File[formFieldName][0], nil
 }
+
+func TestAvailableExtensions(t *testing.T) {
+	tests := []struct {
+		ext  string
+		want string
+	}{
+		{ext: ExtImgJPG, want: TypeIMAGE},
+		{ext: ExtImgGIF, want: TypeIMAGE},
+		{ext: ExtArchiveZ, want: TypeARCHIVE},
+	}
+
+	extensions := AvailableExtensions()
+	for _, tt := range tests {
+		t.Run(tt.ext, func(t *testing.T) {
+			if got := extensions[tt.ext]; got != tt.want {
+				t.Errorf("AvailableExtensions()[%q] = %q, want %q", tt.ext, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFileHeader(t *testing.T) {
+	data, err := os.ReadFile(jpgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := NewFileHeader("photo.jpg", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Filename != "photo.jpg" || header.Size != int64(len(data)) {
+		t.Errorf("NewFileHeader() = %s (%d bytes), want photo.jpg (%d bytes)", header.Filename, header.Size, len(data))
+	}
+	if verdict := GetFileChecker(header).Check(); !verdict.Authorised || verdict.Extension != ExtImgJPG {
+		t.Errorf("Check() = %+v, want authorised JPG", verdict)
+	}
+
+	// without filename
+	if header, err = NewFileHeader("", data); err != nil || header.Filename != "" || header.Size != int64(len(data)) {
+		t.Errorf("NewFileHeader() = %+v, %v, want unnamed file", header, err)
+	}
+}
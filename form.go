@@ -0,0 +1,144 @@
+package filechecker
+
+import (
+	"context"
+	"mime/multipart"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// FormReport is the outcome of checking the files of a form.
+type FormReport struct {
+	// whether all the files of all the fields are authorised
+	Authorised bool `json:"authorised"`
+
+	// reports of the fields, by name
+	Fields map[string]*FieldReport `json:"fields"`
+}
+
+// FieldReport is the outcome of checking the files of a form field.
+type FieldReport struct {
+	// whether the field is authorised: all its files are, and there are as
+	// many as the policy says
+	Authorised bool `json:"authorised"`
+
+	// why the field was rejected, ReasonNone when authorised
+	Reason Reason `json:"reason,omitempty"`
+
+	// number and total size, in bytes, of the files
+	Count     int   `json:"count"`
+	TotalSize int64 `json:"total_size"`
+
+	// verdicts of the files, in the order of the form, none if their number
+	// or total size is out of the policy
+	Files []*Verdict `json:"files"`
+}
+
+// CheckForm checks, in parallel, every file of a form against the policy of
+// its field. Fields without a policy are rejected, fields with a policy but
+// no files are checked against MinFiles. Detectors of the policies must be
+// safe for concurrent use.
+func CheckForm(form *multipart.Form, policies map[string]Policy) *FormReport {
+	return CheckFormContext(context.Background(), form, policies)
+}
+
+// CheckFormContext is CheckForm, scanners (see Policy.Scanners) being given
+// the context.
+func CheckFormContext(ctx context.Context, form *multipart.Form, policies map[string]Policy) *FormReport {
+	var (
+		report = &FormReport{Authorised: true, Fields: make(map[string]*FieldReport)}
+		files  = make(map[string][]*multipart.FileHeader)
+	)
+
+	if form != nil {
+		files = form.File
+	}
+
+	for field, policy := range policies {
+		report.Fields[field] = checkField(WithQuarantineMetadata(ctx, map[string]string{"field": field}), files[field], policy)
+	}
+
+	for field, headers := range files {
+		if _, found := policies[field]; !found {
+			report.Fields[field] = &FieldReport{Reason: ReasonUnexpectedField, Count: len(headers), Files: []*Verdict{}}
+		}
+	}
+
+	for _, field := range report.Fields {
+		if !field.Authorised {
+			report.Authorised = false
+		}
+	}
+
+	return report
+}
+
+// Rejected returns the names of the rejected fields, sorted.
+func (r *FormReport) Rejected() []string {
+	var fields []string
+
+	for name, field := range r.Fields {
+		if !field.Authorised {
+			fields = append(fields, name)
+		}
+	}
+
+	sort.Strings(fields)
+	return fields
+}
+
+// checkField checks the number and total size of the files of a field, then,
+// if within the policy, the files themselves, in parallel.
+func checkField(ctx context.Context, headers []*multipart.FileHeader, policy Policy) *FieldReport {
+	var (
+		report = &FieldReport{Count: len(headers), Files: []*Verdict{}}
+		wg     sync.WaitGroup
+
+		// at most one check per CPU at once
+		slots = make(chan struct{}, runtime.NumCPU())
+	)
+
+	for _, header := range headers {
+		report.TotalSize += header.Size
+	}
+
+	// files of a field out of bounds are not checked
+	switch {
+	case policy.MinFiles > 0 && report.Count < policy.MinFiles:
+		report.Reason = ReasonTooFewFiles
+	case policy.MaxFiles > 0 && report.Count > policy.MaxFiles:
+		report.Reason = ReasonTooManyFiles
+	case policy.MaxTotalSize > 0 && report.TotalSize > policy.MaxTotalSize:
+		report.Reason = ReasonTotalTooLarge
+	}
+	if report.Reason != ReasonNone {
+		return report
+	}
+
+	report.Files = make([]*Verdict, len(headers))
+	for i, header := range headers {
+		wg.Add(1)
+		go func(i int, header *multipart.FileHeader) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			fc := GetFileChecker(header)
+			fc.SetPolicy(policy)
+			report.Files[i] = fc.CheckContext(ctx)
+		}(i, header)
+	}
+	wg.Wait()
+
+	for _, verdict := range report.Files {
+		if !verdict.Authorised {
+			report.Reason = ReasonFileRejected
+			break
+		}
+	}
+
+	report.Authorised = report.Reason == ReasonNone
+	return report
+}
@@ -0,0 +1,181 @@
+package filechecker
+
+import (
+	"bytes"
+	"mime/multipart"
+	"reflect"
+	"testing"
+)
+
+type formFile struct {
+	field    string
+	filename string
+	data     []byte
+}
+
+func testForm(t *testing.T, files ...formFile) *multipart.Form {
+	var (
+		body   = new(bytes.Buffer)
+		writer = multipart.NewWriter(body)
+	)
+
+	for _, file := range files {
+		w, err := writer.CreateFormFile(file.field, file.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(file.data)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	form, err := multipart.NewReader(body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form
+}
+
+//nolint:funlen
+func TestCheckForm(t *testing.T) {
+	var (
+		png  = testPNG(t)
+		jpg  = testJPEG(t)
+		pdf  = []byte("%PDF-1.7\n%%EOF\n")
+		gif  = testGIF(t, 1)
+		form = testForm(t,
+			formFile{"avatar", "me.png", png},
+			formFile{"attachments[]", "a.pdf", pdf},
+			formFile{"attachments[]", "b.jpg", jpg},
+			formFile{"attachments[]", "c.gif", gif},
+		)
+	)
+
+	tests := []struct {
+		name       string
+		form       *multipart.Form
+		policies   map[string]Policy
+		authorised bool
+		reasons    map[string]Reason
+		files      map[string][]Reason
+	}{
+		{
+			name: "authorised",
+			form: form,
+			policies: map[string]Policy{
+				"avatar":        {MaxFiles: 1, MaxFileSize: 1 << 20},
+				"attachments[]": {SetExtensions: []string{ExtImgGIF}, MaxFiles: 3},
+			},
+			authorised: true,
+			reasons:    map[string]Reason{"avatar": ReasonNone, "attachments[]": ReasonNone},
+			files:      map[string][]Reason{"avatar": {ReasonNone}, "attachments[]": {ReasonNone, ReasonNone, ReasonNone}},
+		},
+		{
+			name: "file-rejected",
+			form: form,
+			policies: map[string]Policy{
+				"avatar":        {UnsetExtensions: []string{ExtImgPNG}},
+				"attachments[]": {SetExtensions: []string{ExtImgGIF}},
+			},
+			reasons: map[string]Reason{"avatar": ReasonFileRejected, "attachments[]": ReasonNone},
+			files:   map[string][]Reason{"avatar": {ReasonExtensionNotAuthorised}, "attachments[]": {ReasonNone, ReasonNone, ReasonNone}},
+		},
+		{
+			name: "per-field-extensions",
+			form: form,
+			policies: map[string]Policy{
+				"avatar":        {},
+				"attachments[]": {},
+			},
+			reasons: map[string]Reason{"avatar": ReasonNone, "attachments[]": ReasonFileRejected},
+			files:   map[string][]Reason{"avatar": {ReasonNone}, "attachments[]": {ReasonNone, ReasonNone, ReasonExtensionNotAuthorised}},
+		},
+		{
+			name: "counts-and-sizes",
+			form: form,
+			policies: map[string]Policy{
+				"avatar":        {MaxFileSize: int64(len(png)) - 1},
+				"attachments[]": {SetExtensions: []string{ExtImgGIF}, MaxFiles: 2},
+				"cv":            {MinFiles: 1},
+			},
+			reasons: map[string]Reason{"avatar": ReasonFileRejected, "attachments[]": ReasonTooManyFiles, "cv": ReasonTooFewFiles},
+			files:   map[string][]Reason{"avatar": {ReasonTooLarge}, "attachments[]": {}, "cv": {}},
+		},
+		{
+			name: "total-too-large",
+			form: form,
+			policies: map[string]Policy{
+				"avatar":        {},
+				"attachments[]": {SetExtensions: []string{ExtImgGIF}, MaxTotalSize: int64(len(pdf) + len(jpg))},
+			},
+			reasons: map[string]Reason{"avatar": ReasonNone, "attachments[]": ReasonTotalTooLarge},
+			files:   map[string][]Reason{"avatar": {ReasonNone}, "attachments[]": {}},
+		},
+		{
+			name:     "unexpected-field",
+			form:     form,
+			policies: map[string]Policy{"avatar": {}},
+			reasons:  map[string]Reason{"avatar": ReasonNone, "attachments[]": ReasonUnexpectedField},
+			files:    map[string][]Reason{"avatar": {ReasonNone}, "attachments[]": {}},
+		},
+		{
+			name:       "no-form",
+			policies:   map[string]Policy{"cv": {}},
+			authorised: true,
+			reasons:    map[string]Reason{"cv": ReasonNone},
+			files:      map[string][]Reason{"cv": {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := CheckForm(tt.form, tt.policies)
+			if report.Authorised != tt.authorised {
+				t.Errorf("CheckForm() authorised = %v, want %v", report.Authorised, tt.authorised)
+			}
+
+			var (
+				reasons = make(map[string]Reason)
+				files   = make(map[string][]Reason)
+			)
+
+			for name, field := range report.Fields {
+				reasons[name] = field.Reason
+				files[name] = []Reason{}
+				for _, verdict := range field.Files {
+					files[name] = append(files[name], verdict.Reason)
+				}
+			}
+
+			if !reflect.DeepEqual(reasons, tt.reasons) {
+				t.Errorf("CheckForm() reasons = %v, want %v", reasons, tt.reasons)
+			}
+			if !reflect.DeepEqual(files, tt.files) {
+				t.Errorf("CheckForm() files = %v, want %v", files, tt.files)
+			}
+		})
+	}
+}
+
+func TestFormReport_Rejected(t *testing.T) {
+	report := CheckForm(testForm(t,
+		formFile{"b", "b.gif", testGIF(t, 1)},
+		formFile{"a", "a.gif", testGIF(t, 1)},
+		formFile{"c", "c.png", testPNG(t)},
+	), map[string]Policy{"c": {}})
+
+	if got, want := report.Rejected(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Rejected() = %v, want %v", got, want)
+	}
+
+	// files are reported in the order of the form
+	report = CheckForm(testForm(t,
+		formFile{"files", "1.png", testPNG(t)},
+		formFile{"files", "2.gif", testGIF(t, 1)},
+	), map[string]Policy{"files": {}})
+
+	if got := report.Fields["files"].Files; got[0].Filename != "1.png" || got[1].Filename != "2.gif" || report.Fields["files"].TotalSize == 0 {
+		t.Errorf("CheckForm() files = %+v", got)
+	}
+}
@@ -0,0 +1,398 @@
+package filechecker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const (
+	// bytes per pixel once decoded (RGBA), used to estimate decoded sizes
+	decodedBytesPerPixel = 4
+
+	// maximum number of TIFF pages (IFDs) walked through
+	maxTIFFPages = 65536
+)
+
+// FrameLimit limits animated and multi-frame images. Zero values mean no limit.
+type FrameLimit struct {
+	// maximum number of frames (or pages)
+	MaxFrames int `json:"max_frames,omitempty"`
+
+	// whether animated images are authorised
+	AllowAnimated bool `json:"allow_animated"`
+
+	// maximum size, in bytes, of all frames once decoded
+	MaxDecodedSize int64 `json:"max_decoded_size,omitempty"`
+}
+
+// FrameInfo describes the frames of an image.
+type FrameInfo struct {
+	// number of frames (or pages)
+	Frames int `json:"frames"`
+
+	// whether the image is animated (as opposed to multi-page)
+	Animated bool `json:"animated"`
+
+	// size of the canvas (or of the largest page)
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// estimated size, in bytes, of all frames once decoded
+	DecodedSize int64 `json:"decoded_size"`
+}
+
+// checkFrames is a private method. Counts the frames of the image and
+// verifies them against the limit.
+func (fc *FileChecker) checkFrames(verdict *Verdict, limit FrameLimit, r io.ReaderAt) *Verdict {
+	info, ok := countFrames(verdict.Extension, r, verdict.Size)
+	if !ok {
+		return verdict.reject(ReasonMalformed, nil)
+	}
+	verdict.Frames = info
+
+	if info.Animated && !limit.AllowAnimated {
+		return verdict.reject(ReasonAnimated, nil)
+	}
+
+	if limit.MaxFrames > 0 && info.Frames > limit.MaxFrames {
+		return verdict.reject(ReasonTooManyFrames, nil)
+	}
+
+	if limit.MaxDecodedSize > 0 && info.DecodedSize > limit.MaxDecodedSize {
+		return verdict.reject(ReasonDecodedTooLarge, nil)
+	}
+
+	return verdict
+}
+
+// countFrames counts the frames of GIF, WebP, (A)PNG and TIFF images, reading
+// only their headers. Other images are made of one frame.
+func countFrames(ext string, r io.ReaderAt, size int64) (*FrameInfo, bool) {
+	var (
+		info *FrameInfo
+		ok   bool
+	)
+
+	switch ext {
+	case ExtImgGIF:
+		info, ok = gifFrames(r, size)
+	case ExtImgWEBP:
+		info, ok = webpFrames(r, size)
+	case ExtImgPNG, ExtImgAPNG:
+		info, ok = pngFrames(r, size)
+	case ExtImgTIF:
+		info, ok = tiffFrames(r, size)
+	default:
+		return &FrameInfo{Frames: 1}, true
+	}
+
+	if !ok {
+		return nil, false
+	}
+	if info.DecodedSize == 0 {
+		info.DecodedSize = saturatedProduct(int64(info.Frames), int64(info.Width), int64(info.Height), decodedBytesPerPixel)
+	}
+	return info, true
+}
+
+// gifFrames counts image descriptors, skipping colour tables, extensions and
+// image data.
+func gifFrames(r io.ReaderAt, size int64) (*FrameInfo, bool) {
+	var (
+		info   = &FrameInfo{}
+		header = make([]byte, 13)
+		br     = bufio.NewReader(io.NewSectionReader(r, 0, size))
+	)
+
+	if _, err := io.ReadFull(br, header); err != nil || !bytes.HasPrefix(header, []byte("GIF8")) {
+		return nil, false
+	}
+	info.Width = int(binary.LittleEndian.Uint16(header[6:]))
+	info.Height = int(binary.LittleEndian.Uint16(header[8:]))
+
+	// global colour table
+	if header[10]&0x80 != 0 {
+		if _, err := br.Discard(3 << (header[10]&0x07 + 1)); err != nil {
+			return nil, false
+		}
+	}
+
+	for {
+		block, err := br.ReadByte()
+		if err != nil {
+			break
+		}
+
+		switch block {
+		case 0x3B: // trailer
+			info.Animated = info.Frames > 1
+			return info, true
+
+		case 0x21: // extension: label, then sub-blocks
+			if _, err = br.Discard(1); err != nil || !skipGIFSubBlocks(br) {
+				return nil, false
+			}
+
+		case 0x2C: // image descriptor, local colour table, LZW code size, sub-blocks
+			descriptor := make([]byte, 9)
+			if _, err = io.ReadFull(br, descriptor); err != nil {
+				return nil, false
+			}
+			info.Frames++
+			if packed := descriptor[8]; packed&0x80 != 0 {
+				if _, err = br.Discard(3 << (packed&0x07 + 1)); err != nil {
+					return nil, false
+				}
+			}
+			if _, err = br.Discard(1); err != nil || !skipGIFSubBlocks(br) {
+				return nil, false
+			}
+
+		default:
+			return nil, false
+		}
+	}
+
+	// no trailer: count what we've seen, as decoders do
+	info.Animated = info.Frames > 1
+	return info, info.Frames > 0
+}
+
+// skipGIFSubBlocks skips sub-blocks, up to the terminating one, false if they
+// are truncated.
+func skipGIFSubBlocks(br *bufio.Reader) bool {
+	for {
+		size, err := br.ReadByte()
+		if err != nil {
+			return false
+		}
+		if size == 0 {
+			return true
+		}
+		if _, err = br.Discard(int(size)); err != nil {
+			return false
+		}
+	}
+}
+
+// webpFrames reads the canvas size (VP8X) and counts the animation frames
+// (ANMF). Simple (non-extended) WebP files are made of one frame.
+func webpFrames(r io.ReaderAt, size int64) (*FrameInfo, bool) {
+	var (
+		info      = &FrameInfo{}
+		header, _ = readAt(r, 0, 12)
+	)
+
+	if len(header) < 12 || string(header[:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return nil, false
+	}
+
+	for offset := int64(12); offset+8 <= size; {
+		chunkHeader, ok := readAt(r, offset, 8)
+		if !ok {
+			return nil, false
+		}
+
+		var (
+			fourCC = string(chunkHeader[:4])
+			length = int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+			start  = offset + 8
+		)
+		if start+length > size {
+			return nil, false
+		}
+		offset = start + length + length&1
+
+		switch fourCC {
+		case "VP8X":
+			chunk, ok := readAt(r, start, 10)
+			if length < 10 || !ok {
+				return nil, false
+			}
+			info.Animated = chunk[0]&0x02 != 0
+			info.Width = 1 + int(uint32(chunk[4])|uint32(chunk[5])<<8|uint32(chunk[6])<<16)
+			info.Height = 1 + int(uint32(chunk[7])|uint32(chunk[8])<<8|uint32(chunk[9])<<16)
+		case "ANMF":
+			info.Frames++
+		case "VP8 ":
+			// frame tag (3), start code (3), width and height (14 bits each)
+			if chunk, ok := readAt(r, start, 10); length >= 10 && ok && info.Width == 0 {
+				info.Width = int(binary.LittleEndian.Uint16(chunk[6:]) & 0x3FFF)
+				info.Height = int(binary.LittleEndian.Uint16(chunk[8:]) & 0x3FFF)
+			}
+		case "VP8L":
+			// signature (1), width - 1 and height - 1 (14 bits each)
+			if chunk, ok := readAt(r, start, 5); length >= 5 && ok && info.Width == 0 {
+				bits := binary.LittleEndian.Uint32(chunk[1:])
+				info.Width = 1 + int(bits&0x3FFF)
+				info.Height = 1 + int(bits>>14&0x3FFF)
+			}
+		}
+	}
+
+	if info.Frames == 0 {
+		info.Frames = 1
+	}
+	return info, true
+}
+
+// pngFrames reads the image size (IHDR) and the number of frames of animated
+// PNGs (acTL, fcTL).
+func pngFrames(r io.ReaderAt, size int64) (*FrameInfo, bool) {
+	var (
+		info         = &FrameInfo{}
+		declared     int
+		controls     int
+		signature, _ = readAt(r, 0, 8)
+	)
+
+	if !bytes.Equal(signature, pngSignature) {
+		return nil, false
+	}
+
+	for offset := int64(8); offset+12 <= size; {
+		header, ok := readAt(r, offset, 8)
+		if !ok {
+			return nil, false
+		}
+
+		var (
+			length = int64(binary.BigEndian.Uint32(header))
+			typ    = string(header[4:8])
+			start  = offset + 8
+		)
+		if start+length+4 > size {
+			return nil, false
+		}
+		offset = start + length + 4
+
+		switch typ {
+		case "IHDR":
+			chunk, ok := readAt(r, start, 8)
+			if length < 8 || !ok {
+				return nil, false
+			}
+			info.Width = int(binary.BigEndian.Uint32(chunk))
+			info.Height = int(binary.BigEndian.Uint32(chunk[4:]))
+		case "acTL":
+			chunk, ok := readAt(r, start, 8)
+			if length < 8 || !ok {
+				return nil, false
+			}
+			info.Animated = true
+			declared = int(binary.BigEndian.Uint32(chunk))
+		case "fcTL":
+			controls++
+		case "IEND":
+			offset = size
+		}
+	}
+
+	// trust whichever is larger: what is announced or what is there
+	info.Frames = 1
+	if info.Animated {
+		if info.Frames = declared; controls > declared {
+			info.Frames = controls
+		}
+	}
+	return info, info.Width > 0
+}
+
+// tiffFrames walks through the chain of IFDs (one per page), reading the size
+// of each page.
+func tiffFrames(r io.ReaderAt, size int64) (*FrameInfo, bool) {
+	var (
+		order     binary.ByteOrder
+		info      = &FrameInfo{}
+		visited   = make(map[int64]bool)
+		header, _ = readAt(r, 0, 8)
+	)
+
+	if len(header) < 8 {
+		return nil, false
+	}
+
+	switch string(header[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return nil, false
+	}
+
+	for ifd := int64(order.Uint32(header[4:])); ifd != 0; {
+		if visited[ifd] || len(visited) >= maxTIFFPages || ifd+2 > size {
+			return nil, false
+		}
+		visited[ifd] = true
+
+		data, ok := readAt(r, ifd, 2)
+		if !ok {
+			return nil, false
+		}
+
+		// entries, then the offset of the next IFD
+		count := int(order.Uint16(data))
+		if data, ok = readAt(r, ifd+2, count*12+4); !ok {
+			return nil, false
+		}
+
+		var width, height int
+		for n := 0; n < count; n++ {
+			entry := data[n*12:]
+			value := int(order.Uint32(entry[8:]))
+			if order.Uint16(entry[2:]) == exifTypeShort {
+				value = int(order.Uint16(entry[8:]))
+			}
+
+			switch order.Uint16(entry) {
+			case 256: // ImageWidth
+				width = value
+			case 257: // ImageLength
+				height = value
+			}
+		}
+
+		info.Frames++
+		info.DecodedSize = saturatedSum(info.DecodedSize, saturatedProduct(int64(width), int64(height), decodedBytesPerPixel))
+		if saturatedProduct(int64(width), int64(height)) > saturatedProduct(int64(info.Width), int64(info.Height)) {
+			info.Width, info.Height = width, height
+		}
+
+		ifd = int64(order.Uint32(data[count*12:]))
+	}
+
+	return info, info.Frames > 0
+}
+
+// saturatedProduct multiplies the factors, none negative, capping the
+// product at math.MaxInt64 rather than overflowing.
+func saturatedProduct(factors ...int64) int64 {
+	product := int64(1)
+	for _, factor := range factors {
+		switch {
+		case factor < 0:
+			return math.MaxInt64
+		case factor == 0:
+			return 0
+		case product > math.MaxInt64/factor:
+			product = math.MaxInt64
+		default:
+			product *= factor
+		}
+	}
+	return product
+}
+
+// saturatedSum adds the terms, none negative, capping the sum at
+// math.MaxInt64 rather than overflowing.
+func saturatedSum(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
@@ -0,0 +1,312 @@
+package filechecker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func testGIF(t *testing.T, frames int) []byte {
+	var (
+		buf  bytes.Buffer
+		anim = &gif.GIF{}
+	)
+
+	for n := 0; n < frames; n++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 20, 10), palette.Plan9))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testStillPNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 20, 10))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testAPNG(t *testing.T, frames int) []byte {
+	var (
+		buf  bytes.Buffer
+		out  bytes.Buffer
+		actl = make([]byte, 8)
+	)
+
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 20, 10))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(actl, uint32(frames))
+
+	// signature + IHDR, animation control, frame controls, rest of the file
+	out.Write(data[:8+12+13])
+	writePNGChunk(&out, "acTL", actl)
+	for n := 0; n < frames; n++ {
+		writePNGChunk(&out, "fcTL", make([]byte, 26))
+	}
+	out.Write(data[8+12+13:])
+	return out.Bytes()
+}
+
+func testAnimatedWEBP(frames int) []byte {
+	var (
+		out   bytes.Buffer
+		chunk = func(fourCC string, payload []byte) {
+			out.WriteString(fourCC)
+			_ = binary.Write(&out, binary.LittleEndian, uint32(len(payload)))
+			out.Write(payload)
+		}
+	)
+
+	// animation flag, canvas of 20 x 10
+	out.WriteString("RIFF\x00\x00\x00\x00WEBP")
+	chunk("VP8X", []byte{0x02, 0, 0, 0, 19, 0, 0, 9, 0, 0})
+	chunk("ANIM", make([]byte, 6))
+	for n := 0; n < frames; n++ {
+		chunk("ANMF", make([]byte, 16))
+	}
+
+	data := out.Bytes()
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+func testTIFF(pages int) []byte {
+	var (
+		out = []byte{'I', 'I', '*', 0x00, 0x08, 0x00, 0x00, 0x00}
+		u16 = func(v int) { out = append(out, byte(v), byte(v>>8)) }
+		u32 = func(v int) { u16(v); u16(v >> 16) }
+	)
+
+	for n := 0; n < pages; n++ {
+		u16(2)
+		u16(256) // ImageWidth, SHORT
+		u16(3)
+		u32(1)
+		u32(20)
+		u16(257) // ImageLength, LONG
+		u16(4)
+		u32(1)
+		u32(10)
+		if n == pages-1 {
+			u32(0) // no next IFD
+		} else {
+			u32(len(out) + 4) // next IFD right after this one
+		}
+	}
+	return out
+}
+
+// testHugeTIFF is a TIFF of pages of the largest dimensions (LONG values).
+func testHugeTIFF(pages int) []byte {
+	var (
+		out = []byte{'I', 'I', '*', 0x00, 0x08, 0x00, 0x00, 0x00}
+		u16 = func(v int) { out = append(out, byte(v), byte(v>>8)) }
+		u32 = func(v uint32) { u16(int(v)); u16(int(v >> 16)) }
+	)
+
+	for n := 0; n < pages; n++ {
+		u16(2)
+		u16(256) // ImageWidth, LONG
+		u16(4)
+		u32(1)
+		u32(math.MaxUint32)
+		u16(257) // ImageLength, LONG
+		u16(4)
+		u32(1)
+		u32(math.MaxUint32)
+		if n == pages-1 {
+			u32(0)
+		} else {
+			u32(uint32(len(out) + 4))
+		}
+	}
+	return out
+}
+
+//nolint:funlen
+func TestFileChecker_Check_Frames(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		limit    FrameLimit
+		reason   Reason
+		frames   int
+		animated bool
+	}{
+		{
+			name:     "GIF-still",
+			filename: "still.gif",
+			data:     testGIF(t, 1),
+			frames:   1,
+		},
+		{
+			name:     "GIF-animated-unauthorised",
+			filename: "anim.gif",
+			data:     testGIF(t, 3),
+			reason:   ReasonAnimated,
+			frames:   3,
+			animated: true,
+		},
+		{
+			name:     "GIF-animated",
+			filename: "anim.gif",
+			data:     testGIF(t, 3),
+			limit:    FrameLimit{AllowAnimated: true, MaxFrames: 3},
+			frames:   3,
+			animated: true,
+		},
+		{
+			name:     "GIF-too-many-frames",
+			filename: "anim.gif",
+			data:     testGIF(t, 4),
+			limit:    FrameLimit{AllowAnimated: true, MaxFrames: 3},
+			reason:   ReasonTooManyFrames,
+			frames:   4,
+			animated: true,
+		},
+		{
+			name:     "GIF-decoded-too-large",
+			filename: "anim.gif",
+			data:     testGIF(t, 4),
+			limit:    FrameLimit{AllowAnimated: true, MaxDecodedSize: 3 * 20 * 10 * 4},
+			reason:   ReasonDecodedTooLarge,
+			frames:   4,
+			animated: true,
+		},
+		{
+			name:     "APNG",
+			filename: "anim.png",
+			data:     testAPNG(t, 5),
+			limit:    FrameLimit{AllowAnimated: true, MaxFrames: 4},
+			reason:   ReasonTooManyFrames,
+			frames:   5,
+			animated: true,
+		},
+		{
+			name:     "PNG",
+			filename: "still.png",
+			data:     testStillPNG(t),
+			frames:   1,
+		},
+		{
+			name:     "WEBP-animated",
+			filename: "anim.webp",
+			data:     testAnimatedWEBP(2),
+			reason:   ReasonAnimated,
+			frames:   2,
+			animated: true,
+		},
+		{
+			name:     "TIFF-multi-page",
+			filename: "scan.tif",
+			data:     testTIFF(3),
+			limit:    FrameLimit{MaxFrames: 2},
+			reason:   ReasonTooManyFrames,
+			frames:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mpFileHeader, err := getMultipartFileHeaderFromBytes(tt.filename, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fc := GetFileChecker(mpFileHeader)
+			fc.SetExtensions([]string{ExtImgGIF, ExtImgWEBP, ExtImgTIF, ExtImgAPNG})
+			fc.SetPolicy(Policy{
+				Frames: map[string]FrameLimit{
+					ExtImgGIF:  tt.limit,
+					ExtImgPNG:  tt.limit,
+					ExtImgAPNG: tt.limit,
+					ExtImgWEBP: tt.limit,
+					ExtImgTIF:  tt.limit,
+				},
+			})
+
+			got := fc.Check()
+			if got.Reason != tt.reason || got.Authorised != (tt.reason == ReasonNone) {
+				t.Errorf("Check() = %v (%s), want %s", got.Authorised, got.Reason, tt.reason)
+			}
+			if got.Frames == nil || got.Frames.Frames != tt.frames || got.Frames.Animated != tt.animated {
+				t.Fatalf("Check() frames = %+v, want %d (animated: %v)", got.Frames, tt.frames, tt.animated)
+			}
+			if got.Frames.Width != 20 || got.Frames.Height != 10 {
+				t.Errorf("Check() size = %dx%d, want 20x10", got.Frames.Width, got.Frames.Height)
+			}
+		})
+	}
+}
+
+func TestFileChecker_Check_FramesHuge(t *testing.T) {
+	// PNG of the largest dimensions (2^31-1), in its IHDR
+	png := testStillPNG(t)
+	binary.BigEndian.PutUint32(png[16:], math.MaxInt32)
+	binary.BigEndian.PutUint32(png[20:], math.MaxInt32)
+
+	for name, file := range map[string][]byte{"huge.png": png, "huge.tif": testHugeTIFF(3)} {
+		t.Run(name, func(t *testing.T) {
+			mpFileHeader, err := getMultipartFileHeaderFromBytes(name, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fc := GetFileChecker(mpFileHeader)
+			fc.SetExtensions([]string{ExtImgTIF})
+			fc.SetPolicy(Policy{Frames: map[string]FrameLimit{
+				ExtImgPNG: {MaxDecodedSize: 100 << 20},
+				ExtImgTIF: {MaxDecodedSize: 100 << 20},
+			}})
+
+			// the decoded size saturates rather than overflowing
+			got := fc.Check()
+			if got.Reason != ReasonDecodedTooLarge || got.Frames == nil || got.Frames.DecodedSize != math.MaxInt64 {
+				t.Errorf("Check() = %s, frames %+v, want %s", got.Reason, got.Frames, ReasonDecodedTooLarge)
+			}
+		})
+	}
+}
+
+func TestFileChecker_Check_FramesAPNGAsPNG(t *testing.T) {
+	mpFileHeader, err := getMultipartFileHeaderFromBytes("anim.png", testAPNG(t, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// animated PNGs without a limit of their own are limited as PNGs
+	fc := GetFileChecker(mpFileHeader)
+	fc.SetPolicy(Policy{Frames: map[string]FrameLimit{ExtImgPNG: {MaxFrames: 3, AllowAnimated: true}}})
+
+	if got := fc.Check(); got.Reason != ReasonTooManyFrames {
+		t.Errorf("Check() = %s, want %s", got.Reason, ReasonTooManyFrames)
+	}
+}
+
+func TestFileChecker_Check_FramesNotInspected(t *testing.T) {
+	mpFileHeader, err := getMultipartFileHeaderFromBytes("anim.gif", testGIF(t, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no limit for GIF in the policy
+	fc := GetFileChecker(mpFileHeader)
+	fc.SetExtensions([]string{ExtImgGIF})
+
+	if got := fc.Check(); !got.Authorised || got.Frames != nil {
+		t.Errorf("Check() = %+v, want authorised and frames not inspected", got)
+	}
+}
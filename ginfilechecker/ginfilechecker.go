@@ -0,0 +1,73 @@
+// Package ginfilechecker adapts filechecker to Gin: a middleware checking
+// multipart uploads, and the filecheck binding tag.
+package ginfilechecker
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/validation"
+)
+
+// ReportKey is the key of the form report in the Gin context.
+const ReportKey = "filechecker.report"
+
+// ErrValidatorEngine is returned when Gin's validator is not go-playground's.
+var ErrValidatorEngine = errors.New("ginfilechecker: binding validator is not go-playground/validator")
+
+// Middleware checks the files of multipart requests before the next
+// handlers. Rejected uploads are aborted with a problem+json error;
+// authorised ones go on with the report in the context (see Report).
+func Middleware(options filechecker.MiddlewareOptions) gin.HandlerFunc {
+	middleware := filechecker.Middleware(options)
+
+	return func(c *gin.Context) {
+		var reached bool
+
+		middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			reached = true
+			c.Request = r
+			if report, ok := filechecker.ReportFromContext(r.Context()); ok {
+				c.Set(ReportKey, report)
+			}
+			c.Next()
+		})).ServeHTTP(c.Writer, c.Request)
+
+		if !reached {
+			c.Abort()
+		}
+	}
+}
+
+// Report returns the report of the files of the request, as stored by the
+// middleware.
+func Report(c *gin.Context) (*filechecker.FormReport, bool) {
+	value, found := c.Get(ReportKey)
+	if !found {
+		return nil, false
+	}
+
+	report, ok := value.(*filechecker.FormReport)
+	return report, ok
+}
+
+// RegisterBinding registers the filecheck tag on Gin's binding validator,
+// e.g. `form:"avatar" binding:"required,filecheck=images"`, checking files
+// against the policies of the given profiles, and the file tags (see
+// validation.RegisterTags).
+func RegisterBinding(profiles map[string]filechecker.Policy) error {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return ErrValidatorEngine
+	}
+
+	if err := validation.RegisterTags(engine); err != nil {
+		return err
+	}
+	return validation.Register(engine, profiles)
+}
@@ -0,0 +1,104 @@
+package ginfilechecker
+
+import (
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/internal/fctest"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   fctest.File
+		status int
+		reason filechecker.Reason
+	}{
+		{name: "authorised", file: fctest.File{Field: "avatar", Filename: "me.png", Data: fctest.PNG(t)}, status: http.StatusOK},
+		{name: "rejected", file: fctest.File{Field: "avatar", Filename: "me.gif", Data: fctest.GIF(t)}, status: http.StatusUnprocessableEntity, reason: filechecker.ReasonExtensionNotAuthorised},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w      = httptest.NewRecorder()
+				router = gin.New()
+			)
+
+			router.POST("/upload", Middleware(filechecker.MiddlewareOptions{}), func(c *gin.Context) {
+				report, ok := Report(c)
+				if !ok || !report.Authorised {
+					t.Errorf("Report() = %+v, %v", report, ok)
+				}
+				c.Status(http.StatusOK)
+			})
+			router.ServeHTTP(w, fctest.Request(t, "/upload", tt.file))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+
+			var problem filechecker.Problem
+			if err := json.NewDecoder(w.Body).Decode(&problem); err != nil || problem.Reason != tt.reason {
+				t.Errorf("problem = %+v, %v, want %s", problem, err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRegisterBinding(t *testing.T) {
+	type upload struct {
+		Avatar *multipart.FileHeader `form:"avatar" binding:"required,filecheck=images"`
+	}
+
+	err := RegisterBinding(map[string]filechecker.Policy{"images": {SetExtensions: []string{filechecker.ExtImgGIF}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		file   fctest.File
+		status int
+	}{
+		{name: "authorised", file: fctest.File{Field: "avatar", Filename: "me.gif", Data: fctest.GIF(t)}, status: http.StatusOK},
+		{name: "rejected", file: fctest.File{Field: "avatar", Filename: "me.txt", Data: []byte("hello")}, status: http.StatusBadRequest},
+		{name: "missing", file: fctest.File{Field: "other", Filename: "me.png", Data: fctest.PNG(t)}, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				w      = httptest.NewRecorder()
+				router = gin.New()
+			)
+
+			router.POST("/upload", func(c *gin.Context) {
+				var form upload
+				if err := c.ShouldBind(&form); err != nil {
+					c.String(http.StatusBadRequest, err.Error())
+					return
+				}
+				c.Status(http.StatusOK)
+			})
+			router.ServeHTTP(w, fctest.Request(t, "/upload", tt.file))
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d (%s), want %d", w.Code, w.Body, tt.status)
+			}
+		})
+	}
+}
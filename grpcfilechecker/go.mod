@@ -0,0 +1,18 @@
+module github.com/nadimattari/filechecker/grpcfilechecker
+
+go 1.19
+
+require (
+	github.com/nadimattari/filechecker v1.0.0
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230711160842-782d3b101e98
+	google.golang.org/grpc v1.58.3
+	google.golang.org/protobuf v1.34.1
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/h2non/filetype v1.1.3 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
+)
@@ -0,0 +1,257 @@
+// Package grpcfilechecker adapts filechecker to gRPC: a stream server
+// interceptor checking the files uploaded in chunks by client streams.
+package grpcfilechecker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/nadimattari/filechecker"
+)
+
+const (
+	// ErrorDomain is the domain of the error info of rejections.
+	ErrorDomain = "filechecker"
+
+	// bytes checked when the policy does not tell (see Policy.SniffWindow)
+	defaultHeadSize = 4096
+)
+
+// Upload tells how the messages of a client-streaming method carry a file,
+// and the policy it is checked against.
+type Upload struct {
+	// name of the bytes field carrying the chunks of the file
+	Field string
+
+	// name of the string field carrying the filename, if any. The first
+	// non-empty one is used.
+	FilenameField string
+
+	// policy the file is checked against. Checks needing the whole file
+	// (Frames, Media, hashes and their lists, scanners, quarantine) only
+	// apply to files that fit in the head (see StreamServerInterceptor).
+	Policy filechecker.Policy
+}
+
+// contextKey is the type of the keys of the values stored in contexts.
+type contextKey int
+
+const verdictKey contextKey = iota
+
+// serverStream checks the file carried by the messages it receives.
+type serverStream struct {
+	grpc.ServerStream
+
+	upload Upload
+	ctx    context.Context
+
+	// verdict on the head of the file, once checked
+	verdict *filechecker.Verdict
+
+	// messages read ahead, replayed to the handler
+	queue []proto.Message
+
+	filename string
+	size     int64
+	eof      bool
+
+	// status of the rejection, if any
+	err error
+}
+
+// StreamServerInterceptor checks the files uploaded through the given
+// methods (by full method name, e.g. "/photos.Photos/Upload").
+//
+// The messages carrying the head of the file (the sniff window of the
+// policy, 4 KiB by default) are read ahead and checked before the handler
+// receives any of them; the size of the whole file is checked as the
+// chunks go through. Rejected uploads end with codes.InvalidArgument and
+// an errdetails.ErrorInfo telling the reason, whatever the handler returns.
+func StreamServerInterceptor(uploads map[string]Upload) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		upload, found := uploads[info.FullMethod]
+		if !found || !info.IsClientStream {
+			return handler(srv, ss)
+		}
+
+		stream := &serverStream{ServerStream: ss, upload: upload}
+		stream.ctx = context.WithValue(ss.Context(), verdictKey, stream)
+
+		err := handler(srv, stream)
+		if stream.err != nil {
+			return stream.err
+		}
+		return err
+	}
+}
+
+// Verdict returns the verdict on the file of the stream, once its head has
+// been received and checked.
+func Verdict(ctx context.Context) (*filechecker.Verdict, bool) {
+	stream, ok := ctx.Value(verdictKey).(*serverStream)
+	if !ok || stream.verdict == nil {
+		return nil, false
+	}
+	return stream.verdict, true
+}
+
+// Context returns the context of the stream, holding the verdict.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// RecvMsg receives the next message, the head of the file being checked
+// first.
+func (s *serverStream) RecvMsg(m interface{}) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	message, ok := m.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "grpcfilechecker: %T is not a protobuf message", m)
+	}
+
+	if s.verdict == nil {
+		if err := s.check(message); err != nil {
+			return err
+		}
+	}
+
+	// messages read ahead first
+	if len(s.queue) > 0 {
+		proto.Reset(message)
+		proto.Merge(message, s.queue[0])
+		s.queue = s.queue[1:]
+		return nil
+	}
+	if s.eof {
+		return io.EOF
+	}
+
+	if err := s.ServerStream.RecvMsg(message); err != nil {
+		return err
+	}
+	if _, err := s.chunk(message); err != nil {
+		return err
+	}
+	return s.err
+}
+
+// check reads ahead the messages carrying the head of the file, and checks
+// it against the policy.
+func (s *serverStream) check(message proto.Message) error {
+	var (
+		err    error
+		chunk  []byte
+		head   []byte
+		window = defaultHeadSize
+		policy = s.upload.Policy
+	)
+
+	if policy.SniffWindow > 0 {
+		window = policy.SniffWindow
+	}
+
+	for len(head) < window {
+		next := message.ProtoReflect().New().Interface()
+		if err = s.ServerStream.RecvMsg(next); err == io.EOF {
+			s.eof = true
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if chunk, err = s.chunk(next); err != nil {
+			return err
+		}
+		if s.err != nil {
+			return s.err
+		}
+
+		s.queue = append(s.queue, next)
+		head = append(head, chunk...)
+	}
+
+	// the whole file is not at hand: checks of the head alone would be
+	// wrong (frames, media, digests) or partial (scanners, quarantine)
+	if !s.eof {
+		policy.Frames, policy.Media = nil, nil
+		policy.Hashes, policy.DenyList, policy.AllowList = false, nil, nil
+		policy.Scanners, policy.Pipeline = nil, nil
+		policy.Quarantine = nil
+	}
+
+	file, err := filechecker.NewFileHeader(s.filename, head)
+	if err != nil {
+		return status.Errorf(codes.Internal, "grpcfilechecker: %v", err)
+	}
+
+	fc := filechecker.GetFileChecker(file)
+	fc.SetPolicy(policy)
+
+	if s.verdict = fc.Check(); !s.verdict.Authorised {
+		s.reject(s.verdict)
+		return s.err
+	}
+	return nil
+}
+
+// chunk returns the chunk of the file carried by the message, keeping the
+// filename and size of the file, and rejects files larger than the policy
+// authorises.
+func (s *serverStream) chunk(message proto.Message) ([]byte, error) {
+	var (
+		reflected = message.ProtoReflect()
+		fields    = reflected.Descriptor().Fields()
+		field     = fields.ByName(protoreflect.Name(s.upload.Field))
+	)
+
+	if field == nil || field.Kind() != protoreflect.BytesKind || field.IsList() {
+		return nil, status.Errorf(codes.Internal, "grpcfilechecker: %s has no bytes field %q", reflected.Descriptor().FullName(), s.upload.Field)
+	}
+
+	if s.filename == "" && s.upload.FilenameField != "" {
+		if name := fields.ByName(protoreflect.Name(s.upload.FilenameField)); name != nil && name.Kind() == protoreflect.StringKind {
+			s.filename = reflected.Get(name).String()
+		}
+	}
+
+	chunk := reflected.Get(field).Bytes()
+	s.size += int64(len(chunk))
+
+	// larger than authorised
+	if limit := s.upload.Policy.MaxFileSize; limit > 0 && s.size > limit {
+		s.reject(&filechecker.Verdict{Reason: filechecker.ReasonTooLarge, Filename: s.filename, Size: s.size})
+	}
+	return chunk, nil
+}
+
+// reject ends the stream with the status telling why the file was rejected.
+func (s *serverStream) reject(verdict *filechecker.Verdict) {
+	info := &errdetails.ErrorInfo{
+		Reason: string(verdict.Reason),
+		Domain: ErrorDomain,
+		Metadata: map[string]string{
+			"filename":  verdict.Filename,
+			"size":      strconv.FormatInt(verdict.Size, 10),
+			"extension": verdict.Extension,
+			"mime":      verdict.MIME,
+		},
+	}
+
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("file rejected: %s", verdict.Reason))
+	if detailed, err := st.WithDetails(info); err == nil {
+		st = detailed
+	}
+	s.err = st.Err()
+}
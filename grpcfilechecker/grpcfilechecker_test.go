@@ -0,0 +1,235 @@
+package grpcfilechecker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/internal/fctest"
+)
+
+const uploadMethod = "/test.Uploader/Upload"
+
+// uploader receives files in chunks carried by the value of Any messages,
+// the type URL carrying the filename.
+var uploader = grpc.ServiceDesc{
+	ServiceName: "test.Uploader",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Upload",
+		ClientStreams: true,
+		Handler: func(_ interface{}, stream grpc.ServerStream) error {
+			var received []byte
+
+			for {
+				chunk := new(anypb.Any)
+				if err := stream.RecvMsg(chunk); err == io.EOF {
+					break
+				} else if err != nil {
+					return err
+				}
+				received = append(received, chunk.Value...)
+			}
+
+			if verdict, ok := Verdict(stream.Context()); !ok || !verdict.Authorised {
+				return status.Error(codes.Internal, "no verdict")
+			}
+			if len(received) == 0 {
+				return status.Error(codes.Internal, "nothing received")
+			}
+			return stream.SendMsg(&emptypb.Empty{})
+		},
+	}},
+}
+
+// testClient returns a connection to a server checking the uploads.
+func testClient(t *testing.T, uploads map[string]Upload) *grpc.ClientConn {
+	var (
+		listener = bufconn.Listen(1 << 20)
+		server   = grpc.NewServer(grpc.StreamInterceptor(StreamServerInterceptor(uploads)))
+	)
+
+	server.RegisterService(&uploader, nil)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// upload sends the data in chunks of the given size.
+func upload(conn *grpc.ClientConn, filename string, data []byte, size int) error {
+	stream, err := conn.NewStream(context.Background(), &uploader.Streams[0], uploadMethod)
+	if err != nil {
+		return err
+	}
+
+	for len(data) > 0 {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		if err = stream.SendMsg(&anypb.Any{TypeUrl: filename, Value: data[:n]}); err != nil {
+			break
+		}
+		filename, data = "", data[n:]
+	}
+
+	if err = stream.CloseSend(); err != nil {
+		return err
+	}
+	return stream.RecvMsg(new(emptypb.Empty))
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	var (
+		png   = fctest.PNG(t)
+		gif   = fctest.GIF(t)
+		conn  = testClient(t, map[string]Upload{uploadMethod: {Field: "value", FilenameField: "type_url", Policy: filechecker.Policy{MaxFileSize: 1 << 10}}})
+		large = append(append([]byte{}, png...), make([]byte, 2<<10)...)
+	)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		size   int
+		reason filechecker.Reason
+	}{
+		{name: "authorised", data: png, size: 64},
+		{name: "authorised-one-chunk", data: png, size: 1 << 10},
+		{name: "authorised-byte-chunks", data: png, size: 1},
+		{name: "type", data: gif, size: 16, reason: filechecker.ReasonExtensionNotAuthorised},
+		{name: "too-large", data: large, size: 512, reason: filechecker.ReasonTooLarge},
+		{name: "html", data: []byte("<html><script>alert(1)</script>"), size: 8, reason: filechecker.ReasonHTML},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := upload(conn, "me.png", tt.data, tt.size)
+			if tt.reason == "" {
+				if err != nil {
+					t.Errorf("upload() = %v, want nil", err)
+				}
+				return
+			}
+
+			st := status.Convert(err)
+			if st.Code() != codes.InvalidArgument {
+				t.Fatalf("upload() = %v, want %s", err, codes.InvalidArgument)
+			}
+
+			var info *errdetails.ErrorInfo
+			for _, detail := range st.Details() {
+				if i, ok := detail.(*errdetails.ErrorInfo); ok {
+					info = i
+				}
+			}
+			if info == nil || info.Reason != string(tt.reason) || info.Domain != ErrorDomain {
+				t.Errorf("details = %v, want %s", st.Details(), tt.reason)
+			} else if info.Metadata["filename"] != "me.png" {
+				t.Errorf("filename = %q, want me.png", info.Metadata["filename"])
+			}
+		})
+	}
+}
+
+// detector detects something in every file.
+type detector struct{}
+
+func (detector) Name() string { return "detector" }
+
+func (detector) Scan(context.Context, io.ReaderAt, int64) (*filechecker.ScanResult, error) {
+	return &filechecker.ScanResult{Detected: true, Signature: "Test"}, nil
+}
+
+func TestStreamServerInterceptor_WholeFile(t *testing.T) {
+	var (
+		png   = fctest.PNG(t)
+		large = append(append([]byte{}, png...), make([]byte, 8<<10)...)
+
+		// digests of the small file, and of the head of the large one (the
+		// 4 KiB read ahead, in chunks of 1 KiB)
+		file = sha256.Sum256(png)
+		head = sha256.Sum256(large[:4<<10])
+	)
+
+	denied, err := filechecker.NewHashList(hex.EncodeToString(file[:]), hex.EncodeToString(head[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		policy filechecker.Policy
+		data   []byte
+		reason filechecker.Reason
+	}{
+		{name: "scanned", policy: filechecker.Policy{Scanners: []filechecker.Scanner{detector{}}}, data: png, reason: filechecker.ReasonMalware},
+		{name: "scanners-need-the-whole-file", policy: filechecker.Policy{Scanners: []filechecker.Scanner{detector{}}}, data: large},
+		{name: "denied", policy: filechecker.Policy{DenyList: denied}, data: png, reason: filechecker.ReasonHashDenied},
+		{name: "hashes-need-the-whole-file", policy: filechecker.Policy{DenyList: denied, Hashes: true}, data: large},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := testClient(t, map[string]Upload{uploadMethod: {Field: "value", FilenameField: "type_url", Policy: tt.policy}})
+
+			err := upload(conn, "me.png", tt.data, 1<<10)
+			if tt.reason == "" {
+				if err != nil {
+					t.Errorf("upload() = %v, want nil", err)
+				}
+				return
+			}
+
+			var reason string
+			for _, detail := range status.Convert(err).Details() {
+				if info, ok := detail.(*errdetails.ErrorInfo); ok {
+					reason = info.Reason
+				}
+			}
+			if reason != string(tt.reason) {
+				t.Errorf("upload() = %v, want %s", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor_Field(t *testing.T) {
+	conn := testClient(t, map[string]Upload{uploadMethod: {Field: "chunk"}})
+
+	err := upload(conn, "me.png", fctest.PNG(t), 64)
+	if status.Code(err) != codes.Internal {
+		t.Errorf("upload() = %v, want %s", err, codes.Internal)
+	}
+}
+
+func TestStreamServerInterceptor_Unchecked(t *testing.T) {
+	conn := testClient(t, nil)
+
+	// no verdict, as the method is not checked
+	err := upload(conn, "me.gif", fctest.GIF(t), 64)
+	if st := status.Convert(err); st.Code() != codes.Internal || st.Message() != "no verdict" {
+		t.Errorf("upload() = %v, want no verdict", err)
+	}
+}
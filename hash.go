@@ -0,0 +1,161 @@
+package filechecker
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// Hashes are the digests of a file, hex-encoded, e.g. for deduplication.
+type Hashes struct {
+	SHA256 string `json:"sha256"`
+	SHA1   string `json:"sha1"`
+	MD5    string `json:"md5"`
+}
+
+// HashList is a set of digests (SHA-256, SHA-1 or MD5) of files, e.g. of
+// known-malicious files (see Policy.DenyList) or of approved ones (see
+// Policy.AllowList).
+type HashList struct {
+	hashes map[string]bool
+}
+
+// NewHashList returns a list of the digests, hex-encoded.
+func NewHashList(hashes ...string) (*HashList, error) {
+	list := &HashList{hashes: make(map[string]bool, len(hashes))}
+	for _, hash := range hashes {
+		if err := list.Add(hash); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// LoadHashList loads a list from a file (see ReadHashList).
+func LoadHashList(name string) (*HashList, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	list, err := ReadHashList(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return list, nil
+}
+
+// ReadHashList reads a list: a digest per line, possibly followed by other
+// fields (as output by sha256sum), blank lines and lines starting with #
+// being ignored.
+func ReadHashList(r io.Reader) (*HashList, error) {
+	var (
+		list    = &HashList{hashes: make(map[string]bool)}
+		scanner = bufio.NewScanner(r)
+	)
+
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if err := list.Add(fields[0]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return list, scanner.Err()
+}
+
+// Add adds a digest, hex-encoded, to the list.
+func (l *HashList) Add(hash string) error {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+
+	switch _, err := hex.DecodeString(hash); {
+	case err != nil:
+		return fmt.Errorf("invalid hash %q", hash)
+	case len(hash) != 2*sha256.Size && len(hash) != 2*sha1.Size && len(hash) != 2*md5.Size:
+		return fmt.Errorf("invalid hash %q: not a SHA-256, SHA-1 or MD5 digest", hash)
+	}
+
+	if l.hashes == nil {
+		l.hashes = make(map[string]bool)
+	}
+	l.hashes[hash] = true
+	return nil
+}
+
+// Contains tells whether any of the digests is in the list.
+func (l *HashList) Contains(hashes *Hashes) bool {
+	if l == nil || hashes == nil {
+		return false
+	}
+	return l.hashes[hashes.SHA256] || l.hashes[hashes.SHA1] || l.hashes[hashes.MD5]
+}
+
+// Len returns the number of digests in the list.
+func (l *HashList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.hashes)
+}
+
+// hasher computes the digests of what is written to it.
+type hasher struct {
+	sha256, sha1, md5 hash.Hash
+	io.Writer
+}
+
+func newHasher() *hasher {
+	h := &hasher{sha256: sha256.New(), sha1: sha1.New(), md5: md5.New()}
+	h.Writer = io.MultiWriter(h.sha256, h.sha1, h.md5)
+	return h
+}
+
+// Hashes returns the digests of what was written.
+func (h *hasher) Hashes() *Hashes {
+	return &Hashes{
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+		SHA1:   hex.EncodeToString(h.sha1.Sum(nil)),
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+	}
+}
+
+// computeHashes computes the digests of the file, reading it once.
+func computeHashes(r io.ReaderAt, size int64) (*Hashes, error) {
+	h := newHasher()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+		return nil, err
+	}
+	return h.Hashes(), nil
+}
+
+// hash is a private method. Computes the digests of the file when the policy
+// asks for them or has lists: files of the deny list are rejected
+// (ReasonHashDenied), those of the allow list are marked as such.
+func (fc *FileChecker) hash(verdict *Verdict, r io.ReaderAt) *Verdict {
+	var err error
+
+	if !fc.policy.Hashes && fc.policy.DenyList.Len() == 0 && fc.policy.AllowList.Len() == 0 {
+		return verdict
+	}
+
+	if verdict.Hashes, err = computeHashes(r, verdict.Size); err != nil {
+		return verdict.reject(ReasonUnreadable, err)
+	}
+
+	if fc.policy.DenyList.Contains(verdict.Hashes) {
+		return verdict.reject(ReasonHashDenied, nil)
+	}
+	verdict.Allowlisted = fc.policy.AllowList.Contains(verdict.Hashes)
+
+	return verdict
+}
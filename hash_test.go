@@ -0,0 +1,132 @@
+package filechecker
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testHashes returns the digests of the file at the path.
+func testHashes(t *testing.T, path string) *Hashes {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		sha256Sum = sha256.Sum256(data)
+		sha1Sum   = sha1.Sum(data)
+		md5Sum    = md5.Sum(data)
+	)
+	return &Hashes{SHA256: hex.EncodeToString(sha256Sum[:]), SHA1: hex.EncodeToString(sha1Sum[:]), MD5: hex.EncodeToString(md5Sum[:])}
+}
+
+func TestReadHashList(t *testing.T) {
+	hashes := testHashes(t, pngPath)
+
+	tests := []struct {
+		name  string
+		input string
+		len   int
+		err   bool
+	}{
+		{name: "empty", input: ""},
+		{name: "digests", input: hashes.SHA256 + "\n" + strings.ToUpper(hashes.SHA1) + "\n" + hashes.MD5 + "\n", len: 3},
+		{name: "sha256sum", input: "# known files\n\n" + hashes.SHA256 + "  nadim.png\n", len: 1},
+		{name: "duplicates", input: hashes.MD5 + "\n" + hashes.MD5 + "\n", len: 1},
+		{name: "not-hex", input: "zz" + hashes.MD5[2:] + "\n", err: true},
+		{name: "bad-length", input: hashes.MD5[2:] + "\n", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := ReadHashList(strings.NewReader(tt.input))
+			if (err != nil) != tt.err {
+				t.Fatalf("ReadHashList() = %v, want error %v", err, tt.err)
+			}
+			if err == nil && list.Len() != tt.len {
+				t.Errorf("Len() = %d, want %d", list.Len(), tt.len)
+			}
+		})
+	}
+}
+
+func TestLoadHashList(t *testing.T) {
+	var (
+		hashes = testHashes(t, jpgPath)
+		name   = filepath.Join(t.TempDir(), "list.txt")
+	)
+
+	if err := os.WriteFile(name, []byte(hashes.SHA1+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadHashList(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !list.Contains(hashes) || list.Contains(testHashes(t, pngPath)) {
+		t.Errorf("Contains() does not match %s only", jpgPath)
+	}
+
+	if _, err = LoadHashList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadHashList() = nil, want error")
+	}
+}
+
+func TestFileChecker_Check_Hashes(t *testing.T) {
+	var (
+		pngHashes = testHashes(t, pngPath)
+		scanner   = &testScanner{name: "a", signature: []byte("IEND")}
+	)
+
+	deny, err := NewHashList(pngHashes.MD5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allow, err := NewHashList(pngHashes.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewHashList(testHashes(t, jpgPath).SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		policy      Policy
+		reason      Reason
+		hashes      bool
+		allowlisted bool
+	}{
+		{name: "not-computed", policy: Policy{}},
+		{name: "computed", policy: Policy{Hashes: true}, hashes: true},
+		{name: "denied", policy: Policy{DenyList: deny}, reason: ReasonHashDenied, hashes: true},
+		{name: "denied-before-allowed", policy: Policy{DenyList: deny, AllowList: allow}, reason: ReasonHashDenied, hashes: true},
+		{name: "not-denied", policy: Policy{DenyList: other}, hashes: true},
+		{name: "allowed-not-scanned", policy: Policy{AllowList: allow, Scanners: []Scanner{scanner}}, hashes: true, allowlisted: true},
+		{name: "not-allowed-scanned", policy: Policy{AllowList: other, Scanners: []Scanner{scanner}}, reason: ReasonMalware, hashes: true},
+		{name: "allowed-type-checked", policy: Policy{AllowList: allow, UnsetExtensions: []string{ExtImgPNG}}, reason: ReasonExtensionNotAuthorised, hashes: true, allowlisted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := GetFileChecker(getMultipartFileHeaderOrFail(t, pngPath))
+			fc.SetPolicy(tt.policy)
+
+			verdict := fc.Check()
+			if verdict.Reason != tt.reason || verdict.Allowlisted != tt.allowlisted {
+				t.Errorf("Check() = %+v, want %q (allowlisted %v)", verdict, tt.reason, tt.allowlisted)
+			}
+			if tt.hashes && (verdict.Hashes == nil || *verdict.Hashes != *pngHashes) || !tt.hashes && verdict.Hashes != nil {
+				t.Errorf("Hashes = %+v, want %+v", verdict.Hashes, pngHashes)
+			}
+		})
+	}
+}
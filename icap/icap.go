@@ -0,0 +1,385 @@
+// Package icap is an ICAP (RFC 3507) server checking the bodies of the HTTP
+// requests (REQMOD) and responses (RESPMOD) forwarded by proxies such as
+// Squid, so that file policies apply to web traffic.
+//
+// Authorised messages are answered with 204 No Content (or echoed, when the
+// client does not allow 204), rejected ones are replaced with an HTTP 403
+// response holding a problem+json body (see filechecker.Problem).
+package icap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nadimattari/filechecker"
+)
+
+// ICAP methods.
+const (
+	MethodREQMOD  = "REQMOD"
+	MethodRESPMOD = "RESPMOD"
+	MethodOPTIONS = "OPTIONS"
+)
+
+const (
+	// bytes of the body previewed by clients (see OPTIONS), enough to sniff
+	// most types
+	previewSize = 4096
+
+	// maximum size of bodies by default
+	defaultMaxBodySize = 32 << 20
+
+	// ISTag by default
+	defaultISTag = `"filechecker"`
+)
+
+// ErrServerClosed is returned by Serve after Shutdown or Close.
+var ErrServerClosed = errors.New("icap: server closed")
+
+// Service is an ICAP service, e.g. icap://proxy/reqmod.
+type Service struct {
+	// MethodREQMOD (request bodies, e.g. uploads) or MethodRESPMOD (response
+	// bodies, e.g. downloads)
+	Method string
+
+	// policy the bodies are checked against
+	Policy filechecker.Policy
+
+	// tells, from the headers of the HTTP message (request for REQMOD,
+	// response for RESPMOD), whether its body is not checked at all, e.g.
+	// pages (see Inline). All bodies are checked if nil.
+	Skip func(header http.Header) bool
+}
+
+// Server serves ICAP services.
+type Server struct {
+	// services by name, the path of their URI (e.g. "reqmod" for
+	// icap://proxy/reqmod)
+	Services map[string]Service
+
+	// tag of the state of the services, changed when policies do, so that
+	// clients drop cached answers (`"filechecker"` by default)
+	ISTag string
+
+	// maximum size of bodies, larger ones are rejected (32 MiB by default)
+	MaxBodySize int64
+
+	mu        sync.Mutex
+	listeners map[net.Listener]bool
+
+	// connections, and whether they are idle (between requests)
+	conns  map[net.Conn]bool
+	closed bool
+}
+
+// Inline tells whether a response is displayed inline rather than
+// downloaded, i.e. has no Content-Disposition: attachment. As a Skip
+// function, RESPMOD services check downloads only, not the pages browsed.
+func Inline(header http.Header) bool {
+	return !strings.HasPrefix(strings.ToLower(strings.TrimSpace(header.Get("Content-Disposition"))), "attachment")
+}
+
+// ListenAndServe listens on the TCP address (":1344" if empty, the ICAP
+// port) and serves the services.
+func (s *Server) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = ":1344"
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on the listener and serves the services, until
+// Shutdown or Close. It always returns an error, ErrServerClosed after
+// Shutdown or Close.
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]bool)
+	}
+	s.listeners[listener] = true
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		if !s.track(conn, true) {
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown stops accepting connections, then closes the connections once
+// idle. Requests in flight are given until the context is done; connections
+// still busy then are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeListeners()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if s.closeConns(false) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			s.closeConns(true)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the listeners and connections at once.
+func (s *Server) Close() error {
+	s.closeListeners()
+	s.closeConns(true)
+	return nil
+}
+
+// closeListeners marks the server as closed, and closes its listeners.
+func (s *Server) closeListeners() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for listener := range s.listeners {
+		_ = listener.Close()
+		delete(s.listeners, listener)
+	}
+}
+
+// closeConns closes the idle connections (all of them if busy too), and
+// tells whether none is left.
+func (s *Server) closeConns(busy bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, idle := range s.conns {
+		if idle || busy {
+			_ = conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns) == 0
+}
+
+// track records whether the connection is idle, and tells whether it may
+// go on (the server is not closed).
+func (s *Server) track(conn net.Conn, idle bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed && idle {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]bool)
+	}
+	s.conns[conn] = idle
+	return true
+}
+
+// serveConn serves the requests of a connection, one after the other.
+func (s *Server) serveConn(conn net.Conn) {
+	var (
+		r = bufio.NewReader(conn)
+		w = bufio.NewWriter(conn)
+	)
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	for {
+		// waits for the next request, then is busy with it
+		if _, err := r.Peek(1); err != nil || !s.track(conn, false) {
+			return
+		}
+
+		req, err := readRequest(r)
+		if err != nil {
+			_ = writeResponse(w, http.StatusBadRequest, s.header(), nil, nil, nil, false)
+			return
+		}
+
+		if err = s.serveRequest(r, w, req); err != nil || strings.EqualFold(req.Header.Get("Connection"), "close") {
+			return
+		}
+
+		if !s.track(conn, true) {
+			return
+		}
+	}
+}
+
+// serveRequest serves a request: the options of a service, or the
+// modification of a message.
+func (s *Server) serveRequest(r *bufio.Reader, w *bufio.Writer, req *request) error {
+	var (
+		name         = strings.Trim(req.URI.Path, "/")
+		service, ok  = s.Services[name]
+		header       = s.header()
+		allowed, err = s.readBody(r, w, req)
+	)
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !ok:
+		return writeResponse(w, http.StatusNotFound, header, nil, nil, nil, false)
+	case req.Method == MethodOPTIONS:
+		header["Methods"] = service.Method
+		header["Service"] = "filechecker " + name
+		header["Allow"] = "204"
+		header["Preview"] = strconv.Itoa(previewSize)
+		header["Transfer-Preview"] = "*"
+		return writeResponse(w, http.StatusOK, header, nil, nil, nil, false)
+	case req.Method != MethodREQMOD && req.Method != MethodRESPMOD:
+		return writeResponse(w, http.StatusNotImplemented, header, nil, nil, nil, false)
+	case req.Method != service.Method:
+		return writeResponse(w, http.StatusMethodNotAllowed, header, nil, nil, nil, false)
+	}
+
+	// rejected messages are replaced with a 403 response
+	if problem := s.check(service, req); problem != nil {
+		res, body := problemResponse(problem)
+		return writeResponse(w, http.StatusOK, header, nil, res, body, true)
+	}
+
+	// authorised messages are unmodified
+	if allowed {
+		return writeResponse(w, http.StatusNoContent, header, nil, nil, nil, false)
+	}
+	if req.Method == MethodREQMOD {
+		return writeResponse(w, http.StatusOK, header, req.RawRequestHeader, nil, req.Body, req.HasBody)
+	}
+	return writeResponse(w, http.StatusOK, header, req.RawRequestHeader, req.RawResponseHeader, req.Body, req.HasBody)
+}
+
+// readBody reads the body of the request, asking for what follows the
+// preview, and tells whether 204 No Content may be answered.
+func (s *Server) readBody(r *bufio.Reader, w *bufio.Writer, req *request) (bool, error) {
+	var (
+		err      error
+		ieof     bool
+		tooLarge bool
+		buf      bytes.Buffer
+		limit    = s.MaxBodySize
+		allowed  = strings.Contains(req.Header.Get("Allow"), "204")
+		preview  = req.Header.Get("Preview") != ""
+	)
+
+	if limit == 0 {
+		limit = defaultMaxBodySize
+	}
+	if !req.HasBody {
+		return allowed, nil
+	}
+
+	if ieof, tooLarge, err = readChunks(r, &buf, limit); err != nil {
+		return false, err
+	}
+
+	// the rest of the body follows the preview, once asked for
+	if preview && !ieof {
+		if _, err = w.WriteString("ICAP/1.0 100 Continue\r\n\r\n"); err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			return false, err
+		}
+
+		var more bool
+		if _, more, err = readChunks(r, &buf, limit-int64(buf.Len())); err != nil {
+			return false, err
+		}
+		tooLarge = tooLarge || more
+	}
+
+	req.Body, req.TooLarge = buf.Bytes(), tooLarge
+
+	// answering 204 is always allowed after a preview
+	return allowed || preview, nil
+}
+
+// header returns the headers of responses.
+func (s *Server) header() map[string]string {
+	tag := s.ISTag
+	if tag == "" {
+		tag = defaultISTag
+	}
+	return map[string]string{"ISTag": tag, "Date": time.Now().UTC().Format(http.TimeFormat)}
+}
+
+// problemResponse returns the headers and body of the HTTP 403 response of
+// the problem.
+func problemResponse(problem *filechecker.Problem) ([]byte, []byte) {
+	var (
+		recorder = newResponseRecorder()
+		res      bytes.Buffer
+	)
+
+	problem.Status = http.StatusForbidden
+	problem.Title = http.StatusText(http.StatusForbidden)
+	filechecker.WriteProblem(recorder, problem)
+
+	fmt.Fprintf(&res, "HTTP/1.1 %d %s\r\n", http.StatusForbidden, http.StatusText(http.StatusForbidden))
+	recorder.header.Set("Content-Length", strconv.Itoa(recorder.body.Len()))
+	recorder.header.Set("Cache-Control", "no-store")
+	_ = recorder.header.Write(&res)
+	res.WriteString("\r\n")
+
+	return res.Bytes(), recorder.body.Bytes()
+}
+
+// responseRecorder records the headers and body written by
+// filechecker.WriteProblem.
+type responseRecorder struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header)}
+}
+
+func (r *responseRecorder) Header() http.Header         { return r.header }
+func (r *responseRecorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *responseRecorder) WriteHeader(int)             {}
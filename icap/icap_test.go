@@ -0,0 +1,347 @@
+package icap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/internal/fctest"
+)
+
+// testResponse is an ICAP response, as read by testClient.
+type testResponse struct {
+	Status  int
+	Header  textproto.MIMEHeader
+	ReqHdr  string
+	ResHdr  string
+	Body    []byte
+	HasBody bool
+}
+
+// testClient is an ICAP client, sending requests one after the other on
+// the same connection.
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// testServer serves the services on a local port, and returns a client.
+func testServer(t *testing.T, server *Server) *testClient {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return &testClient{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// do sends a request encapsulating the HTTP headers and body (nil if none),
+// previewing the given bytes of the body if preview >= 0.
+func (c *testClient) do(t *testing.T, method, service string, header map[string]string, reqHdr, resHdr string, body []byte, preview int) *testResponse {
+	var (
+		buf     bytes.Buffer
+		entries []string
+		offset  int
+	)
+
+	if reqHdr != "" {
+		entries = append(entries, fmt.Sprintf("req-hdr=%d", offset))
+		offset += len(reqHdr)
+	}
+	if resHdr != "" {
+		entries = append(entries, fmt.Sprintf("res-hdr=%d", offset))
+		offset += len(resHdr)
+	}
+	switch {
+	case body == nil:
+		entries = append(entries, fmt.Sprintf("null-body=%d", offset))
+	case method == MethodREQMOD:
+		entries = append(entries, fmt.Sprintf("req-body=%d", offset))
+	default:
+		entries = append(entries, fmt.Sprintf("res-body=%d", offset))
+	}
+
+	fmt.Fprintf(&buf, "%s icap://127.0.0.1/%s ICAP/1.0\r\nHost: 127.0.0.1\r\nEncapsulated: %s\r\n", method, service, strings.Join(entries, ", "))
+	for key, value := range header {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	if preview >= 0 {
+		fmt.Fprintf(&buf, "Preview: %d\r\n", preview)
+	}
+	buf.WriteString("\r\n" + reqHdr + resHdr)
+
+	rest := []byte(nil)
+	if body != nil {
+		if preview >= 0 && preview < len(body) {
+			body, rest = body[:preview], body[preview:]
+		}
+		if len(body) > 0 {
+			fmt.Fprintf(&buf, "%x\r\n%s\r\n", len(body), body)
+		}
+		if preview >= 0 && rest == nil {
+			buf.WriteString("0; ieof\r\n\r\n")
+		} else {
+			buf.WriteString("0\r\n\r\n")
+		}
+	}
+
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	response := c.read(t)
+	if response.Status != http.StatusContinue {
+		return response
+	}
+
+	// the rest of the body, once asked for
+	if err := writeChunked(c.conn, rest); err != nil {
+		t.Fatal(err)
+	}
+	return c.read(t)
+}
+
+// read reads a response.
+func (c *testClient) read(t *testing.T) *testResponse {
+	var (
+		tp       = textproto.NewReader(c.r)
+		response = &testResponse{}
+	)
+
+	line, err := tp.ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 || fields[0] != "ICAP/1.0" {
+		t.Fatalf("status line = %q", line)
+	}
+	if response.Status, err = strconv.Atoi(fields[1]); err != nil {
+		t.Fatal(err)
+	}
+	if response.Header, err = tp.ReadMIMEHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if response.Status == http.StatusContinue {
+		return response
+	}
+
+	entities, err := parseEncapsulated(response.Header.Get("Encapsulated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, e := range entities {
+		switch e.name {
+		case entityReqHdr, entityResHdr:
+			raw := make([]byte, entities[i+1].offset-e.offset)
+			if _, err = io.ReadFull(c.r, raw); err != nil {
+				t.Fatal(err)
+			}
+			if e.name == entityReqHdr {
+				response.ReqHdr = string(raw)
+			} else {
+				response.ResHdr = string(raw)
+			}
+		case entityReqBody, entityResBody:
+			var body bytes.Buffer
+			if _, _, err = readChunks(c.r, &body, 0); err != nil {
+				t.Fatal(err)
+			}
+			response.Body, response.HasBody = body.Bytes(), true
+		}
+	}
+	return response
+}
+
+func TestServer(t *testing.T) {
+	var (
+		png    = fctest.PNG(t)
+		gif    = fctest.GIF(t)
+		client = testServer(t, &Server{
+			Services: map[string]Service{
+				"reqmod":  {Method: MethodREQMOD},
+				"respmod": {Method: MethodRESPMOD, Skip: Inline},
+			},
+			MaxBodySize: 1 << 12,
+		})
+		allow = map[string]string{"Allow": "204"}
+
+		form, contentType = fctest.Form(t, fctest.File{Field: "avatar", Filename: "me.gif", Data: gif})
+		gzipped, bomb     bytes.Buffer
+	)
+
+	zw := gzip.NewWriter(&gzipped)
+	_, _ = zw.Write(gif)
+	_ = zw.Close()
+
+	// larger than the limit once decoded
+	zw = gzip.NewWriter(&bomb)
+	_, _ = zw.Write(append(append([]byte{}, png...), make([]byte, 1<<13)...))
+	_ = zw.Close()
+
+	upload := func(contentType string) string {
+		return "POST /upload/me.png HTTP/1.1\r\nHost: example.com\r\nContent-Type: " + contentType + "\r\n\r\n"
+	}
+	download := func(header string) string {
+		return "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n" + header + "\r\n"
+	}
+	get := "GET /files/42 HTTP/1.1\r\nHost: example.com\r\n\r\n"
+
+	tests := []struct {
+		name    string
+		method  string
+		service string
+		header  map[string]string
+		reqHdr  string
+		resHdr  string
+		body    []byte
+		preview int
+		status  int
+		reason  filechecker.Reason
+	}{
+		{name: "upload", method: MethodREQMOD, service: "reqmod", header: allow, reqHdr: upload("image/png"), body: png, preview: -1, status: http.StatusNoContent},
+		{name: "upload-rejected", method: MethodREQMOD, service: "reqmod", header: allow, reqHdr: upload("image/gif"), body: gif, preview: -1, status: http.StatusOK, reason: filechecker.ReasonExtensionNotAuthorised},
+		{name: "upload-form", method: MethodREQMOD, service: "reqmod", header: allow, reqHdr: upload(contentType), body: form.Bytes(), preview: -1, status: http.StatusOK, reason: filechecker.ReasonExtensionNotAuthorised},
+		{name: "upload-preview", method: MethodREQMOD, service: "reqmod", reqHdr: upload("image/png"), body: png, preview: 16, status: http.StatusNoContent},
+		{name: "upload-preview-ieof", method: MethodREQMOD, service: "reqmod", reqHdr: upload("image/gif"), body: gif, preview: 4096, status: http.StatusOK, reason: filechecker.ReasonExtensionNotAuthorised},
+		{name: "upload-too-large", method: MethodREQMOD, service: "reqmod", header: allow, reqHdr: upload("image/png"), body: append(append([]byte{}, png...), make([]byte, 1<<12)...), preview: -1, status: http.StatusOK, reason: filechecker.ReasonBodyTooLarge},
+		{name: "upload-named", method: MethodREQMOD, service: "reqmod", header: allow, reqHdr: "PUT /files HTTP/1.1\r\nHost: example.com\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=me.gif\r\n\r\n", body: gif, preview: -1, status: http.StatusOK, reason: filechecker.ReasonExtensionNotAuthorised},
+		{name: "json", method: MethodREQMOD, service: "reqmod", header: allow, reqHdr: upload("application/json"), body: []byte(`{"name":"me","size":42}`), preview: -1, status: http.StatusNoContent},
+		{name: "urlencoded", method: MethodREQMOD, service: "reqmod", header: allow, reqHdr: upload("application/x-www-form-urlencoded"), body: []byte("name=me&size=42"), preview: -1, status: http.StatusNoContent},
+		{name: "no-body", method: MethodREQMOD, service: "reqmod", header: allow, reqHdr: get, preview: -1, status: http.StatusNoContent},
+		{name: "download", method: MethodRESPMOD, service: "respmod", header: allow, reqHdr: get, resHdr: download("Content-Disposition: attachment; filename=me.png\r\n"), body: png, preview: -1, status: http.StatusNoContent},
+		{name: "download-rejected", method: MethodRESPMOD, service: "respmod", header: allow, reqHdr: get, resHdr: download("Content-Disposition: attachment; filename=me.gif\r\n"), body: gif, preview: -1, status: http.StatusOK, reason: filechecker.ReasonExtensionNotAuthorised},
+		{name: "download-gzip", method: MethodRESPMOD, service: "respmod", header: allow, reqHdr: get, resHdr: download("Content-Disposition: attachment\r\nContent-Encoding: gzip\r\n"), body: gzipped.Bytes(), preview: -1, status: http.StatusOK, reason: filechecker.ReasonExtensionNotAuthorised},
+		{name: "download-gzip-too-large", method: MethodRESPMOD, service: "respmod", header: allow, reqHdr: get, resHdr: download("Content-Disposition: attachment\r\nContent-Encoding: gzip\r\n"), body: bomb.Bytes(), preview: -1, status: http.StatusOK, reason: filechecker.ReasonBodyTooLarge},
+		{name: "download-gzip-invalid", method: MethodRESPMOD, service: "respmod", header: allow, reqHdr: get, resHdr: download("Content-Disposition: attachment\r\nContent-Encoding: gzip\r\n"), body: gif, preview: -1, status: http.StatusOK, reason: filechecker.ReasonUnreadable},
+		{name: "inline", method: MethodRESPMOD, service: "respmod", header: allow, reqHdr: get, resHdr: download(""), body: gif, preview: -1, status: http.StatusNoContent},
+		{name: "unknown-service", method: MethodREQMOD, service: "avscan", header: allow, reqHdr: get, preview: -1, status: http.StatusNotFound},
+		{name: "wrong-method", method: MethodRESPMOD, service: "reqmod", header: allow, reqHdr: get, resHdr: download(""), body: png, preview: -1, status: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := client.do(t, tt.method, tt.service, tt.header, tt.reqHdr, tt.resHdr, tt.body, tt.preview)
+
+			if response.Status != tt.status {
+				t.Fatalf("status = %d, want %d", response.Status, tt.status)
+			}
+			if response.Header.Get("ISTag") != defaultISTag {
+				t.Errorf("ISTag = %q, want %q", response.Header.Get("ISTag"), defaultISTag)
+			}
+			if tt.reason == "" {
+				return
+			}
+
+			var problem filechecker.Problem
+			if !strings.HasPrefix(response.ResHdr, "HTTP/1.1 403 Forbidden\r\n") {
+				t.Fatalf("response = %q, want 403", response.ResHdr)
+			}
+			if err := json.Unmarshal(response.Body, &problem); err != nil || problem.Reason != tt.reason || problem.Status != http.StatusForbidden {
+				t.Errorf("problem = %+v, %v, want %s", problem, err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestServer_echo(t *testing.T) {
+	var (
+		png    = fctest.PNG(t)
+		client = testServer(t, &Server{Services: map[string]Service{"reqmod": {Method: MethodREQMOD}}})
+		reqHdr = "PUT /me.png HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	)
+
+	// without Allow: 204, authorised messages are sent back unmodified
+	response := client.do(t, MethodREQMOD, "reqmod", nil, reqHdr, "", png, -1)
+	if response.Status != http.StatusOK || response.ReqHdr != reqHdr || !bytes.Equal(response.Body, png) {
+		t.Errorf("response = %d %q (%d bytes), want the request", response.Status, response.ReqHdr, len(response.Body))
+	}
+}
+
+func TestServer_options(t *testing.T) {
+	client := testServer(t, &Server{ISTag: `"v2"`, Services: map[string]Service{"respmod": {Method: MethodRESPMOD}}})
+
+	response := client.do(t, MethodOPTIONS, "respmod", nil, "", "", nil, -1)
+
+	want := map[string]string{"Methods": MethodRESPMOD, "Istag": `"v2"`, "Allow": "204", "Preview": "4096", "Encapsulated": "null-body=0"}
+	for key, value := range want {
+		if got := response.Header.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	var (
+		server = &Server{}
+		served = make(chan error, 1)
+	)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { served <- server.Serve(listener) }()
+
+	// an idle connection does not hold the shutdown
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = server.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() = %v, want nil", err)
+	}
+	if err = <-served; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Serve() = %v, want %v", err, ErrServerClosed)
+	}
+}
+
+func TestInline(t *testing.T) {
+	tests := []struct {
+		disposition string
+		want        bool
+	}{
+		{disposition: "", want: true},
+		{disposition: "inline", want: true},
+		{disposition: "attachment", want: false},
+		{disposition: `Attachment; filename="me.gif"`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.disposition, func(t *testing.T) {
+			header := http.Header{"Content-Disposition": {tt.disposition}}
+			if got := Inline(header); got != tt.want {
+				t.Errorf("Inline() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package icap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// entities that can be encapsulated in ICAP messages
+const (
+	entityReqHdr   = "req-hdr"
+	entityResHdr   = "res-hdr"
+	entityReqBody  = "req-body"
+	entityResBody  = "res-body"
+	entityNullBody = "null-body"
+	entityOptBody  = "opt-body"
+)
+
+// errMalformed is returned when ICAP requests cannot be parsed.
+var errMalformed = errors.New("icap: malformed request")
+
+// request is an ICAP request, and the HTTP messages it encapsulates.
+type request struct {
+	Method string
+	URI    *url.URL
+	Header textproto.MIMEHeader
+
+	// raw and parsed HTTP headers encapsulated
+	RawRequestHeader  []byte
+	RawResponseHeader []byte
+	HTTPRequest       *http.Request
+	HTTPResponse      *http.Response
+
+	// whether a body is encapsulated (req-body or res-body), and its bytes
+	// once read
+	HasBody bool
+	Body    []byte
+
+	// whether the body is larger than the limit; it was read, but not kept
+	TooLarge bool
+}
+
+// entity is an entity of the Encapsulated header, and its offset.
+type entity struct {
+	name   string
+	offset int
+}
+
+// readRequest reads an ICAP request, up to its body (see readChunks).
+func readRequest(r *bufio.Reader) (*request, error) {
+	var (
+		err      error
+		line     string
+		entities []entity
+		tp       = textproto.NewReader(r)
+		req      = &request{}
+	)
+
+	if line, err = tp.ReadLine(); err != nil {
+		return nil, err
+	}
+
+	// e.g. REQMOD icap://proxy/reqmod ICAP/1.0
+	parts := strings.Fields(line)
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "ICAP/") {
+		return nil, fmt.Errorf("%w: request line %q", errMalformed, line)
+	}
+	req.Method = parts[0]
+	if req.URI, err = url.Parse(parts[1]); err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformed, err)
+	}
+
+	if req.Header, err = tp.ReadMIMEHeader(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformed, err)
+	}
+
+	if entities, err = parseEncapsulated(req.Header.Get("Encapsulated")); err != nil {
+		return nil, err
+	}
+
+	// headers are the bytes between their offset and the next one
+	for i, e := range entities {
+		if e.name != entityReqHdr && e.name != entityResHdr {
+			req.HasBody = e.name == entityReqBody || e.name == entityResBody
+			continue
+		}
+		if i+1 == len(entities) {
+			return nil, fmt.Errorf("%w: %s is not followed by a body", errMalformed, e.name)
+		}
+
+		raw := make([]byte, entities[i+1].offset-e.offset)
+		if _, err = io.ReadFull(r, raw); err != nil {
+			return nil, fmt.Errorf("%w: %v", errMalformed, err)
+		}
+
+		if e.name == entityReqHdr {
+			req.RawRequestHeader = raw
+			if req.HTTPRequest, err = http.ReadRequest(bufio.NewReader(bytes.NewReader(raw))); err != nil {
+				return nil, fmt.Errorf("%w: %v", errMalformed, err)
+			}
+		} else {
+			req.RawResponseHeader = raw
+			if req.HTTPResponse, err = http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), req.HTTPRequest); err != nil {
+				return nil, fmt.Errorf("%w: %v", errMalformed, err)
+			}
+		}
+	}
+	return req, nil
+}
+
+// parseEncapsulated parses the Encapsulated header, e.g. "req-hdr=0,
+// res-hdr=137, res-body=296".
+func parseEncapsulated(value string) ([]entity, error) {
+	var entities []entity
+
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+
+		name, offset, found := cut(part, "=")
+		n, err := strconv.Atoi(offset)
+		if !found || err != nil || n < 0 || (len(entities) > 0 && n < entities[len(entities)-1].offset) {
+			return nil, fmt.Errorf("%w: Encapsulated %q", errMalformed, value)
+		}
+
+		switch name {
+		case entityReqHdr, entityResHdr, entityReqBody, entityResBody, entityNullBody, entityOptBody:
+			entities = append(entities, entity{name: name, offset: n})
+		default:
+			return nil, fmt.Errorf("%w: Encapsulated %q", errMalformed, value)
+		}
+	}
+	return entities, nil
+}
+
+// readChunks reads chunks up to the last one (of size zero) into buf, as
+// long as it is at most limit bytes (no limit if zero), and tells whether
+// the last chunk has the ieof extension (the preview is the whole body),
+// and whether the body exceeded the limit.
+func readChunks(r *bufio.Reader, buf *bytes.Buffer, limit int64) (ieof, tooLarge bool, err error) {
+	var (
+		line string
+		size int64
+		tp   = textproto.NewReader(r)
+	)
+
+	for {
+		if line, err = tp.ReadLine(); err != nil {
+			return false, tooLarge, err
+		}
+
+		// e.g. 1f4, or 0; ieof
+		sizeField, extension, _ := cut(line, ";")
+		if size, err = strconv.ParseInt(strings.TrimSpace(sizeField), 16, 64); err != nil || size < 0 {
+			return false, tooLarge, fmt.Errorf("%w: chunk size %q", errMalformed, line)
+		}
+
+		if size == 0 {
+			// trailers, if any, up to the empty line
+			for {
+				if line, err = tp.ReadLine(); err != nil || line == "" {
+					return strings.TrimSpace(extension) == "ieof", tooLarge, err
+				}
+			}
+		}
+
+		if tooLarge = tooLarge || (limit > 0 && int64(buf.Len())+size > limit); tooLarge {
+			_, err = io.CopyN(io.Discard, r, size)
+		} else {
+			_, err = io.CopyN(buf, r, size)
+		}
+		if err != nil {
+			return false, tooLarge, err
+		}
+
+		// CRLF ending the chunk
+		if line, err = tp.ReadLine(); err != nil || line != "" {
+			return false, tooLarge, fmt.Errorf("%w: chunk not terminated", errMalformed)
+		}
+	}
+}
+
+// writeChunked writes the body as a single chunk, then the last one.
+func writeChunked(w io.Writer, body []byte) error {
+	if len(body) > 0 {
+		if _, err := fmt.Fprintf(w, "%x\r\n%s\r\n", len(body), body); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "0\r\n\r\n")
+	return err
+}
+
+// writeResponse writes an ICAP response: the status line, the headers, then
+// the encapsulated HTTP request and response headers (nil if absent) and the
+// body, if any.
+func writeResponse(w *bufio.Writer, status int, header map[string]string, reqHdr, resHdr, body []byte, hasBody bool) error {
+	var (
+		offset       int
+		entries      []string
+		names        = []string{entityReqHdr, entityResHdr}
+		encapsulated = [][]byte{reqHdr, resHdr}
+	)
+
+	for i, raw := range encapsulated {
+		if raw == nil {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%s=%d", names[i], offset))
+		offset += len(raw)
+	}
+
+	switch {
+	case !hasBody:
+		entries = append(entries, fmt.Sprintf("%s=%d", entityNullBody, offset))
+	case resHdr != nil:
+		entries = append(entries, fmt.Sprintf("%s=%d", entityResBody, offset))
+	default:
+		entries = append(entries, fmt.Sprintf("%s=%d", entityReqBody, offset))
+	}
+	header["Encapsulated"] = strings.Join(entries, ", ")
+
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "ICAP/1.0 %d %s\r\n", status, statusText(status))
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s: %s\r\n", key, header[key])
+	}
+	_, _ = w.WriteString("\r\n")
+
+	for _, raw := range encapsulated {
+		_, _ = w.Write(raw)
+	}
+	if hasBody {
+		if err := writeChunked(w, body); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// statusText returns the text of ICAP status codes, which mostly are the ones
+// of HTTP.
+func statusText(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return "ICAP Service Not Found"
+	case http.StatusNotImplemented:
+		return "Method Not Implemented"
+	default:
+		return http.StatusText(status)
+	}
+}
+
+// cut slices s around the first instance of sep, telling whether it was
+// found.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
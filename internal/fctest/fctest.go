@@ -0,0 +1,88 @@
+// Package fctest provides fixtures to the tests of the adapters.
+package fctest
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nadimattari/filechecker"
+)
+
+// File is a file of a multipart request.
+type File struct {
+	Field    string
+	Filename string
+	Data     []byte
+}
+
+// testImage is a 20x10 image.
+func testImage() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, 20, 10), color.Palette{color.Black, color.White})
+	for x := 0; x < 20; x++ {
+		img.SetColorIndex(x, x%10, 1)
+	}
+	return img
+}
+
+// PNG returns a PNG image.
+func PNG(t testing.TB) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// GIF returns a GIF image (unauthorised by default).
+func GIF(t testing.TB) []byte {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Form returns the body and content type of a multipart form.
+func Form(t testing.TB, files ...File) (*bytes.Buffer, string) {
+	var (
+		body   = new(bytes.Buffer)
+		writer = multipart.NewWriter(body)
+	)
+
+	for _, file := range files {
+		w, err := writer.CreateFormFile(file.Field, file.Filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(file.Data)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return body, writer.FormDataContentType()
+}
+
+// Request returns a POST request of a multipart form.
+func Request(t testing.TB, target string, files ...File) *http.Request {
+	body, contentType := Form(t, files...)
+
+	r := httptest.NewRequest(http.MethodPost, target, body)
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
+
+// FileHeader returns the header of a file, as parsed from a multipart form.
+func FileHeader(t testing.TB, filename string, data []byte) *multipart.FileHeader {
+	header, err := filechecker.NewFileHeader(filename, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
@@ -0,0 +1,226 @@
+package filechecker
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	TrackVIDEO    = "video"
+	TrackAUDIO    = "audio"
+	TrackSUBTITLE = "subtitle"
+	TrackOTHER    = "other"
+)
+
+// largest box, element or chunk of a container read whole (e.g. a sample
+// description), larger ones being skipped
+const maxMediaBoxSize = 1 << 20
+
+// MediaLimit limits audio and video files. Zero values mean no limit.
+type MediaLimit struct {
+	// maximum duration; files of unknown duration are rejected when set
+	MaxDuration time.Duration `json:"max_duration,omitempty"`
+
+	// maximum number of tracks (streams)
+	MaxTracks int `json:"max_tracks,omitempty"`
+
+	// maximum resolution of video tracks
+	MaxWidth  int `json:"max_width,omitempty"`
+	MaxHeight int `json:"max_height,omitempty"`
+
+	// codecs allowed for every track (e.g. "h264", "aac", "opus")
+	AllowedCodecs []string `json:"allowed_codecs,omitempty"`
+}
+
+// MediaInfo describes an audio or video file, as found by probing its
+// container.
+type MediaInfo struct {
+	// container format (e.g. "mp4", "webm", "wav", "ogg")
+	Container string `json:"container"`
+
+	// duration, 0 when unknown
+	Duration time.Duration `json:"duration"`
+
+	// tracks (streams) of the file
+	Tracks []Track `json:"tracks"`
+}
+
+// Track describes a track (stream) of an audio or video file.
+type Track struct {
+	// TrackVIDEO, TrackAUDIO, TrackSUBTITLE or TrackOTHER
+	Kind string `json:"kind"`
+
+	// codec, normalised (e.g. "h264", "aac"), "" when unknown
+	Codec string `json:"codec,omitempty"`
+
+	// resolution of video tracks
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+
+	// sample rate and channels of audio tracks
+	SampleRate int `json:"sample_rate,omitempty"`
+	Channels   int `json:"channels,omitempty"`
+}
+
+// mediaProbers are the container probers, by extension.
+var mediaProbers = map[string]func(io.ReaderAt, int64) (*MediaInfo, bool){
+	ExtVideo3GP:  probeISOBMFF,
+	ExtVideoM4V:  probeISOBMFF,
+	ExtVideoMOV:  probeISOBMFF,
+	ExtVideoMP4:  probeISOBMFF,
+	ExtAudioM4A:  probeISOBMFF,
+	ExtVideoMKV:  probeMatroska,
+	ExtVideoWEBM: probeMatroska,
+	ExtAudioWAV:  probeRIFF,
+	ExtVideoAVI:  probeRIFF,
+	ExtAudioOGG:  probeOgg,
+	ExtAudioFLAC: probeFLAC,
+	ExtAudioMP3:  probeMP3,
+}
+
+// ProbeMedia probes the container of an audio or video file, given its
+// extension, and tells us about its duration and tracks.
+func ProbeMedia(ext string, data []byte) (*MediaInfo, bool) {
+	return probeMedia(ext, bytes.NewReader(data), int64(len(data)))
+}
+
+// probeMedia probes the container of the file (of the given size), reading
+// only the headers of the container, not the media data.
+func probeMedia(ext string, r io.ReaderAt, size int64) (*MediaInfo, bool) {
+	probe, found := mediaProbers[ext]
+	if !found {
+		return nil, false
+	}
+	return probe(r, size)
+}
+
+// checkMedia is a private method. Probes the audio or video file and verifies
+// it against the limit.
+func (fc *FileChecker) checkMedia(verdict *Verdict, limit MediaLimit, r io.ReaderAt) *Verdict {
+	info, ok := probeMedia(verdict.Extension, r, verdict.Size)
+	if !ok {
+		return verdict.reject(ReasonMalformed, nil)
+	}
+	verdict.Media = info
+
+	if limit.MaxDuration > 0 && (info.Duration <= 0 || info.Duration > limit.MaxDuration) {
+		return verdict.reject(ReasonTooLong, nil)
+	}
+
+	if limit.MaxTracks > 0 && len(info.Tracks) > limit.MaxTracks {
+		return verdict.reject(ReasonTooManyTracks, nil)
+	}
+
+	for _, track := range info.Tracks {
+		if (limit.MaxWidth > 0 && track.Width > limit.MaxWidth) || (limit.MaxHeight > 0 && track.Height > limit.MaxHeight) {
+			return verdict.reject(ReasonResolutionTooLarge, nil)
+		}
+
+		if len(limit.AllowedCodecs) > 0 && !containsFold(limit.AllowedCodecs, track.Codec) {
+			return verdict.reject(ReasonCodecNotAllowed, nil)
+		}
+	}
+
+	return verdict
+}
+
+// readPayload reads the payload of a box, element or chunk of a container,
+// nil if it is larger than maxMediaBoxSize or truncated.
+func readPayload(r io.ReaderAt, start, end int64) []byte {
+	if end-start > maxMediaBoxSize {
+		return nil
+	}
+
+	payload, ok := readAt(r, start, int(end-start))
+	if !ok {
+		return nil
+	}
+	return payload
+}
+
+// containsFold tells whether s is among list, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// codec returns the normalised name of a codec identifier, as found in
+// containers (MP4 sample entries, Matroska codec IDs, AVI FourCCs), or the
+// identifier itself, lower-cased, when not known.
+func codec(id string) string {
+	id = strings.TrimSpace(id)
+	if name, found := codecNames[strings.ToLower(id)]; found {
+		return name
+	}
+	if strings.HasPrefix(id, "A_AAC") {
+		return "aac"
+	}
+	return strings.ToLower(id)
+}
+
+var codecNames = map[string]string{
+	// ISOBMFF sample entries
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "h265",
+	"hev1": "h265",
+	"av01": "av1",
+	"vp08": "vp8",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+	"mp4a": "aac",
+	"opus": "opus",
+	"flac": "flac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"alac": "alac",
+	"samr": "amr",
+	"s263": "h263",
+	"tx3g": "tx3g",
+	"wvtt": "webvtt",
+
+	// Matroska codec IDs
+	"v_mpeg4/iso/avc":  "h264",
+	"v_mpegh/iso/hevc": "h265",
+	"v_vp8":            "vp8",
+	"v_vp9":            "vp9",
+	"v_av1":            "av1",
+	"v_theora":         "theora",
+	"a_opus":           "opus",
+	"a_vorbis":         "vorbis",
+	"a_flac":           "flac",
+	"a_mpeg/l3":        "mp3",
+	"a_ac3":            "ac3",
+	"a_eac3":           "eac3",
+	"s_text/utf8":      "srt",
+	"s_text/webvtt":    "webvtt",
+	"s_text/ass":       "ass",
+
+	// AVI FourCCs
+	"h264": "h264",
+	"x264": "h264",
+	"xvid": "mpeg4",
+	"divx": "mpeg4",
+	"dx50": "mpeg4",
+	"fmp4": "mpeg4",
+	"mjpg": "mjpeg",
+}
+
+// waveFormats are the codecs of WAVE format tags (WAV and AVI audio).
+var waveFormats = map[uint16]string{
+	0x0001: "pcm",
+	0x0003: "pcm",
+	0x0006: "alaw",
+	0x0007: "mulaw",
+	0x0011: "adpcm",
+	0x0055: "mp3",
+	0x00FF: "aac",
+	0x2000: "ac3",
+	0xFFFE: "pcm", // extensible, assumed PCM
+}
@@ -0,0 +1,324 @@
+package filechecker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// oggStream is a logical stream of an Ogg file.
+type oggStream struct {
+	track Track
+
+	// granule positions per second (as a fraction for Theora), and samples
+	// to skip (Opus pre-skip)
+	rate        uint64
+	rateDivisor uint64
+	preSkip     uint64
+
+	// for Theora, the granule position is split into key frame and offset
+	keyFrameShift uint
+
+	// last granule position seen
+	granule uint64
+}
+
+// probeOgg walks through the pages of an Ogg file: the first packet of each
+// logical stream identifies its codec, the last granule position gives the
+// duration. Only the headers of the other pages are read.
+func probeOgg(r io.ReaderAt, size int64) (*MediaInfo, bool) {
+	var (
+		info    = &MediaInfo{Container: "ogg"}
+		streams = make(map[uint32]*oggStream)
+		order   []uint32
+	)
+
+	for offset := int64(0); ; {
+		// header (27 bytes), then up to 255 lacing values
+		header, _ := readAt(r, offset, 27+255)
+		if len(header) < 27 || string(header[:4]) != "OggS" {
+			break
+		}
+
+		var (
+			flags    = header[5]
+			granule  = binary.LittleEndian.Uint64(header[6:])
+			serial   = binary.LittleEndian.Uint32(header[14:])
+			segments = int(header[26])
+			length   int64
+		)
+
+		if len(header) < 27+segments {
+			break
+		}
+		for _, lacing := range header[27 : 27+segments] {
+			length += int64(lacing)
+		}
+
+		start := offset + 27 + int64(segments)
+		if start+length > size {
+			break
+		}
+		offset = start + length
+
+		stream, found := streams[serial]
+		if !found {
+			// beginning of stream: first packet identifies the codec
+			if flags&0x02 == 0 {
+				continue
+			}
+			payload, _ := readAt(r, start, int(length))
+			stream = oggIdentify(payload)
+			streams[serial] = stream
+			order = append(order, serial)
+		}
+
+		// -1 means no packet ends on this page
+		if granule != 1<<64-1 {
+			stream.granule = granule
+		}
+	}
+
+	if len(order) == 0 {
+		return nil, false
+	}
+
+	for _, serial := range order {
+		stream := streams[serial]
+		info.Tracks = append(info.Tracks, stream.track)
+
+		granule := stream.granule
+		if stream.keyFrameShift > 0 {
+			granule = granule>>stream.keyFrameShift + granule&(1<<stream.keyFrameShift-1)
+		}
+		if granule > stream.preSkip {
+			granule -= stream.preSkip
+		}
+
+		// granules in units of the rate, capped rather than overflowing
+		units := uint64(math.MaxUint64)
+		if granule <= math.MaxUint64/stream.rateDivisor {
+			units = granule * stream.rateDivisor
+		}
+
+		if duration := durationOf(units, stream.rate); duration > info.Duration {
+			info.Duration = duration
+		}
+	}
+
+	return info, true
+}
+
+// oggIdentify identifies the codec of a logical stream from its first packet.
+func oggIdentify(packet []byte) *oggStream {
+	stream := &oggStream{track: Track{Kind: TrackOTHER}, rateDivisor: 1}
+
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 16:
+		stream.track = Track{Kind: TrackAUDIO, Codec: "vorbis"}
+		stream.track.Channels = int(packet[11])
+		stream.track.SampleRate = int(binary.LittleEndian.Uint32(packet[12:]))
+		stream.rate = uint64(stream.track.SampleRate)
+
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 16:
+		// granule positions are always at 48 kHz
+		stream.track = Track{Kind: TrackAUDIO, Codec: "opus"}
+		stream.track.Channels = int(packet[9])
+		stream.track.SampleRate = int(binary.LittleEndian.Uint32(packet[12:]))
+		stream.rate = 48000
+		stream.preSkip = uint64(binary.LittleEndian.Uint16(packet[10:]))
+
+	case bytes.HasPrefix(packet, []byte("\x7fFLAC")) && len(packet) >= 13+4+34:
+		// mapping header, "fLaC", then a regular STREAMINFO block
+		stream.track = flacStreamInfo(packet[17:])
+		stream.rate = uint64(stream.track.SampleRate)
+
+	case bytes.HasPrefix(packet, []byte("Speex   ")) && len(packet) >= 52:
+		stream.track = Track{Kind: TrackAUDIO, Codec: "speex"}
+		stream.track.SampleRate = int(binary.LittleEndian.Uint32(packet[36:]))
+		stream.track.Channels = int(binary.LittleEndian.Uint32(packet[48:]))
+		stream.rate = uint64(stream.track.SampleRate)
+
+	case bytes.HasPrefix(packet, []byte("\x80theora")) && len(packet) >= 42:
+		stream.track = Track{Kind: TrackVIDEO, Codec: "theora"}
+		stream.track.Width = int(packet[14])<<16 | int(packet[15])<<8 | int(packet[16])
+		stream.track.Height = int(packet[17])<<16 | int(packet[18])<<8 | int(packet[19])
+
+		// granule positions count frames: frames per second = numerator / denominator
+		numerator := uint64(binary.BigEndian.Uint32(packet[22:]))
+		denominator := uint64(binary.BigEndian.Uint32(packet[26:]))
+		if numerator > 0 && denominator > 0 {
+			stream.rate, stream.rateDivisor = numerator, denominator
+		}
+		stream.keyFrameShift = uint(packet[40]&0x03)<<3 | uint(packet[41]>>5)
+	}
+
+	return stream
+}
+
+// probeFLAC reads the STREAMINFO block of a native FLAC file.
+func probeFLAC(r io.ReaderAt, _ int64) (*MediaInfo, bool) {
+	// "fLaC", block header (type 0: STREAMINFO), 34 bytes of STREAMINFO
+	data, ok := readAt(r, 0, 4+4+34)
+	if !ok || string(data[:4]) != "fLaC" || data[4]&0x7F != 0 {
+		return nil, false
+	}
+
+	track := flacStreamInfo(data[8:])
+	return &MediaInfo{
+		Container: "flac",
+		Duration:  durationOf(flacSamples(data[8:]), uint64(track.SampleRate)),
+		Tracks:    []Track{track},
+	}, track.SampleRate > 0
+}
+
+// flacStreamInfo reads the sample rate and channels of a STREAMINFO block.
+func flacStreamInfo(info []byte) Track {
+	return Track{
+		Kind:       TrackAUDIO,
+		Codec:      "flac",
+		SampleRate: int(info[10])<<12 | int(info[11])<<4 | int(info[12])>>4,
+		Channels:   int(info[12]>>1&0x07) + 1,
+	}
+}
+
+// flacSamples reads the total number of samples of a STREAMINFO block.
+func flacSamples(info []byte) uint64 {
+	return uint64(info[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(info[14:]))
+}
+
+var (
+	// bitrates (kbit/s) of MPEG-1 and MPEG-2/2.5 Layer III, by index
+	mp3Bitrates = [2][15]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+
+	// sample rates of MPEG-1, by index (halved for MPEG-2, quartered for 2.5)
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// bytes read at once when looking for the first frame of an MP3 file, and of
+// the first frame, its Xing/Info or VBRI header included
+const (
+	mp3SyncWindow = 64 << 10
+	mp3FrameStart = 64
+)
+
+// probeMP3 reads the first frame of an MP3 file (after any ID3v2 tag). The
+// duration comes from the Xing/Info or VBRI header when there is one, or is
+// estimated from the bitrate otherwise.
+func probeMP3(r io.ReaderAt, size int64) (*MediaInfo, bool) {
+	var offset int64
+
+	// ID3v2 tag: "ID3", version (2), flags, size (syncsafe, 4)
+	if id3, ok := readAt(r, 0, 10); ok && string(id3[:3]) == "ID3" {
+		offset = 10 + int64(int(id3[6]&0x7F)<<21|int(id3[7]&0x7F)<<14|int(id3[8]&0x7F)<<7|int(id3[9]&0x7F))
+		if id3[5]&0x10 != 0 {
+			offset += 10 // footer
+		}
+	}
+
+	// frame sync
+	if offset = mp3Sync(r, offset, size); offset < 0 {
+		return nil, false
+	}
+
+	header, _ := readAt(r, offset, mp3FrameStart)
+	if len(header) < 4 {
+		return nil, false
+	}
+
+	var (
+		version      = header[1] >> 3 & 0x03 // 3: MPEG-1, 2: MPEG-2, 0: MPEG-2.5
+		layer        = header[1] >> 1 & 0x03 // 1: Layer III
+		bitrateIndex = int(header[2] >> 4)
+		rateIndex    = int(header[2] >> 2 & 0x03)
+		mono         = header[3]>>6 == 0x03
+	)
+
+	if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return nil, false
+	}
+
+	var (
+		table           = 1
+		sampleRate      = mp3SampleRates[rateIndex]
+		samplesPerFrame = uint64(576)
+		sideInfo        = 17
+		track           = Track{Kind: TrackAUDIO, Codec: "mp3", Channels: 2}
+	)
+
+	switch version {
+	case 3:
+		table, samplesPerFrame, sideInfo = 0, 1152, 32
+		if mono {
+			sideInfo = 17
+		}
+	case 2:
+		sampleRate /= 2
+		if mono {
+			sideInfo = 9
+		}
+	case 0:
+		sampleRate /= 4
+		if mono {
+			sideInfo = 9
+		}
+	}
+	if mono {
+		track.Channels = 1
+	}
+	track.SampleRate = sampleRate
+
+	info := &MediaInfo{Container: "mp3", Tracks: []Track{track}}
+
+	// Xing/Info header (VBR), right after the side information
+	if xing := tail(header, 4+sideInfo); len(xing) >= 12 &&
+		(bytes.HasPrefix(xing, []byte("Xing")) || bytes.HasPrefix(xing, []byte("Info"))) &&
+		binary.BigEndian.Uint32(xing[4:])&0x01 != 0 {
+		frames := uint64(binary.BigEndian.Uint32(xing[8:]))
+		info.Duration = durationOf(frames*samplesPerFrame, uint64(sampleRate))
+		return info, true
+	}
+
+	// VBRI header (VBR), 32 bytes after the frame header
+	if vbri := tail(header, 36); len(vbri) >= 18 && bytes.HasPrefix(vbri, []byte("VBRI")) {
+		frames := uint64(binary.BigEndian.Uint32(vbri[14:]))
+		info.Duration = durationOf(frames*samplesPerFrame, uint64(sampleRate))
+		return info, true
+	}
+
+	// constant bitrate: size of the audio (without any ID3v1 tag) / bitrate
+	audio := size - offset
+	if tag, ok := readAt(r, size-128, 3); audio >= 128 && ok && string(tag) == "TAG" {
+		audio -= 128
+	}
+	bitrate := uint64(mp3Bitrates[table][bitrateIndex]) * 1000 / 8 // bytes per second
+	info.Duration = durationOf(uint64(audio), bitrate)
+
+	return info, true
+}
+
+// mp3Sync returns the offset of the first frame sync from offset, -1 if there
+// is none.
+func mp3Sync(r io.ReaderAt, offset, size int64) int64 {
+	for ; offset+4 <= size; offset += mp3SyncWindow - 3 {
+		data, _ := readAt(r, offset, mp3SyncWindow)
+		for i := 0; i+4 <= len(data); i++ {
+			if data[i] == 0xFF && data[i+1]&0xE0 == 0xE0 {
+				return offset + int64(i)
+			}
+		}
+	}
+	return -1
+}
+
+// tail returns data from offset, empty if offset is beyond the end.
+func tail(data []byte, offset int) []byte {
+	if offset > len(data) {
+		return nil
+	}
+	return data[offset:]
+}
@@ -0,0 +1,217 @@
+package filechecker
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// isobmffBox is a box of an ISO base media file (MP4, MOV, 3GP, HEIF...): its
+// type, and where its payload is in the file.
+type isobmffBox struct {
+	typ        string
+	start, end int64
+}
+
+// isobmffBoxes returns the boxes between offset and end, up to the first one
+// truncated. Only their headers are read.
+func isobmffBoxes(r io.ReaderAt, offset, end int64) []isobmffBox {
+	var boxes []isobmffBox
+
+	for end-offset >= 8 {
+		header, ok := readAt(r, offset, 8)
+		if !ok {
+			return boxes
+		}
+
+		var (
+			size       = uint64(binary.BigEndian.Uint32(header))
+			typ        = string(header[4:8])
+			headerSize = uint64(8)
+			available  = uint64(end - offset)
+		)
+
+		switch size {
+		case 0: // up to the end
+			size = available
+		case 1: // 64-bit size
+			if available < 16 {
+				return boxes
+			}
+			if header, ok = readAt(r, offset+8, 8); !ok {
+				return boxes
+			}
+			size, headerSize = binary.BigEndian.Uint64(header), 16
+		}
+
+		if size < headerSize || size > available {
+			return boxes
+		}
+
+		boxes = append(boxes, isobmffBox{typ: typ, start: offset + int64(headerSize), end: offset + int64(size)})
+		offset += int64(size)
+	}
+
+	return boxes
+}
+
+// probeISOBMFF reads the movie header (duration) and the tracks (handler,
+// sample entry) of an ISO base media file. Media data (mdat) is skipped.
+func probeISOBMFF(r io.ReaderAt, size int64) (*MediaInfo, bool) {
+	var (
+		info  = &MediaInfo{Container: "mp4"}
+		found bool
+	)
+
+	for _, box := range isobmffBoxes(r, 0, size) {
+		switch box.typ {
+		case "ftyp":
+			if brand, ok := readAt(r, box.start, 4); ok && box.end-box.start >= 4 && string(brand) == "qt  " {
+				info.Container = "mov"
+			}
+		case "moov":
+			found = true
+			probeISOBMFFMovie(info, r, box)
+		}
+	}
+
+	return info, found
+}
+
+// probeISOBMFFMovie reads the content of the moov box.
+func probeISOBMFFMovie(info *MediaInfo, r io.ReaderAt, moov isobmffBox) {
+	var timescale, fragmented uint64
+
+	for _, box := range isobmffBoxes(r, moov.start, moov.end) {
+		switch box.typ {
+		case "mvhd":
+			var duration uint64
+			if timescale, duration = mvhdDuration(readPayload(r, box.start, box.end)); timescale > 0 {
+				info.Duration = durationOf(duration, timescale)
+			}
+		case "mvex":
+			for _, child := range isobmffBoxes(r, box.start, box.end) {
+				if child.typ == "mehd" {
+					fragmented = mehdDuration(readPayload(r, child.start, child.end))
+				}
+			}
+		case "trak":
+			info.Tracks = append(info.Tracks, probeISOBMFFTrack(r, box))
+		}
+	}
+
+	// fragmented file: the overall duration is in mehd
+	if info.Duration == 0 {
+		info.Duration = durationOf(fragmented, timescale)
+	}
+}
+
+// mvhdDuration reads the timescale and the duration of the movie header.
+// Version 1 boxes have 64-bit times.
+func mvhdDuration(mvhd []byte) (timescale, duration uint64) {
+	switch {
+	case len(mvhd) >= 32 && mvhd[0] == 1:
+		return uint64(binary.BigEndian.Uint32(mvhd[20:])), binary.BigEndian.Uint64(mvhd[24:])
+	case len(mvhd) >= 20 && mvhd[0] == 0:
+		return uint64(binary.BigEndian.Uint32(mvhd[12:])), uint64(binary.BigEndian.Uint32(mvhd[16:]))
+	}
+	return 0, 0
+}
+
+// mehdDuration reads the duration of the movie extends header (fragmented
+// files), in units of the movie timescale.
+func mehdDuration(mehd []byte) uint64 {
+	switch {
+	case len(mehd) >= 12 && mehd[0] == 1:
+		return binary.BigEndian.Uint64(mehd[4:])
+	case len(mehd) >= 8 && mehd[0] == 0:
+		return uint64(binary.BigEndian.Uint32(mehd[4:]))
+	}
+	return 0
+}
+
+// probeISOBMFFTrack reads the kind, size and codec of a trak box.
+func probeISOBMFFTrack(r io.ReaderAt, trak isobmffBox) Track {
+	var (
+		track = Track{Kind: TrackOTHER}
+		stsd  []byte
+	)
+
+	walkISOBMFF(r, trak, func(box isobmffBox) {
+		switch box.typ {
+		case "tkhd":
+			// width and height (16.16 fixed point) end the box
+			if payload := readPayload(r, box.start, box.end); len(payload) >= 84 {
+				n := len(payload)
+				track.Width = int(binary.BigEndian.Uint32(payload[n-8:]) >> 16)
+				track.Height = int(binary.BigEndian.Uint32(payload[n-4:]) >> 16)
+			}
+		case "hdlr":
+			if payload := readPayload(r, box.start, box.end); len(payload) >= 12 {
+				switch string(payload[8:12]) {
+				case "vide":
+					track.Kind = TrackVIDEO
+				case "soun":
+					track.Kind = TrackAUDIO
+				case "text", "sbtl", "subt":
+					track.Kind = TrackSUBTITLE
+				}
+			}
+		case "stsd":
+			stsd = readPayload(r, box.start, box.end)
+		}
+	})
+
+	// first sample entry: size, format, then format specific fields
+	if len(stsd) >= 16 {
+		entry := stsd[8:]
+		track.Codec = codec(string(entry[4:8]))
+
+		switch track.Kind {
+		case TrackVIDEO:
+			if len(entry) >= 36 {
+				track.Width = int(binary.BigEndian.Uint16(entry[32:]))
+				track.Height = int(binary.BigEndian.Uint16(entry[34:]))
+			}
+		case TrackAUDIO:
+			if len(entry) >= 36 {
+				track.Channels = int(binary.BigEndian.Uint16(entry[24:]))
+				track.SampleRate = int(binary.BigEndian.Uint32(entry[32:]) >> 16)
+			}
+		}
+	}
+
+	if track.Kind != TrackVIDEO {
+		track.Width, track.Height = 0, 0
+	}
+	return track
+}
+
+// walkISOBMFF calls fn for every box of the parent, descending into the boxes
+// leading to the sample description.
+func walkISOBMFF(r io.ReaderAt, parent isobmffBox, fn func(box isobmffBox)) {
+	for _, box := range isobmffBoxes(r, parent.start, parent.end) {
+		fn(box)
+
+		switch box.typ {
+		case "mdia", "minf", "stbl":
+			walkISOBMFF(r, box, fn)
+		}
+	}
+}
+
+// durationOf converts a number of units of the timescale (units per second)
+// into a duration.
+func durationOf(units, timescale uint64) time.Duration {
+	if timescale == 0 {
+		return 0
+	}
+
+	seconds := units / timescale
+	if seconds > uint64(time.Duration(1<<63-1)/time.Second) {
+		return time.Duration(1<<63 - 1)
+	}
+
+	rest := units % timescale
+	return time.Duration(seconds)*time.Second + time.Duration(rest*uint64(time.Second)/timescale)
+}
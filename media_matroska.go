@@ -0,0 +1,223 @@
+package filechecker
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// Matroska (and WebM) element IDs
+const (
+	ebmlHeader        = 0x1A45DFA3
+	ebmlDocType       = 0x4282
+	mkvSegment        = 0x18538067
+	mkvInfo           = 0x1549A966
+	mkvTimecodeScale  = 0x2AD7B1
+	mkvDuration       = 0x4489
+	mkvTracks         = 0x1654AE6B
+	mkvTrackEntry     = 0xAE
+	mkvTrackType      = 0x83
+	mkvCodecID        = 0x86
+	mkvVideo          = 0xE0
+	mkvPixelWidth     = 0xB0
+	mkvPixelHeight    = 0xBA
+	mkvAudio          = 0xE1
+	mkvSamplingFreq   = 0xB5
+	mkvChannels       = 0x9F
+	mkvDefaultTCScale = 1000000 // nanoseconds
+)
+
+// ebmlElement is an element of an EBML document: its ID, and where its
+// payload is in the file.
+type ebmlElement struct {
+	id         uint64
+	start, end int64
+}
+
+// ebmlVint reads a variable-length integer, returning its value (with or
+// without its length marker) and its length, 0 when invalid.
+func ebmlVint(data []byte, keepMarker bool) (uint64, int) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0
+	}
+
+	length := 1
+	for mask := byte(0x80); data[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > len(data) {
+		return 0, 0
+	}
+
+	value := uint64(data[0])
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+	}
+	return value, length
+}
+
+// ebmlElements returns the elements between offset and end. Elements of
+// unknown size (live streams) extend up to end. Only their headers are read.
+func ebmlElements(r io.ReaderAt, offset, end int64) []ebmlElement {
+	var elements []ebmlElement
+
+	for offset < end {
+		// IDs are 4 bytes long at most, sizes 8 bytes
+		n := end - offset
+		if n > 12 {
+			n = 12
+		}
+		header, _ := readAt(r, offset, int(n))
+
+		id, idLength := ebmlVint(header, true)
+		if idLength == 0 {
+			break
+		}
+
+		size, sizeLength := ebmlVint(header[idLength:], false)
+		if sizeLength == 0 {
+			break
+		}
+
+		start := offset + int64(idLength+sizeLength)
+		elementEnd := end
+		if size != 1<<(7*sizeLength)-1 && uint64(start)+size < uint64(end) {
+			elementEnd = start + int64(size)
+		}
+
+		elements = append(elements, ebmlElement{id: id, start: start, end: elementEnd})
+		offset = elementEnd
+	}
+
+	return elements
+}
+
+// ebmlUint reads an unsigned integer element.
+func ebmlUint(payload []byte) uint64 {
+	var value uint64
+	for _, b := range payload {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+// ebmlFloat reads a float element (4 or 8 bytes).
+func ebmlFloat(payload []byte) float64 {
+	switch len(payload) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(payload)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(payload))
+	}
+	return 0
+}
+
+// probeMatroska reads the segment information (duration) and the tracks of
+// a Matroska or WebM file. Clusters (media data) are skipped.
+func probeMatroska(r io.ReaderAt, size int64) (*MediaInfo, bool) {
+	var (
+		info    = &MediaInfo{Container: "matroska"}
+		segment *ebmlElement
+		found   bool
+	)
+
+	for _, element := range ebmlElements(r, 0, size) {
+		switch element.id {
+		case ebmlHeader:
+			found = true
+			for _, child := range ebmlElements(r, element.start, element.end) {
+				if child.id == ebmlDocType {
+					info.Container = string(readPayload(r, child.start, child.end))
+				}
+			}
+		case mkvSegment:
+			element := element
+			segment = &element
+		}
+	}
+
+	if !found || segment == nil {
+		return nil, false
+	}
+
+	var (
+		scale    = uint64(mkvDefaultTCScale)
+		duration float64
+	)
+
+	for _, element := range ebmlElements(r, segment.start, segment.end) {
+		switch element.id {
+		case mkvInfo:
+			for _, child := range ebmlElements(r, element.start, element.end) {
+				switch child.id {
+				case mkvTimecodeScale:
+					scale = ebmlUint(readPayload(r, child.start, child.end))
+				case mkvDuration:
+					duration = ebmlFloat(readPayload(r, child.start, child.end))
+				}
+			}
+		case mkvTracks:
+			for _, entry := range ebmlElements(r, element.start, element.end) {
+				if entry.id == mkvTrackEntry {
+					info.Tracks = append(info.Tracks, probeMatroskaTrack(r, entry))
+				}
+			}
+		}
+	}
+
+	// duration is in units of the timecode scale (nanoseconds), capped as
+	// durationOf does; a NaN duration is taken as the longest
+	switch nanoseconds := duration * float64(scale); {
+	case math.IsNaN(nanoseconds) || nanoseconds >= math.MaxInt64:
+		info.Duration = math.MaxInt64
+	case nanoseconds > 0:
+		info.Duration = time.Duration(nanoseconds)
+	}
+
+	return info, true
+}
+
+// probeMatroskaTrack reads the kind, codec and size of a track entry.
+func probeMatroskaTrack(r io.ReaderAt, entry ebmlElement) Track {
+	track := Track{Kind: TrackOTHER}
+
+	for _, element := range ebmlElements(r, entry.start, entry.end) {
+		switch element.id {
+		case mkvTrackType:
+			switch ebmlUint(readPayload(r, element.start, element.end)) {
+			case 1:
+				track.Kind = TrackVIDEO
+			case 2:
+				track.Kind = TrackAUDIO
+			case 0x11:
+				track.Kind = TrackSUBTITLE
+			}
+		case mkvCodecID:
+			track.Codec = codec(string(readPayload(r, element.start, element.end)))
+		case mkvVideo:
+			for _, child := range ebmlElements(r, element.start, element.end) {
+				switch child.id {
+				case mkvPixelWidth:
+					track.Width = int(ebmlUint(readPayload(r, child.start, child.end)))
+				case mkvPixelHeight:
+					track.Height = int(ebmlUint(readPayload(r, child.start, child.end)))
+				}
+			}
+		case mkvAudio:
+			for _, child := range ebmlElements(r, element.start, element.end) {
+				switch child.id {
+				case mkvSamplingFreq:
+					track.SampleRate = int(ebmlFloat(readPayload(r, child.start, child.end)))
+				case mkvChannels:
+					track.Channels = int(ebmlUint(readPayload(r, child.start, child.end)))
+				}
+			}
+		}
+	}
+
+	return track
+}
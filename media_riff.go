@@ -0,0 +1,196 @@
+package filechecker
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// riffChunk is a chunk of a RIFF file (WAV, AVI): its ID, and where its
+// payload is in the file.
+type riffChunk struct {
+	id         string
+	start, end int64
+}
+
+// riffChunks returns the chunks between offset and end. Only their headers
+// are read: LIST chunks are returned as such, their list type being the
+// first 4 bytes of the payload (see riffList).
+func riffChunks(r io.ReaderAt, offset, end int64) []riffChunk {
+	var chunks []riffChunk
+
+	for end-offset >= 8 {
+		header, ok := readAt(r, offset, 8)
+		if !ok {
+			break
+		}
+
+		var (
+			id       = string(header[:4])
+			size     = int64(binary.LittleEndian.Uint32(header[4:]))
+			start    = offset + 8
+			chunkEnd = start + size
+		)
+
+		// truncated chunk (e.g. data still being written): keep what's there
+		if chunkEnd > end {
+			chunkEnd = end
+		}
+		chunks = append(chunks, riffChunk{id: id, start: start, end: chunkEnd})
+
+		// chunks are padded to an even size
+		if chunkEnd += size & 1; chunkEnd > end {
+			break
+		}
+		offset = chunkEnd
+	}
+
+	return chunks
+}
+
+// riffList returns the list type of a LIST chunk, "" for other chunks.
+func riffList(r io.ReaderAt, chunk riffChunk) string {
+	if chunk.id != "LIST" || chunk.end-chunk.start < 4 {
+		return ""
+	}
+
+	typ, _ := readAt(r, chunk.start, 4)
+	return string(typ)
+}
+
+// probeRIFF reads the format and size of a WAV file, or the headers of an AVI
+// file. Media data is skipped.
+func probeRIFF(r io.ReaderAt, size int64) (*MediaInfo, bool) {
+	header, ok := readAt(r, 0, 12)
+	if !ok || string(header[:4]) != "RIFF" {
+		return nil, false
+	}
+
+	switch string(header[8:12]) {
+	case "WAVE":
+		return probeWAV(r, riffChunks(r, 12, size))
+	case "AVI ":
+		return probeAVI(r, riffChunks(r, 12, size))
+	}
+	return nil, false
+}
+
+// probeWAV reads the fmt chunk and works out the duration from the size of
+// the data chunk.
+func probeWAV(r io.ReaderAt, chunks []riffChunk) (*MediaInfo, bool) {
+	var (
+		info     = &MediaInfo{Container: "wav"}
+		track    = Track{Kind: TrackAUDIO}
+		byteRate uint32
+		found    bool
+	)
+
+	for _, chunk := range chunks {
+		switch chunk.id {
+		case "fmt ":
+			payload := readPayload(r, chunk.start, chunk.end)
+			if len(payload) < 16 {
+				return nil, false
+			}
+			found = true
+			track.Codec = waveFormats[binary.LittleEndian.Uint16(payload)]
+			track.Channels = int(binary.LittleEndian.Uint16(payload[2:]))
+			track.SampleRate = int(binary.LittleEndian.Uint32(payload[4:]))
+			byteRate = binary.LittleEndian.Uint32(payload[8:])
+		case "data":
+			if byteRate > 0 {
+				info.Duration = durationOf(uint64(chunk.end-chunk.start), uint64(byteRate))
+			}
+		}
+	}
+
+	if !found {
+		return nil, false
+	}
+	info.Tracks = []Track{track}
+	return info, true
+}
+
+// probeAVI reads the main AVI header (duration, size) and the stream headers
+// (kind, codec) of the hdrl list.
+func probeAVI(r io.ReaderAt, chunks []riffChunk) (*MediaInfo, bool) {
+	var (
+		info  = &MediaInfo{Container: "avi"}
+		found bool
+	)
+
+	for _, chunk := range chunks {
+		if riffList(r, chunk) != "hdrl" {
+			continue
+		}
+
+		for _, header := range riffChunks(r, chunk.start+4, chunk.end) {
+			switch {
+			case header.id == "avih":
+				payload := readPayload(r, header.start, header.end)
+				if len(payload) < 40 {
+					continue
+				}
+				found = true
+				microSecPerFrame := uint64(binary.LittleEndian.Uint32(payload))
+				totalFrames := uint64(binary.LittleEndian.Uint32(payload[16:]))
+				info.Duration = durationOf(microSecPerFrame*totalFrames, uint64(time.Second/time.Microsecond))
+
+			case riffList(r, header) == "strl":
+				info.Tracks = append(info.Tracks, probeAVIStream(r, riffChunks(r, header.start+4, header.end)))
+			}
+		}
+	}
+
+	return info, found
+}
+
+// probeAVIStream reads the stream header (strh) and format (strf) of an AVI
+// stream.
+func probeAVIStream(r io.ReaderAt, chunks []riffChunk) Track {
+	var (
+		track   = Track{Kind: TrackOTHER}
+		handler string
+	)
+
+	for _, chunk := range chunks {
+		if chunk.id != "strh" && chunk.id != "strf" {
+			continue
+		}
+		payload := readPayload(r, chunk.start, chunk.end)
+
+		switch {
+		case chunk.id == "strh" && len(payload) >= 8:
+			switch string(payload[:4]) {
+			case "vids":
+				track.Kind = TrackVIDEO
+			case "auds":
+				track.Kind = TrackAUDIO
+			case "txts":
+				track.Kind = TrackSUBTITLE
+			}
+			handler = strings.TrimRight(string(payload[4:8]), "\x00 ")
+
+		case chunk.id == "strf" && track.Kind == TrackVIDEO && len(payload) >= 20:
+			// BITMAPINFOHEADER
+			track.Width = int(int32(binary.LittleEndian.Uint32(payload[4:])))
+			track.Height = int(int32(binary.LittleEndian.Uint32(payload[8:])))
+			if track.Height < 0 {
+				track.Height = -track.Height // top-down bitmap
+			}
+			handler = strings.TrimRight(string(payload[16:20]), "\x00 ")
+
+		case chunk.id == "strf" && track.Kind == TrackAUDIO && len(payload) >= 8:
+			// WAVEFORMATEX
+			track.Codec = waveFormats[binary.LittleEndian.Uint16(payload)]
+			track.Channels = int(binary.LittleEndian.Uint16(payload[2:]))
+			track.SampleRate = int(binary.LittleEndian.Uint32(payload[4:]))
+		}
+	}
+
+	if track.Kind == TrackVIDEO && handler != "" {
+		track.Codec = codec(handler)
+	}
+	return track
+}
@@ -0,0 +1,424 @@
+package filechecker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func be16(v int) []byte { return []byte{byte(v >> 8), byte(v)} }
+func be32(v int) []byte { return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)} }
+func le16(v int) []byte { return []byte{byte(v), byte(v >> 8)} }
+func le32(v int) []byte { return []byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)} }
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func box(typ string, parts ...[]byte) []byte {
+	payload := concat(parts...)
+	return concat(be32(8+len(payload)), []byte(typ), payload)
+}
+
+// testMP4 is a 90.5 seconds MP4 with a 1920x1080 H.264 track and a stereo
+// 48 kHz AAC track.
+func testMP4() []byte {
+	var (
+		mvhd = box("mvhd", make([]byte, 12), be32(1000), be32(90500), make([]byte, 80))
+		tkhd = func(width, height int) []byte {
+			return box("tkhd", make([]byte, 76), be32(width<<16), be32(height<<16))
+		}
+		hdlr = func(handler string) []byte {
+			return box("hdlr", make([]byte, 8), []byte(handler), make([]byte, 13))
+		}
+		stsd = func(entry []byte) []byte {
+			return box("stbl", box("stsd", make([]byte, 4), be32(1), entry))
+		}
+		video = box("avc1", make([]byte, 24), be16(1920), be16(1080), make([]byte, 50))
+		audio = box("mp4a", make([]byte, 16), be16(2), be16(16), make([]byte, 4), be32(48000<<16))
+	)
+
+	return concat(
+		box("ftyp", []byte("isom"), be32(0x200), []byte("isomavc1")),
+		box("moov",
+			mvhd,
+			box("trak", tkhd(1920, 1080), box("mdia", hdlr("vide"), box("minf", stsd(video)))),
+			box("trak", tkhd(0, 0), box("mdia", hdlr("soun"), box("minf", stsd(audio)))),
+		),
+		box("mdat", make([]byte, 64)),
+	)
+}
+
+func ebml(id uint64, parts ...[]byte) []byte {
+	var (
+		payload = concat(parts...)
+		out     []byte
+	)
+
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> uint(shift)); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	return concat(out, []byte{0x40 | byte(len(payload)>>8), byte(len(payload))}, payload)
+}
+
+func float64Bytes(f float64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(f))
+	return b
+}
+
+// testWebM is a 12.345 seconds WebM with a 640x360 VP9 track and a stereo
+// 48 kHz Opus track.
+func testWebM() []byte {
+	return concat(
+		ebml(ebmlHeader, ebml(ebmlDocType, []byte("webm"))),
+		ebml(mkvSegment,
+			ebml(mkvInfo, ebml(mkvTimecodeScale, be32(1000000)), ebml(mkvDuration, float64Bytes(12345))),
+			ebml(mkvTracks,
+				ebml(mkvTrackEntry,
+					ebml(mkvTrackType, []byte{1}),
+					ebml(mkvCodecID, []byte("V_VP9")),
+					ebml(mkvVideo, ebml(mkvPixelWidth, be16(640)), ebml(mkvPixelHeight, be16(360))),
+				),
+				ebml(mkvTrackEntry,
+					ebml(mkvTrackType, []byte{2}),
+					ebml(mkvCodecID, []byte("A_OPUS")),
+					ebml(mkvAudio, ebml(mkvSamplingFreq, float64Bytes(48000)), ebml(mkvChannels, []byte{2})),
+				),
+			),
+		),
+	)
+}
+
+func riff(form string, chunks ...[]byte) []byte {
+	payload := concat(chunks...)
+	return concat([]byte("RIFF"), le32(4+len(payload)), []byte(form), payload)
+}
+
+func chunk(id string, parts ...[]byte) []byte {
+	payload := concat(parts...)
+	if len(payload)&1 == 1 {
+		return concat([]byte(id), le32(len(payload)), payload, []byte{0})
+	}
+	return concat([]byte(id), le32(len(payload)), payload)
+}
+
+// testWAV is a 2 seconds, 8 kHz, mono, 8-bit PCM WAV.
+func testWAV() []byte {
+	return riff("WAVE",
+		chunk("fmt ", le16(1), le16(1), le32(8000), le32(8000), le16(1), le16(8)),
+		chunk("data", make([]byte, 16000)),
+	)
+}
+
+// testAVI is a 10 seconds AVI with a 1280x720 H.264 stream.
+func testAVI() []byte {
+	return riff("AVI ",
+		chunk("LIST", []byte("hdrl"),
+			chunk("avih", le32(40000), make([]byte, 12), le32(250), make([]byte, 36)),
+			chunk("LIST", []byte("strl"),
+				chunk("strh", []byte("vidsH264"), make([]byte, 48)),
+				chunk("strf", le32(40), le32(1280), le32(720), le16(1), le16(24), []byte("H264"), make([]byte, 20)),
+			),
+		),
+		chunk("LIST", []byte("movi")),
+	)
+}
+
+func oggPage(flags byte, granule uint64, packet []byte) []byte {
+	g := make([]byte, 8)
+	binary.LittleEndian.PutUint64(g, granule)
+	return concat([]byte("OggS"), []byte{0, flags}, g, le32(1), le32(0), le32(0), []byte{1, byte(len(packet))}, packet)
+}
+
+// testOgg is a 3 seconds, 44.1 kHz, stereo Vorbis Ogg.
+func testOgg() []byte {
+	return concat(
+		oggPage(0x02, 0, concat([]byte("\x01vorbis"), le32(0), []byte{2}, le32(44100), make([]byte, 14))),
+		oggPage(0x00, 1<<64-1, []byte("\x03vorbis")),
+		oggPage(0x04, 3*44100, make([]byte, 32)),
+	)
+}
+
+// testFLAC is a 5 seconds, 44.1 kHz, stereo FLAC.
+func testFLAC() []byte {
+	var (
+		info = make([]byte, 34)
+		bits = uint64(44100)<<44 | uint64(2-1)<<41 | uint64(16-1)<<36 | uint64(5*44100)
+	)
+
+	binary.BigEndian.PutUint64(info[10:], bits)
+	return concat([]byte("fLaC"), []byte{0x80, 0, 0, 34}, info)
+}
+
+// testMP3 is a 2 seconds, 128 kbit/s, 44.1 kHz, stereo CBR MP3.
+func testMP3() []byte {
+	return concat([]byte{0xFF, 0xFB, 0x90, 0x00}, make([]byte, 32000-4))
+}
+
+//nolint:funlen
+func TestProbeMedia(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  string
+		data []byte
+		want *MediaInfo
+	}{
+		{
+			name: "MP4",
+			ext:  ExtVideoMP4,
+			data: testMP4(),
+			want: &MediaInfo{
+				Container: "mp4",
+				Duration:  90500 * time.Millisecond,
+				Tracks: []Track{
+					{Kind: TrackVIDEO, Codec: "h264", Width: 1920, Height: 1080},
+					{Kind: TrackAUDIO, Codec: "aac", SampleRate: 48000, Channels: 2},
+				},
+			},
+		},
+		{
+			name: "WEBM",
+			ext:  ExtVideoWEBM,
+			data: testWebM(),
+			want: &MediaInfo{
+				Container: "webm",
+				Duration:  12345 * time.Millisecond,
+				Tracks: []Track{
+					{Kind: TrackVIDEO, Codec: "vp9", Width: 640, Height: 360},
+					{Kind: TrackAUDIO, Codec: "opus", SampleRate: 48000, Channels: 2},
+				},
+			},
+		},
+		{
+			name: "WAV",
+			ext:  ExtAudioWAV,
+			data: testWAV(),
+			want: &MediaInfo{
+				Container: "wav",
+				Duration:  2 * time.Second,
+				Tracks:    []Track{{Kind: TrackAUDIO, Codec: "pcm", SampleRate: 8000, Channels: 1}},
+			},
+		},
+		{
+			name: "AVI",
+			ext:  ExtVideoAVI,
+			data: testAVI(),
+			want: &MediaInfo{
+				Container: "avi",
+				Duration:  10 * time.Second,
+				Tracks:    []Track{{Kind: TrackVIDEO, Codec: "h264", Width: 1280, Height: 720}},
+			},
+		},
+		{
+			name: "OGG",
+			ext:  ExtAudioOGG,
+			data: testOgg(),
+			want: &MediaInfo{
+				Container: "ogg",
+				Duration:  3 * time.Second,
+				Tracks:    []Track{{Kind: TrackAUDIO, Codec: "vorbis", SampleRate: 44100, Channels: 2}},
+			},
+		},
+		{
+			name: "FLAC",
+			ext:  ExtAudioFLAC,
+			data: testFLAC(),
+			want: &MediaInfo{
+				Container: "flac",
+				Duration:  5 * time.Second,
+				Tracks:    []Track{{Kind: TrackAUDIO, Codec: "flac", SampleRate: 44100, Channels: 2}},
+			},
+		},
+		{
+			name: "MP3",
+			ext:  ExtAudioMP3,
+			data: testMP3(),
+			want: &MediaInfo{
+				Container: "mp3",
+				Duration:  2 * time.Second,
+				Tracks:    []Track{{Kind: TrackAUDIO, Codec: "mp3", SampleRate: 44100, Channels: 2}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ProbeMedia(tt.ext, tt.data)
+			if !ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProbeMedia() = %+v, %v, want %+v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeMedia_Durations(t *testing.T) {
+	var (
+		webm = func(duration ...[]byte) []byte {
+			info := ebml(mkvTimecodeScale, be32(1000000))
+			for _, d := range duration {
+				info = concat(info, ebml(mkvDuration, d))
+			}
+			return concat(ebml(ebmlHeader, ebml(ebmlDocType, []byte("webm"))), ebml(mkvSegment, ebml(mkvInfo, info)))
+		}
+		theora = concat([]byte("\x80theora"), make([]byte, 15), be32(30000), be32(1001), make([]byte, 12))
+	)
+
+	tests := []struct {
+		name string
+		ext  string
+		data []byte
+		want time.Duration
+	}{
+		{name: "WEBM-Missing", ext: ExtVideoWEBM, data: webm(), want: 0},
+		{name: "WEBM-NaN", ext: ExtVideoWEBM, data: webm(float64Bytes(math.NaN())), want: math.MaxInt64},
+		{name: "WEBM-Huge", ext: ExtVideoWEBM, data: webm(float64Bytes(math.MaxFloat64)), want: math.MaxInt64},
+		{name: "WEBM-Inf", ext: ExtVideoWEBM, data: webm(float64Bytes(math.Inf(1))), want: math.MaxInt64},
+		{
+			name: "OGG-Theora-Huge",
+			ext:  ExtAudioOGG,
+			data: concat(oggPage(0x02, 0, theora), oggPage(0x04, 1<<62, make([]byte, 32))),
+			want: math.MaxInt64,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ProbeMedia(tt.ext, tt.data)
+			if !ok || got.Duration != tt.want {
+				t.Errorf("ProbeMedia() = %+v, %v, want duration %s", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeMedia_Malformed(t *testing.T) {
+	for ext, data := range map[string][]byte{
+		ExtVideoMP4:  box("ftyp", []byte("isom")),
+		ExtVideoWEBM: testWebM()[:3],
+		ExtAudioWAV:  riff("WAVE", chunk("data", make([]byte, 8))),
+		ExtAudioOGG:  []byte("OggS"),
+		ExtAudioFLAC: []byte("fLaC"),
+		ExtImgPNG:    testWAV(),
+	} {
+		if got, ok := ProbeMedia(ext, data); ok {
+			t.Errorf("ProbeMedia(%s) = %+v, want failure", ext, got)
+		}
+	}
+}
+
+// countingReaderAt counts the bytes read through it.
+type countingReaderAt struct {
+	r    *bytes.Reader
+	read int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	n, err := c.r.ReadAt(p, offset)
+	c.read += n
+	return n, err
+}
+
+func TestProbeMedia_SkipsPayloads(t *testing.T) {
+	const payload = 4 << 20
+
+	for ext, data := range map[string][]byte{
+		ExtVideoMP4: concat(testMP4(), box("mdat", make([]byte, payload))),
+		ExtAudioWAV: riff("WAVE",
+			chunk("fmt ", le16(1), le16(1), le32(8000), le32(8000), le16(1), le16(8)),
+			chunk("data", make([]byte, payload)),
+		),
+		ExtVideoAVI: concat(testAVI(), chunk("JUNK", make([]byte, payload))),
+	} {
+		r := &countingReaderAt{r: bytes.NewReader(data)}
+		if _, ok := probeMedia(ext, r, int64(len(data))); !ok {
+			t.Errorf("probeMedia(%s) failed", ext)
+		}
+		if r.read > 64<<10 {
+			t.Errorf("probeMedia(%s) read %d bytes of %d", ext, r.read, len(data))
+		}
+	}
+}
+
+func TestFileChecker_Check_Media(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  MediaLimit
+		reason Reason
+	}{
+		{
+			name:  "within-limits",
+			limit: MediaLimit{MaxDuration: 2 * time.Minute, MaxTracks: 2, MaxWidth: 1920, AllowedCodecs: []string{"H264", "aac"}},
+		},
+		{
+			name:   "too-long",
+			limit:  MediaLimit{MaxDuration: time.Minute},
+			reason: ReasonTooLong,
+		},
+		{
+			name:   "too-many-tracks",
+			limit:  MediaLimit{MaxTracks: 1},
+			reason: ReasonTooManyTracks,
+		},
+		{
+			name:   "resolution-too-large",
+			limit:  MediaLimit{MaxWidth: 1280, MaxHeight: 720},
+			reason: ReasonResolutionTooLarge,
+		},
+		{
+			name:   "codec-not-allowed",
+			limit:  MediaLimit{AllowedCodecs: []string{"h264"}},
+			reason: ReasonCodecNotAllowed,
+		},
+	}
+
+	mpFileHeader, err := getMultipartFileHeaderFromBytes("movie.mp4", testMP4())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := GetFileChecker(mpFileHeader)
+			fc.SetExtensions([]string{ExtVideoMP4})
+			fc.SetPolicy(Policy{Media: map[string]MediaLimit{ExtVideoMP4: tt.limit}})
+
+			got := fc.Check()
+			if got.Reason != tt.reason || got.Authorised != (tt.reason == ReasonNone) {
+				t.Errorf("Check() = %v (%s), want %s", got.Authorised, got.Reason, tt.reason)
+			}
+			if got.Media == nil || got.Media.Duration != 90500*time.Millisecond {
+				t.Errorf("Check() media = %+v", got.Media)
+			}
+		})
+	}
+}
+
+func TestFileChecker_Check_MediaUnknownDuration(t *testing.T) {
+	// a WebM without a duration, its DocType of a one byte size as detection
+	// requires
+	webm := concat(
+		[]byte{0x1A, 0x45, 0xDF, 0xA3, 0x87, 0x42, 0x82, 0x84}, []byte("webm"),
+		ebml(mkvSegment, ebml(mkvInfo, ebml(mkvTimecodeScale, be32(1000000)))),
+	)
+
+	mpFileHeader, err := getMultipartFileHeaderFromBytes("movie.webm", webm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for limit, want := range map[time.Duration]Reason{0: ReasonNone, time.Minute: ReasonTooLong} {
+		fc := GetFileChecker(mpFileHeader)
+		fc.SetExtensions([]string{ExtVideoWEBM})
+		fc.SetPolicy(Policy{Media: map[string]MediaLimit{ExtVideoWEBM: {MaxDuration: limit}}})
+
+		if got := fc.Check(); got.Reason != want {
+			t.Errorf("Check() with MaxDuration %s = %s, want %s", limit, got.Reason, want)
+		}
+	}
+}
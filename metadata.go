@@ -0,0 +1,390 @@
+package filechecker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+var (
+	// ErrNotAuthorised is returned when transforming a file that did not
+	// pass the check.
+	ErrNotAuthorised = errors.New("filechecker: file not authorised")
+
+	// ErrUnsupportedFormat is returned when a transform does not support the
+	// (authorised) format of the file.
+	ErrUnsupportedFormat = errors.New("filechecker: unsupported format")
+
+	// ErrMalformed is returned when a file cannot be parsed for transforming.
+	ErrMalformed = errors.New("filechecker: malformed file")
+)
+
+const (
+	// EXIF tag holding the orientation of the image
+	exifTagOrientation = 0x0112
+
+	// EXIF type of the orientation tag (unsigned 16-bit integer)
+	exifTypeShort = 3
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// StripMetadata returns the (authorised) file with its EXIF, XMP, IPTC and
+// textual metadata removed, pixels untouched. Only JPEG, (A)PNG and WebP files
+// are supported. When keepOrientation is true, the EXIF orientation (if any) is
+// kept so that the image is still displayed the right way up.
+func (fc *FileChecker) StripMetadata(keepOrientation bool) (io.Reader, error) {
+	var (
+		err      error
+		data     []byte
+		stripped []byte
+		verdict  = fc.Check()
+	)
+
+	if !verdict.Authorised {
+		return nil, fmt.Errorf("%w: %s", ErrNotAuthorised, verdict.Reason)
+	}
+
+	if data, err = fc.contents(); err != nil {
+		return nil, err
+	}
+
+	switch verdict.Extension {
+	case ExtImgJPG:
+		stripped, err = stripJPEG(data, keepOrientation)
+	case ExtImgPNG, ExtImgAPNG:
+		stripped, err = stripPNG(data, keepOrientation)
+	case ExtImgWEBP:
+		stripped, err = stripWEBP(data, keepOrientation)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, verdict.Extension)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(stripped), nil
+}
+
+// contents is a private method. Reads the whole file.
+func (fc *FileChecker) contents() ([]byte, error) {
+	if fc.file == nil {
+		return nil, errors.New("filechecker: no file")
+	}
+
+	file, err := fc.open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	return io.ReadAll(file)
+}
+
+// stripJPEG removes APPn segments (except JFIF, ICC profile and Adobe colour
+// information) and comments from a JPEG file. Anything after EOI is dropped.
+func stripJPEG(data []byte, keepOrientation bool) ([]byte, error) {
+	var (
+		out         = bytes.NewBuffer(make([]byte, 0, len(data)))
+		orientation uint16
+		pending     bool
+		i           = 2
+	)
+
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrMalformed
+	}
+	out.Write(data[:2])
+
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, ErrMalformed
+		}
+
+		// skip fill bytes
+		for i < len(data) && data[i] == 0xFF {
+			i++
+		}
+		if i >= len(data) {
+			return nil, ErrMalformed
+		}
+
+		marker := data[i]
+		i++
+
+		// end of image: nothing after it is kept
+		if marker == 0xD9 {
+			out.Write([]byte{0xFF, marker})
+			return out.Bytes(), nil
+		}
+
+		// standalone markers (TEM, RSTn) have no length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out.Write([]byte{0xFF, marker})
+			continue
+		}
+
+		if i+2 > len(data) {
+			return nil, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint16(data[i:]))
+		if length < 2 || i+length > len(data) {
+			return nil, ErrMalformed
+		}
+		segment := data[i-2 : i+length]
+		payload := data[i+2 : i+length]
+		i += length
+
+		if keepOrientation && marker == 0xE1 && bytes.HasPrefix(payload, exifHeader) {
+			if o, found := exifOrientation(payload[len(exifHeader):]); found {
+				orientation, pending = o, true
+			}
+		}
+
+		if !keepJPEGSegment(marker, payload) {
+			continue
+		}
+
+		// JFIF requires APP0 to immediately follow SOI, so the orientation
+		// goes right after it, before anything else
+		if pending && marker != 0xE0 {
+			writeJPEGOrientation(out, orientation)
+			pending = false
+		}
+		out.Write(segment)
+
+		// start of scan: copy entropy-coded data up to the next marker
+		if marker == 0xDA {
+			start := i
+			for i < len(data)-1 {
+				if data[i] == 0xFF && data[i+1] != 0x00 && (data[i+1] < 0xD0 || data[i+1] > 0xD7) {
+					break
+				}
+				i++
+			}
+			if i >= len(data)-1 {
+				return nil, ErrMalformed
+			}
+			out.Write(data[start:i])
+		}
+	}
+
+	return nil, ErrMalformed
+}
+
+// keepJPEGSegment tells whether a JPEG segment carries image data (and is
+// kept) or metadata (and is dropped).
+func keepJPEGSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == 0xE0:
+		return true
+	case marker == 0xE2:
+		return bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case marker == 0xEE:
+		return bytes.HasPrefix(payload, []byte("Adobe"))
+	case marker >= 0xE1 && marker <= 0xEF, marker == 0xFE:
+		return false
+	}
+	return true
+}
+
+// writeJPEGOrientation writes an APP1 segment holding nothing but the
+// orientation.
+func writeJPEGOrientation(out *bytes.Buffer, orientation uint16) {
+	payload := append(append([]byte{}, exifHeader...), exifOrientationBlock(orientation)...)
+
+	out.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(out, binary.BigEndian, uint16(len(payload)+2))
+	out.Write(payload)
+}
+
+// stripPNG removes textual (tEXt, zTXt, iTXt), EXIF (eXIf) and time (tIME)
+// chunks from a PNG file.
+func stripPNG(data []byte, keepOrientation bool) ([]byte, error) {
+	var (
+		out         = bytes.NewBuffer(make([]byte, 0, len(data)))
+		orientation uint16
+		found       bool
+		i           = 8
+	)
+
+	if len(data) < 8 || !bytes.Equal(data[:8], pngSignature) {
+		return nil, ErrMalformed
+	}
+	out.Write(data[:8])
+
+	for i < len(data) {
+		if i+12 > len(data) {
+			return nil, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		if length < 0 || i+12+length > len(data) {
+			return nil, ErrMalformed
+		}
+		typ := string(data[i+4 : i+8])
+		chunk := data[i : i+12+length]
+		i += 12 + length
+
+		switch typ {
+		case "eXIf":
+			if keepOrientation && !found {
+				orientation, found = exifOrientation(chunk[8 : 8+length])
+			}
+			continue
+		case "tEXt", "zTXt", "iTXt", "tIME":
+			continue
+		case "IDAT":
+			// eXIf must come before the image data
+			if found {
+				writePNGChunk(out, "eXIf", exifOrientationBlock(orientation))
+				found = false
+			}
+		}
+		out.Write(chunk)
+
+		if typ == "IEND" {
+			return out.Bytes(), nil
+		}
+	}
+
+	return nil, ErrMalformed
+}
+
+var pngSignature = []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
+
+// writePNGChunk writes a PNG chunk (length, type, data, CRC).
+func writePNGChunk(out *bytes.Buffer, typ string, data []byte) {
+	_ = binary.Write(out, binary.BigEndian, uint32(len(data)))
+	out.WriteString(typ)
+	out.Write(data)
+	_ = binary.Write(out, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(typ), data...)))
+}
+
+const (
+	// VP8X flags announcing EXIF and XMP chunks
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// stripWEBP removes EXIF and XMP chunks from a WebP file.
+func stripWEBP(data []byte, keepOrientation bool) ([]byte, error) {
+	var (
+		out         = bytes.NewBuffer(make([]byte, 0, len(data)))
+		orientation uint16
+		found       bool
+		vp8x        = -1
+		i           = 12
+	)
+
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformed
+	}
+	out.Write(data[:12])
+
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		padded := size + size&1
+		if size < 0 || i+8+size > len(data) {
+			return nil, ErrMalformed
+		}
+		end := i + 8 + padded
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[i:end]
+		i = end
+
+		switch fourCC {
+		case "EXIF":
+			if keepOrientation && !found {
+				payload := bytes.TrimPrefix(chunk[8:8+size], exifHeader)
+				orientation, found = exifOrientation(payload)
+			}
+			continue
+		case "XMP ":
+			continue
+		case "VP8X":
+			vp8x = out.Len()
+		}
+		out.Write(chunk)
+	}
+
+	result := out.Bytes()
+	if vp8x >= 0 && vp8x+8 < len(result) {
+		result[vp8x+8] &^= webpFlagEXIF | webpFlagXMP
+
+		// orientation can only be kept in the extended format
+		if found {
+			block := exifOrientationBlock(orientation)
+			size := make([]byte, 4)
+			binary.LittleEndian.PutUint32(size, uint32(len(block)))
+			result = append(append(append(result, "EXIF"...), size...), block...)
+			result[vp8x+8] |= webpFlagEXIF
+		}
+	}
+
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result, nil
+}
+
+// exifOrientation reads the orientation from an EXIF (TIFF) block.
+func exifOrientation(block []byte) (uint16, bool) {
+	var order binary.ByteOrder
+
+	if len(block) < 8 {
+		return 0, false
+	}
+
+	switch string(block[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	ifd := int(order.Uint32(block[4:]))
+	if ifd < 8 || ifd+2 > len(block) {
+		return 0, false
+	}
+
+	count := int(order.Uint16(block[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(block) {
+			return 0, false
+		}
+		if order.Uint16(block[entry:]) == exifTagOrientation && order.Uint16(block[entry+2:]) == exifTypeShort {
+			orientation := order.Uint16(block[entry+8:])
+			return orientation, orientation >= 1 && orientation <= 8
+		}
+	}
+
+	return 0, false
+}
+
+// exifOrientationBlock builds an EXIF (TIFF) block holding nothing but the
+// orientation.
+func exifOrientationBlock(orientation uint16) []byte {
+	block := []byte{
+		'M', 'M', 0x00, '*', // big endian TIFF header
+		0x00, 0x00, 0x00, 0x08, // offset of IFD0
+		0x00, 0x01, // one entry
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // the entry
+		0x00, 0x00, 0x00, 0x00, // no next IFD
+	}
+
+	binary.BigEndian.PutUint16(block[10:], exifTagOrientation)
+	binary.BigEndian.PutUint16(block[12:], exifTypeShort)
+	binary.BigEndian.PutUint32(block[14:], 1)
+	binary.BigEndian.PutUint16(block[18:], orientation)
+	return block
+}
@@ -0,0 +1,230 @@
+package filechecker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// exifWithOrientation is an EXIF block with the orientation and something
+// looking like a GPS position, which must not survive stripping.
+func exifWithOrientation(orientation uint16) []byte {
+	block := exifOrientationBlock(orientation)
+	return append(block, []byte("GPS 48.8584N 2.2945E")...)
+}
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 8; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 32), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func testJPEG(t *testing.T) []byte {
+	var (
+		buf     bytes.Buffer
+		segment = func(marker byte, payload []byte) []byte {
+			s := []byte{0xFF, marker, 0, 0}
+			binary.BigEndian.PutUint16(s[2:], uint16(len(payload)+2))
+			return append(s, payload...)
+		}
+	)
+
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// SOI, EXIF (APP1), XMP (APP1), IPTC (APP13), comment, rest of the file
+	data := append([]byte{}, buf.Bytes()[:2]...)
+	data = append(data, segment(0xE1, append(append([]byte{}, exifHeader...), exifWithOrientation(6)...))...)
+	data = append(data, segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))...)
+	data = append(data, segment(0xED, []byte("Photoshop 3.0\x008BIM"))...)
+	data = append(data, segment(0xFE, []byte("taken by nadim"))...)
+	return append(data, buf.Bytes()[2:]...)
+}
+
+func testPNG(t *testing.T) []byte {
+	var (
+		buf  bytes.Buffer
+		out  bytes.Buffer
+		data []byte
+	)
+
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	data = buf.Bytes()
+
+	// signature + IHDR, textual and EXIF chunks, rest of the file
+	out.Write(data[:8+12+13])
+	writePNGChunk(&out, "tEXt", []byte("Author\x00nadim"))
+	writePNGChunk(&out, "eXIf", exifWithOrientation(3))
+	writePNGChunk(&out, "tIME", []byte{0x07, 0xE6, 1, 1, 0, 0, 0})
+	out.Write(data[8+12+13:])
+	return out.Bytes()
+}
+
+func testWEBP() []byte {
+	var (
+		out   bytes.Buffer
+		chunk = func(fourCC string, payload []byte) {
+			out.WriteString(fourCC)
+			_ = binary.Write(&out, binary.LittleEndian, uint32(len(payload)))
+			out.Write(payload)
+			if len(payload)&1 == 1 {
+				out.WriteByte(0)
+			}
+		}
+	)
+
+	out.WriteString("RIFF\x00\x00\x00\x00WEBP")
+	chunk("VP8X", []byte{webpFlagEXIF | webpFlagXMP, 0, 0, 0, 15, 0, 0, 7, 0, 0})
+	chunk("VP8L", []byte{0x2F, 0x0F, 0xC0, 0x01, 0x00})
+	chunk("EXIF", exifWithOrientation(8))
+	chunk("XMP ", []byte("<x:xmpmeta/>"))
+
+	data := out.Bytes()
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+func stripped(t *testing.T, filename string, data []byte, keepOrientation bool) []byte {
+	mpFileHeader, err := getMultipartFileHeaderFromBytes(filename, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc := GetFileChecker(mpFileHeader)
+	fc.SetExtensions([]string{ExtImgWEBP})
+
+	r, err := fc.StripMetadata(keepOrientation)
+	if err != nil {
+		t.Fatalf("StripMetadata() error = %v", err)
+	}
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestFileChecker_StripMetadata_JPG(t *testing.T) {
+	data := testJPEG(t)
+
+	for _, keepOrientation := range []bool{false, true} {
+		out := stripped(t, "photo.jpg", data, keepOrientation)
+
+		for _, leak := range []string{"GPS", "xmpmeta", "Photoshop", "nadim"} {
+			if bytes.Contains(out, []byte(leak)) {
+				t.Errorf("StripMetadata(%v) kept %q", keepOrientation, leak)
+			}
+		}
+
+		before, _ := jpeg.Decode(bytes.NewReader(data))
+		after, err := jpeg.Decode(bytes.NewReader(out))
+		if err != nil || !reflect.DeepEqual(before, after) {
+			t.Errorf("StripMetadata(%v) altered pixels (err: %v)", keepOrientation, err)
+		}
+
+		i := bytes.Index(out, exifHeader)
+		if keepOrientation {
+			if o, found := exifOrientation(out[i+len(exifHeader):]); i < 0 || !found || o != 6 {
+				t.Errorf("StripMetadata(true) orientation = %d, want 6", o)
+			}
+		} else if i >= 0 {
+			t.Errorf("StripMetadata(false) kept EXIF")
+		}
+	}
+}
+
+func TestFileChecker_StripMetadata_PNG(t *testing.T) {
+	data := testPNG(t)
+
+	for _, keepOrientation := range []bool{false, true} {
+		out := stripped(t, "photo.png", data, keepOrientation)
+
+		for _, leak := range []string{"GPS", "tEXt", "tIME", "nadim"} {
+			if bytes.Contains(out, []byte(leak)) {
+				t.Errorf("StripMetadata(%v) kept %q", keepOrientation, leak)
+			}
+		}
+
+		before, _ := png.Decode(bytes.NewReader(data))
+		after, err := png.Decode(bytes.NewReader(out))
+		if err != nil || !reflect.DeepEqual(before, after) {
+			t.Errorf("StripMetadata(%v) altered pixels (err: %v)", keepOrientation, err)
+		}
+
+		i := bytes.Index(out, []byte("eXIf"))
+		if keepOrientation {
+			if o, found := exifOrientation(out[i+4:]); i < 0 || !found || o != 3 {
+				t.Errorf("StripMetadata(true) orientation = %d, want 3", o)
+			}
+		} else if i >= 0 {
+			t.Errorf("StripMetadata(false) kept eXIf")
+		}
+	}
+}
+
+func TestFileChecker_StripMetadata_WEBP(t *testing.T) {
+	data := testWEBP()
+
+	t.Run("strip", func(t *testing.T) {
+		out := stripped(t, "photo.webp", data, false)
+
+		if bytes.Contains(out, []byte("EXIF")) || bytes.Contains(out, []byte("XMP ")) {
+			t.Errorf("StripMetadata(false) kept metadata chunks")
+		}
+		if flags := out[20]; flags&(webpFlagEXIF|webpFlagXMP) != 0 {
+			t.Errorf("StripMetadata(false) VP8X flags = %#x", flags)
+		}
+		if size := binary.LittleEndian.Uint32(out[4:]); int(size) != len(out)-8 {
+			t.Errorf("StripMetadata(false) RIFF size = %d, want %d", size, len(out)-8)
+		}
+	})
+
+	t.Run("keep-orientation", func(t *testing.T) {
+		out := stripped(t, "photo.webp", data, true)
+
+		if bytes.Contains(out, []byte("GPS")) || bytes.Contains(out, []byte("XMP ")) {
+			t.Errorf("StripMetadata(true) kept metadata")
+		}
+		if flags := out[20]; flags != webpFlagEXIF {
+			t.Errorf("StripMetadata(true) VP8X flags = %#x, want %#x", flags, webpFlagEXIF)
+		}
+
+		i := bytes.Index(out, []byte("EXIF"))
+		if o, found := exifOrientation(out[i+8:]); i < 0 || !found || o != 8 {
+			t.Errorf("StripMetadata(true) orientation = %d, want 8", o)
+		}
+	})
+}
+
+func TestFileChecker_StripMetadata_Errors(t *testing.T) {
+	// not authorised
+	mpFileHeader, err := getMultipartFileHeader(fakePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetFileChecker(mpFileHeader).StripMetadata(false); err == nil {
+		t.Errorf("StripMetadata() on fake file: expected error")
+	}
+
+	// authorised, but not an image
+	if mpFileHeader, err = getMultipartFileHeader(pdfPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetFileChecker(mpFileHeader).StripMetadata(false); err == nil {
+		t.Errorf("StripMetadata() on PDF: expected error")
+	}
+}
@@ -0,0 +1,250 @@
+package filechecker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+const (
+	// bytes of multipart bodies kept in memory by default, the rest is
+	// stored on disk
+	defaultMaxMemory = 32 << 20
+
+	// prefix of the type URIs of problems, followed by the reason
+	problemTypePrefix = "urn:filechecker:"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// ErrBodyTooLarge is returned reading bodies past the limit of MaxBodyReader.
+var ErrBodyTooLarge = errors.New("filechecker: request body too large")
+
+// contextKey is the type of the keys of values stored by the middleware in
+// request contexts.
+type contextKey int
+
+// keys of the form report and of the quarantine metadata (see
+// WithQuarantineMetadata) in request contexts
+const (
+	reportKey contextKey = iota
+	quarantineMetadataKey
+)
+
+// MiddlewareOptions configures the middleware.
+type MiddlewareOptions struct {
+	// policy of the files of every field when Fields is empty, ignored
+	// otherwise: files of fields not in Fields are then rejected
+	// (ReasonUnexpectedField)
+	Policy Policy
+
+	// policies of the files of given fields (e.g. "avatar")
+	Fields map[string]Policy
+
+	// bytes of the body kept in memory, the rest is stored on disk (32 MiB
+	// by default)
+	MaxMemory int64
+
+	// maximum size of the body, in bytes, no limit if zero
+	MaxBodySize int64
+}
+
+// Problem is an RFC 7807 problem detail, sent when uploads are rejected.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	// extension members: why the upload was rejected, and the report of
+	// every field
+	Reason Reason                  `json:"reason"`
+	Fields map[string]*FieldReport `json:"fields,omitempty"`
+}
+
+// Middleware returns an http.Handler middleware checking the files of
+// multipart requests before the inner handler runs. Rejected uploads are
+// answered with a problem+json error; authorised ones reach the handler with
+// the parsed form (r.MultipartForm) and the report in the context (see
+// ReportFromContext). Other requests go through untouched.
+func Middleware(options MiddlewareOptions) func(http.Handler) http.Handler {
+	if options.MaxMemory <= 0 {
+		options.MaxMemory = defaultMaxMemory
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !IsMultipart(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if options.MaxBodySize > 0 {
+				r.Body = MaxBodyReader(r.Body, options.MaxBodySize)
+			}
+
+			if err := r.ParseMultipartForm(options.MaxMemory); err != nil {
+				if errors.Is(err, ErrBodyTooLarge) {
+					WriteProblem(w, NewProblem(http.StatusRequestEntityTooLarge, ReasonBodyTooLarge,
+						fmt.Sprintf("body larger than %d bytes", options.MaxBodySize)))
+					return
+				}
+
+				WriteProblem(w, NewProblem(http.StatusBadRequest, ReasonMalformedUpload, err.Error()))
+				return
+			}
+
+			// files stored on disk are removed once answered, the server
+			// only removing those of the form of the request it was given
+			defer func() { _ = r.MultipartForm.RemoveAll() }()
+
+			ctx := WithQuarantineMetadata(r.Context(), RequestMetadata(r))
+			report := CheckFormContext(ctx, r.MultipartForm, options.Policies(r.MultipartForm))
+			if !report.Authorised {
+				WriteProblem(w, report.Problem())
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), reportKey, report)))
+		})
+	}
+}
+
+// RequestMetadata returns the metadata of the request recorded with the
+// files quarantined (see WithQuarantineMetadata): remote address, method,
+// path, user agent and request ID (X-Request-Id), when set. The query is
+// left out, as it may hold credentials (e.g. tokens).
+func RequestMetadata(r *http.Request) map[string]string {
+	metadata := map[string]string{
+		"remote_addr": r.RemoteAddr,
+		"method":      r.Method,
+		"path":        r.URL.Path,
+	}
+	if userAgent := r.UserAgent(); userAgent != "" {
+		metadata["user_agent"] = userAgent
+	}
+	if requestID := r.Header.Get("X-Request-Id"); requestID != "" {
+		metadata["request_id"] = requestID
+	}
+	return metadata
+}
+
+// ReportFromContext returns the report of the files of the request, as
+// stored by the middleware.
+func ReportFromContext(ctx context.Context) (*FormReport, bool) {
+	report, ok := ctx.Value(reportKey).(*FormReport)
+	return report, ok
+}
+
+// NewProblem returns the problem detail of a rejection.
+func NewProblem(status int, reason Reason, detail string) *Problem {
+	return &Problem{
+		Type:   problemTypePrefix + string(reason),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Reason: reason,
+	}
+}
+
+// WriteProblem writes an RFC 7807 problem detail.
+func WriteProblem(w http.ResponseWriter, problem *Problem) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+// Policies returns the policies of the configured fields for CheckForm, or,
+// if there are none, the policy of every file field of the form. Policy is
+// ignored when fields are configured.
+func (options MiddlewareOptions) Policies(form *multipart.Form) map[string]Policy {
+	policies := make(map[string]Policy, len(options.Fields))
+
+	if len(options.Fields) == 0 {
+		for field := range form.File {
+			policies[field] = options.Policy
+		}
+	}
+	for field, policy := range options.Fields {
+		policies[field] = policy
+	}
+	return policies
+}
+
+// Problem returns the problem detail of a rejected form: too large when sizes
+// are at fault, unprocessable otherwise. The reason is the one of the first
+// rejected field (or file).
+func (r *FormReport) Problem() *Problem {
+	var (
+		rejected = r.Rejected()
+		status   = http.StatusUnprocessableEntity
+		reason   Reason
+	)
+
+	if len(rejected) == 0 {
+		return nil
+	}
+
+	field := r.Fields[rejected[0]]
+	if reason = field.Reason; field.Reason == ReasonFileRejected {
+		for _, verdict := range field.Files {
+			if !verdict.Authorised {
+				reason = verdict.Reason
+				break
+			}
+		}
+	}
+
+	switch reason {
+	case ReasonTooLarge, ReasonTotalTooLarge:
+		status = http.StatusRequestEntityTooLarge
+	}
+
+	problem := NewProblem(status, reason, "rejected fields: "+strings.Join(rejected, ", "))
+	problem.Fields = r.Fields
+	return problem
+}
+
+// IsMultipart tells whether the request has a multipart/form-data body.
+func IsMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// MaxBodyReader limits the body of a request to n bytes: reads past the limit
+// fail with ErrBodyTooLarge.
+func MaxBodyReader(body io.ReadCloser, n int64) io.ReadCloser {
+	return &maxBodyReader{ReadCloser: body, left: n}
+}
+
+// maxBodyReader is the reader of MaxBodyReader.
+type maxBodyReader struct {
+	io.ReadCloser
+	left int64
+}
+
+// Read reads one byte more than left, to tell whether the body is larger.
+func (b *maxBodyReader) Read(p []byte) (int, error) {
+	if b.left < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.left {
+		n, b.left = int(b.left), -1
+		return n, ErrBodyTooLarge
+	}
+	b.left -= int64(n)
+	return n, err
+}
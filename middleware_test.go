@@ -0,0 +1,185 @@
+package filechecker
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testMultipartRequest(t *testing.T, files ...formFile) *http.Request {
+	var (
+		body   = new(bytes.Buffer)
+		writer = multipart.NewWriter(body)
+	)
+
+	for _, file := range files {
+		w, err := writer.CreateFormFile(file.field, file.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(file.data)
+	}
+	_ = writer.WriteField("name", "value")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	return r
+}
+
+//nolint:funlen
+func TestMiddleware(t *testing.T) {
+	var (
+		png = testPNG(t)
+		gif = testGIF(t, 1)
+	)
+
+	tests := []struct {
+		name    string
+		options MiddlewareOptions
+		request *http.Request
+		status  int
+		reason  Reason
+	}{
+		{
+			name:    "authorised",
+			request: testMultipartRequest(t, formFile{"avatar", "me.png", png}),
+			status:  http.StatusOK,
+		},
+		{
+			name:    "per-field-policy",
+			options: MiddlewareOptions{Fields: map[string]Policy{"avatar": {}, "animation": {SetExtensions: []string{ExtImgGIF}}}},
+			request: testMultipartRequest(t, formFile{"avatar", "me.png", png}, formFile{"animation", "a.gif", gif}),
+			status:  http.StatusOK,
+		},
+		{
+			name:    "unexpected-field",
+			options: MiddlewareOptions{Fields: map[string]Policy{"animation": {SetExtensions: []string{ExtImgGIF}}}},
+			request: testMultipartRequest(t, formFile{"avatar", "me.png", png}, formFile{"animation", "a.gif", gif}),
+			status:  http.StatusUnprocessableEntity,
+			reason:  ReasonUnexpectedField,
+		},
+		{
+			name:    "file-rejected",
+			request: testMultipartRequest(t, formFile{"avatar", "me.png", png}, formFile{"animation", "a.gif", gif}),
+			status:  http.StatusUnprocessableEntity,
+			reason:  ReasonExtensionNotAuthorised,
+		},
+		{
+			name:    "missing-field",
+			options: MiddlewareOptions{Fields: map[string]Policy{"avatar": {}, "cv": {MinFiles: 1}}},
+			request: testMultipartRequest(t, formFile{"avatar", "me.png", png}),
+			status:  http.StatusUnprocessableEntity,
+			reason:  ReasonTooFewFiles,
+		},
+		{
+			name:    "file-too-large",
+			options: MiddlewareOptions{Policy: Policy{MaxFileSize: 16}},
+			request: testMultipartRequest(t, formFile{"avatar", "me.png", png}),
+			status:  http.StatusRequestEntityTooLarge,
+			reason:  ReasonTooLarge,
+		},
+		{
+			name:    "body-too-large",
+			options: MiddlewareOptions{MaxBodySize: 64},
+			request: testMultipartRequest(t, formFile{"avatar", "me.png", png}),
+			status:  http.StatusRequestEntityTooLarge,
+			reason:  ReasonBodyTooLarge,
+		},
+		{
+			name: "malformed",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("--nope\r\n"))
+				r.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+				return r
+			}(),
+			status: http.StatusBadRequest,
+			reason: ReasonMalformedUpload,
+		},
+		{
+			name:    "not-multipart",
+			request: httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(`{"a":1}`)),
+			status:  http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				reached bool
+				w       = httptest.NewRecorder()
+				next    = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					reached = true
+					if report, ok := ReportFromContext(r.Context()); IsMultipart(r) && (!ok || !report.Authorised) {
+						t.Errorf("ReportFromContext() = %+v, %v", report, ok)
+					}
+				})
+			)
+
+			Middleware(tt.options)(next).ServeHTTP(w, tt.request)
+
+			if w.Code != tt.status || reached != (tt.status == http.StatusOK) {
+				t.Fatalf("status = %d (handler reached: %v), want %d", w.Code, reached, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+
+			var problem Problem
+			if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+				t.Fatal(err)
+			}
+
+			if w.Header().Get("Content-Type") != ProblemContentType || problem.Status != tt.status ||
+				problem.Reason != tt.reason || problem.Type != problemTypePrefix+string(tt.reason) || problem.Title == "" {
+				t.Errorf("problem = %+v (%s), want %s", problem, w.Header().Get("Content-Type"), tt.reason)
+			}
+		})
+	}
+}
+
+func TestMiddleware_RemovesFiles(t *testing.T) {
+	// files of multipart bodies are stored in the temporary directory
+	dir := t.TempDir()
+	defer func(tmp string) { _ = os.Setenv("TMPDIR", tmp) }(os.Getenv("TMPDIR"))
+	if err := os.Setenv("TMPDIR", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, file := range map[string]formFile{
+		"authorised": {"avatar", "me.png", testPNG(t)},
+		"rejected":   {"avatar", "a.gif", testGIF(t, 1)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var (
+				stored int
+				next   = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					entries, _ := os.ReadDir(dir)
+					stored = len(entries)
+				})
+			)
+
+			Middleware(MiddlewareOptions{MaxMemory: 1})(next).ServeHTTP(httptest.NewRecorder(), testMultipartRequest(t, file))
+
+			if entries, err := os.ReadDir(dir); err != nil || len(entries) > 0 {
+				t.Errorf("files left behind: %d (%v)", len(entries), err)
+			}
+			if name == "authorised" && stored == 0 {
+				t.Error("files removed before the handler ran")
+			}
+		})
+	}
+}
+
+func TestReportFromContext(t *testing.T) {
+	if report, ok := ReportFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); ok || report != nil {
+		t.Errorf("ReportFromContext() = %+v, %v, want nothing", report, ok)
+	}
+}
@@ -0,0 +1,180 @@
+package filechecker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// errStageOver is returned to scanners reading the file once their stage is
+// over (e.g. past its timeout).
+var errStageOver = errors.New("filechecker: stage over, file closed")
+
+// Stage is a stage of a Pipeline: independent scanners, run in parallel.
+type Stage struct {
+	Scanners []Scanner
+
+	// maximum duration of the stage, unlimited if zero. Scanners still
+	// running then fail with context.DeadlineExceeded.
+	Timeout time.Duration
+}
+
+// Pipeline runs stages of scanners in order, stopping after the first stage
+// rejecting the file (something detected, or a scan failed), so that the
+// stages after it do not run.
+type Pipeline []Stage
+
+// stageResult is the outcome of a scanner of a stage.
+type stageResult struct {
+	index  int
+	result *ScanResult
+}
+
+// Run runs the stages, and returns the results of the scanners that ran, in
+// order.
+func (p Pipeline) Run(ctx context.Context, r io.ReaderAt, size int64) []*ScanResult {
+	var results []*ScanResult
+
+	for _, stage := range p {
+		stageResults := stage.run(ctx, r, size)
+		results = append(results, stageResults...)
+
+		for _, result := range stageResults {
+			if result.Detected || result.Error != "" {
+				return results
+			}
+		}
+	}
+	return results
+}
+
+// run is a private method. Runs the scanners of the stage in parallel, the
+// other ones being cancelled, and left out of the results, once one of them
+// detects something. Scanners ignoring the context are not waited for past
+// the timeout, nor after a detection: they can no longer read the file.
+func (s Stage) run(ctx context.Context, r io.ReaderAt, size int64) []*ScanResult {
+	var (
+		cancel  context.CancelFunc
+		results = make([]*ScanResult, len(s.Scanners))
+		done    = make(chan stageResult, len(s.Scanners))
+		reader  = &stageReader{r: r}
+	)
+
+	defer reader.close()
+	if s.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	for i, scanner := range s.Scanners {
+		go func(i int, scanner Scanner) {
+			done <- stageResult{index: i, result: runScanner(ctx, scanner, reader, size)}
+		}(i, scanner)
+	}
+
+	for pending := len(s.Scanners); pending > 0; pending-- {
+		select {
+		case res := <-done:
+			results[res.index] = res.result
+			if res.result.Detected {
+				return finished(results)
+			}
+		case <-ctx.Done():
+			return s.expired(ctx.Err(), results, done)
+		}
+	}
+	return results
+}
+
+// expired is a private method. Returns the results of the stage once its
+// context is done: results sent in the meantime count, the scanners not done
+// yet failing with the context.
+func (s Stage) expired(err error, results []*ScanResult, done <-chan stageResult) []*ScanResult {
+	for len(done) > 0 {
+		res := <-done
+		results[res.index] = res.result
+		if res.result.Detected {
+			return finished(results)
+		}
+	}
+
+	for i, scanner := range s.Scanners {
+		if results[i] == nil {
+			results[i] = &ScanResult{Scanner: scanner.Name(), Error: err.Error(), err: err}
+		}
+	}
+	return results
+}
+
+// finished returns the results of the scanners that are done, in order.
+func finished(results []*ScanResult) []*ScanResult {
+	done := results[:0]
+	for _, result := range results {
+		if result != nil {
+			done = append(done, result)
+		}
+	}
+	return done
+}
+
+// stageReader is the file as read by the scanners of a stage, which can no
+// longer be read once the stage is over: the file is closed by then.
+type stageReader struct {
+	r      io.ReaderAt
+	mu     sync.RWMutex
+	closed bool
+}
+
+// ReadAt implements io.ReaderAt.
+func (s *stageReader) ReadAt(p []byte, offset int64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return 0, errStageOver
+	}
+	return s.r.ReadAt(p, offset)
+}
+
+// close waits for the reads in progress, and fails those to come.
+func (s *stageReader) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+}
+
+// runScanner runs a scanner, its errors (and panics) being results.
+func runScanner(ctx context.Context, scanner Scanner, r io.ReaderAt, size int64) (result *ScanResult) {
+	defer func() {
+		if v := recover(); v != nil {
+			err := fmt.Errorf("panic: %v", v)
+			result = &ScanResult{Scanner: scanner.Name(), Error: err.Error(), err: err}
+		}
+	}()
+
+	result, err := scanner.Scan(ctx, r, size)
+	switch {
+	case err != nil:
+		result = &ScanResult{Error: err.Error(), err: err}
+	case result == nil:
+		result = &ScanResult{}
+	}
+
+	result.Scanner = scanner.Name()
+	return result
+}
+
+// pipeline is a private method. Returns the pipeline of the policy: its
+// scanners, one stage each, then its stages.
+func (p Policy) pipeline() Pipeline {
+	pipeline := make(Pipeline, 0, len(p.Scanners)+len(p.Pipeline))
+	for _, scanner := range p.Scanners {
+		pipeline = append(pipeline, Stage{Scanners: []Scanner{scanner}})
+	}
+	return append(pipeline, p.Pipeline...)
+}
@@ -0,0 +1,273 @@
+package filechecker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stageScanner is a scanner of pipeline tests, safe for concurrent use.
+type stageScanner struct {
+	name     string
+	detected bool
+	err      error
+	delay    time.Duration
+
+	// whether it ignores its context
+	stubborn bool
+
+	runs int32
+}
+
+func (s *stageScanner) Name() string { return s.name }
+
+func (s *stageScanner) Scan(ctx context.Context, _ io.ReaderAt, _ int64) (*ScanResult, error) {
+	atomic.AddInt32(&s.runs, 1)
+
+	if s.stubborn {
+		time.Sleep(s.delay)
+	} else {
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &ScanResult{Detected: s.detected, Signature: s.name}, nil
+}
+
+func TestPipeline_Run(t *testing.T) {
+	type stage struct {
+		scanners []*stageScanner
+		timeout  time.Duration
+	}
+
+	tests := []struct {
+		name    string
+		stages  []stage
+		results []string
+		errors  int
+		runs    []int32
+	}{
+		{
+			name:    "clean",
+			stages:  []stage{{scanners: []*stageScanner{{name: "a"}, {name: "b"}}}, {scanners: []*stageScanner{{name: "c"}}}},
+			results: []string{"a", "b", "c"},
+			runs:    []int32{1, 1, 1},
+		},
+		{
+			name:    "detected",
+			stages:  []stage{{scanners: []*stageScanner{{name: "a", detected: true}}}, {scanners: []*stageScanner{{name: "b"}}}},
+			results: []string{"a"},
+			runs:    []int32{1, 0},
+		},
+		{
+			name:    "failed",
+			stages:  []stage{{scanners: []*stageScanner{{name: "a", err: errors.New("unreachable")}}}, {scanners: []*stageScanner{{name: "b"}}}},
+			results: []string{"a"},
+			errors:  1,
+			runs:    []int32{1, 0},
+		},
+		{
+			name:    "detected-cancels-stage",
+			stages:  []stage{{scanners: []*stageScanner{{name: "a", detected: true}, {name: "b", delay: time.Minute}}}},
+			results: []string{"a"},
+			runs:    []int32{1, 1},
+		},
+		{
+			name:    "detected-keeps-finished",
+			stages:  []stage{{scanners: []*stageScanner{{name: "a"}, {name: "b", detected: true, delay: 20 * time.Millisecond}, {name: "c", delay: time.Second, stubborn: true}}}},
+			results: []string{"a", "b"},
+			runs:    []int32{1, 1, 1},
+		},
+		{
+			name:    "timeout",
+			stages:  []stage{{scanners: []*stageScanner{{name: "a"}, {name: "b", delay: time.Minute}}, timeout: 20 * time.Millisecond}, {scanners: []*stageScanner{{name: "c"}}}},
+			results: []string{"a", "b"},
+			errors:  1,
+			runs:    []int32{1, 1, 0},
+		},
+		{
+			name:    "timeout-ignored",
+			stages:  []stage{{scanners: []*stageScanner{{name: "a", delay: time.Second, stubborn: true}}, timeout: 20 * time.Millisecond}},
+			results: []string{"a"},
+			errors:  1,
+			runs:    []int32{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				pipeline Pipeline
+				scanners []*stageScanner
+				errs     int
+				start    = time.Now()
+			)
+
+			for _, stage := range tt.stages {
+				var s []Scanner
+				for _, scanner := range stage.scanners {
+					s = append(s, scanner)
+					scanners = append(scanners, scanner)
+				}
+				pipeline = append(pipeline, Stage{Scanners: s, Timeout: stage.timeout})
+			}
+
+			results := pipeline.Run(context.Background(), bytes.NewReader(nil), 0)
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("Run() took %v", elapsed)
+			}
+
+			if len(results) != len(tt.results) {
+				t.Fatalf("Run() = %d results, want %d", len(results), len(tt.results))
+			}
+			for i, result := range results {
+				if result.Scanner != tt.results[i] {
+					t.Errorf("results[%d].Scanner = %q, want %q", i, result.Scanner, tt.results[i])
+				}
+				if result.Error != "" {
+					errs++
+				}
+			}
+			if errs != tt.errors {
+				t.Errorf("Run() = %d errors, want %d", errs, tt.errors)
+			}
+			for i, scanner := range scanners {
+				if runs := atomic.LoadInt32(&scanner.runs); runs != tt.runs[i] {
+					t.Errorf("%s ran %d times, want %d", scanner.name, runs, tt.runs[i])
+				}
+			}
+		})
+	}
+}
+
+// lateScanner reads the file once its delay is over, whatever its context.
+type lateScanner struct {
+	delay time.Duration
+	read  chan error
+}
+
+func (s *lateScanner) Name() string { return "late" }
+
+func (s *lateScanner) Scan(_ context.Context, r io.ReaderAt, _ int64) (*ScanResult, error) {
+	time.Sleep(s.delay)
+	_, err := r.ReadAt(make([]byte, 1), 0)
+	s.read <- err
+	return &ScanResult{}, nil
+}
+
+func TestStage_run_Abandoned(t *testing.T) {
+	scanner := &lateScanner{delay: 50 * time.Millisecond, read: make(chan error, 1)}
+
+	stage := Stage{Scanners: []Scanner{scanner}, Timeout: 10 * time.Millisecond}
+	if results := stage.run(context.Background(), bytes.NewReader([]byte("data")), 4); len(results) != 1 || results[0].Error == "" {
+		t.Fatalf("run() = %+v, want a timeout", results)
+	}
+
+	// the file is no longer read once the stage is over
+	if err := <-scanner.read; !errors.Is(err, errStageOver) {
+		t.Errorf("ReadAt() = %v, want %v", err, errStageOver)
+	}
+}
+
+func TestStage_expired(t *testing.T) {
+	var (
+		stage = Stage{Scanners: []Scanner{&stageScanner{name: "a"}, &stageScanner{name: "b"}, &stageScanner{name: "c"}}}
+		clean = &ScanResult{Scanner: "b"}
+		found = &ScanResult{Scanner: "b", Detected: true}
+	)
+
+	tests := []struct {
+		name string
+		sent *ScanResult
+		want []string
+	}{
+		{name: "clean", sent: clean, want: []string{context.DeadlineExceeded.Error(), "", context.DeadlineExceeded.Error()}},
+		{name: "detected", sent: found, want: []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the result of b was sent as the context expired
+			done := make(chan stageResult, len(stage.Scanners))
+			done <- stageResult{index: 1, result: tt.sent}
+
+			results := stage.expired(context.DeadlineExceeded, make([]*ScanResult, len(stage.Scanners)), done)
+			if len(results) != len(tt.want) {
+				t.Fatalf("expired() = %+v, want %d results", results, len(tt.want))
+			}
+			for i, result := range results {
+				if result.Error != tt.want[i] || (result.Scanner == "b") != (result == tt.sent) {
+					t.Errorf("expired()[%d] = %+v, want error %q", i, result, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFileChecker_Check_Pipeline(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline Pipeline
+		reason   Reason
+		err      error
+		scans    int
+	}{
+		{
+			name:     "clean",
+			pipeline: Pipeline{{Scanners: []Scanner{&stageScanner{name: "a"}, &stageScanner{name: "b"}}}},
+			scans:    2,
+		},
+		{
+			name:     "detected-wins",
+			pipeline: Pipeline{{Scanners: []Scanner{&stageScanner{name: "a", err: errors.New("unreachable")}, &stageScanner{name: "b", detected: true, delay: 20 * time.Millisecond}}}},
+			reason:   ReasonMalware,
+			scans:    2,
+		},
+		{
+			name:     "timeout",
+			pipeline: Pipeline{{Scanners: []Scanner{&stageScanner{name: "a", delay: time.Minute}}, Timeout: 20 * time.Millisecond}},
+			reason:   ReasonScanFailed,
+			err:      context.DeadlineExceeded,
+			scans:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := GetFileChecker(getMultipartFileHeaderOrFail(t, pngPath))
+			fc.SetPolicy(Policy{Pipeline: tt.pipeline})
+
+			verdict := fc.Check()
+			if verdict.Reason != tt.reason || len(verdict.Scans) != tt.scans {
+				t.Errorf("Check() = %+v, want %q", verdict, tt.reason)
+			}
+			if tt.err != nil && !errors.Is(verdict.Err, tt.err) {
+				t.Errorf("Check().Err = %v, want %v", verdict.Err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPolicy_pipeline(t *testing.T) {
+	var (
+		a = &stageScanner{name: "a"}
+		b = &stageScanner{name: "b"}
+		c = &stageScanner{name: "c"}
+	)
+
+	// scanners run first, one stage each
+	pipeline := Policy{Scanners: []Scanner{a, b}, Pipeline: Pipeline{{Scanners: []Scanner{c}}}}.pipeline()
+	if len(pipeline) != 3 || pipeline[0].Scanners[0] != a || pipeline[1].Scanners[0] != b || pipeline[2].Scanners[0] != c {
+		t.Errorf("pipeline() = %+v", pipeline)
+	}
+}
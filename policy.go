@@ -0,0 +1,73 @@
+package filechecker
+
+// Policy gathers the rules applied when checking a file, on top of the
+// authorised types and extensions.
+type Policy struct {
+	// extensions authorised (see SetExtensions) and unauthorised (see
+	// UnsetExtensions) when the policy is set
+	SetExtensions   []string `json:"set_extensions,omitempty"`
+	UnsetExtensions []string `json:"unset_extensions,omitempty"`
+
+	// maximum size of the file, in bytes
+	MaxFileSize int64 `json:"max_file_size,omitempty"`
+
+	// number of files, and maximum size of all of them, in bytes, when
+	// checking the files of a form field (see CheckForm)
+	MinFiles     int   `json:"min_files,omitempty"`
+	MaxFiles     int   `json:"max_files,omitempty"`
+	MaxTotalSize int64 `json:"max_total_size,omitempty"`
+
+	// kinds of executable content (e.g. ExecELF, ExecJAR) that are not
+	// rejected outright. They still have to be of an authorised type.
+	AllowExecutables []string `json:"allow_executables,omitempty"`
+
+	// limits for animated and multi-frame images, by extension (e.g.
+	// Frames[ExtImgGIF]). Extensions without limits are not inspected.
+	Frames map[string]FrameLimit `json:"frames,omitempty"`
+
+	// limits for audio and video files, by extension (e.g.
+	// Media[ExtVideoMP4]). Extensions without limits are not probed.
+	Media map[string]MediaLimit `json:"media,omitempty"`
+
+	// detectors telling the type of the file, chained (see Chain) in the
+	// given mode. They take precedence over the detector of the FileChecker.
+	Detectors    []Detector `json:"-"`
+	DetectorMode ChainMode  `json:"detector_mode,omitempty"`
+
+	// bytes of the file read for detectors to peek at, 4 KiB by default (1 MiB
+	// at most). Detectors may read ranges past it.
+	SniffWindow int `json:"sniff_window,omitempty"`
+
+	// scanners of the content of files otherwise authorised (e.g.
+	// clamav.Client), run in order until one of them detects something or
+	// fails, then the stages of the pipeline (see Pipeline)
+	Scanners []Scanner `json:"-"`
+	Pipeline Pipeline  `json:"-"`
+
+	// whether the digests of the file are computed (see Verdict.Hashes),
+	// which they are anyway when lists are set. Files of the deny list are
+	// rejected; those of the allow list are still checked for their type,
+	// but not inspected further (frames, media, scanners).
+	Hashes    bool      `json:"hashes,omitempty"`
+	DenyList  *HashList `json:"-"`
+	AllowList *HashList `json:"-"`
+
+	// store of the rejected files, kept for investigation with their
+	// verdict (see QuarantineStore), and the reasons of those quarantined,
+	// all of them if empty. Files that could not be read are not.
+	Quarantine        QuarantineStore `json:"-"`
+	QuarantineReasons []Reason        `json:"quarantine_reasons,omitempty"`
+}
+
+// SetPolicy sets the policy applied when checking the file, authorising and
+// unauthorising its extensions.
+func (fc *FileChecker) SetPolicy(policy Policy) {
+	fc.policy = policy
+
+	if len(policy.SetExtensions) > 0 {
+		fc.SetExtensions(policy.SetExtensions)
+	}
+	if len(policy.UnsetExtensions) > 0 {
+		fc.UnsetExtensions(policy.UnsetExtensions)
+	}
+}
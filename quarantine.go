@@ -0,0 +1,339 @@
+package filechecker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// extensions of the files of quarantine records: content and JSON sidecar
+const (
+	quarantineContentExt = ".bin"
+	quarantineRecordExt  = ".json"
+)
+
+// ErrQuarantineNotFound is returned for unknown quarantine records.
+var ErrQuarantineNotFound = errors.New("filechecker: quarantine record not found")
+
+// QuarantineRecord describes a file kept in quarantine.
+type QuarantineRecord struct {
+	// identifier and time of the record, set by the store
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+
+	// original filename and size, as uploaded
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+
+	// digests of the content, computed by the store if the verdict has none
+	Hashes *Hashes `json:"hashes,omitempty"`
+
+	// why the file was rejected, and the underlying error, if any
+	Verdict *Verdict `json:"verdict"`
+	Error   string   `json:"error,omitempty"`
+
+	// metadata of the request the file came with (e.g. remote address,
+	// form field), see WithQuarantineMetadata
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// QuarantineStore keeps rejected files (see Policy.Quarantine), for
+// investigation.
+type QuarantineStore interface {
+	// Put stores the content of the file and its record, setting the
+	// identifier, time and digests of the record.
+	Put(ctx context.Context, record *QuarantineRecord, content io.Reader) error
+
+	// Cleanup removes the records older than the retention, and returns
+	// how many were.
+	Cleanup(ctx context.Context, retention time.Duration) (int, error)
+}
+
+// WithQuarantineMetadata returns a context holding metadata of the request
+// (e.g. remote address, user), added to those of ctx, and recorded with the
+// files quarantined when checked with it.
+func WithQuarantineMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	merged := make(map[string]string)
+	for key, value := range quarantineMetadata(ctx) {
+		merged[key] = value
+	}
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, quarantineMetadataKey, merged)
+}
+
+// quarantineMetadata returns the metadata of the context.
+func quarantineMetadata(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(quarantineMetadataKey).(map[string]string)
+	return metadata
+}
+
+// quarantine is a private method. Puts the rejected file in the quarantine
+// of the policy, if any and if the reason is among those quarantined. Files
+// that were not read (missing, too large, unreadable) are not.
+func (fc *FileChecker) quarantine(ctx context.Context, verdict *Verdict, r io.ReaderAt) {
+	var store = fc.policy.Quarantine
+
+	switch {
+	case store == nil || verdict.Authorised:
+		return
+	case verdict.Reason == ReasonNoFile || verdict.Reason == ReasonTooLarge || verdict.Reason == ReasonUnreadable:
+		return
+	case len(fc.policy.QuarantineReasons) > 0 && !containsReason(fc.policy.QuarantineReasons, verdict.Reason):
+		return
+	}
+
+	record := &QuarantineRecord{
+		Filename: verdict.Filename,
+		Size:     verdict.Size,
+		Hashes:   verdict.Hashes,
+		Verdict:  verdict,
+		Metadata: quarantineMetadata(ctx),
+	}
+	if verdict.Err != nil {
+		record.Error = verdict.Err.Error()
+	}
+
+	if err := store.Put(ctx, record, io.NewSectionReader(r, 0, verdict.Size)); err != nil {
+		if verdict.Err == nil {
+			verdict.Err = fmt.Errorf("quarantine: %w", err)
+		}
+		return
+	}
+	verdict.Quarantined = record.ID
+}
+
+// RunQuarantineCleanup removes the records of the store older than the
+// retention, every interval, until the context is done.
+func RunQuarantineCleanup(ctx context.Context, store QuarantineStore, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, _ = store.Cleanup(ctx, retention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FSQuarantine is a QuarantineStore keeping files in a directory: the
+// content of each file (<id>.bin, readable by the owner only) and its record
+// (<id>.json).
+type FSQuarantine struct {
+	Dir string
+}
+
+// NewFSQuarantine returns a store keeping files in the directory, created if
+// needed.
+func NewFSQuarantine(dir string) (*FSQuarantine, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FSQuarantine{Dir: dir}, nil
+}
+
+// Put implements QuarantineStore. The record is written last, once the
+// content is complete.
+func (q *FSQuarantine) Put(ctx context.Context, record *QuarantineRecord, content io.Reader) error {
+	var (
+		err    error
+		tmp    *os.File
+		hashes = newHasher()
+	)
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	if record.ID, err = newQuarantineID(); err != nil {
+		return err
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+
+	if tmp, err = os.CreateTemp(q.Dir, ".tmp-*"); err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	_, err = io.Copy(io.MultiWriter(tmp, hashes), content)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), q.path(record.ID, quarantineContentExt)); err != nil {
+		return err
+	}
+
+	if record.Hashes == nil {
+		record.Hashes = hashes.Hashes()
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(q.path(record.ID, quarantineRecordExt), data)
+}
+
+// Get returns the record of the identifier.
+func (q *FSQuarantine) Get(id string) (*QuarantineRecord, error) {
+	var record QuarantineRecord
+
+	if !validQuarantineID(id) {
+		return nil, ErrQuarantineNotFound
+	}
+
+	data, err := os.ReadFile(q.path(id, quarantineRecordExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrQuarantineNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Open opens the content of the file of the identifier.
+func (q *FSQuarantine) Open(id string) (*os.File, error) {
+	if !validQuarantineID(id) {
+		return nil, ErrQuarantineNotFound
+	}
+
+	file, err := os.Open(q.path(id, quarantineContentExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrQuarantineNotFound
+	}
+	return file, err
+}
+
+// Cleanup implements QuarantineStore. Files left over by interrupted puts
+// are removed too, once older than the retention.
+func (q *FSQuarantine) Cleanup(ctx context.Context, retention time.Duration) (int, error) {
+	var (
+		removed int
+		before  = time.Now().Add(-retention)
+	)
+
+	entries, err := os.ReadDir(q.Dir)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		if err = ctx.Err(); err != nil {
+			return removed, err
+		}
+
+		var (
+			name = entry.Name()
+			id   = strings.TrimSuffix(name, filepath.Ext(name))
+		)
+
+		switch {
+		case filepath.Ext(name) == quarantineRecordExt:
+			record, err := q.Get(id)
+			if err != nil || !record.Time.Before(before) {
+				continue
+			}
+			if err = os.Remove(q.path(id, quarantineContentExt)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return removed, err
+			}
+			if err = os.Remove(q.path(id, quarantineRecordExt)); err != nil {
+				return removed, err
+			}
+			removed++
+		case strings.HasPrefix(name, ".tmp-"):
+			removeBefore(filepath.Join(q.Dir, name), entry, before)
+		case filepath.Ext(name) == quarantineContentExt:
+			// content without record
+			if _, err := os.Stat(q.path(id, quarantineRecordExt)); errors.Is(err, os.ErrNotExist) {
+				removeBefore(filepath.Join(q.Dir, name), entry, before)
+			}
+		}
+	}
+	return removed, nil
+}
+
+// removeBefore removes the file of the entry if modified before the time.
+func removeBefore(name string, entry os.DirEntry, before time.Time) {
+	if info, err := entry.Info(); err == nil && info.ModTime().Before(before) {
+		_ = os.Remove(name)
+	}
+}
+
+// path returns the path of a file of a record.
+func (q *FSQuarantine) path(id, ext string) string {
+	return filepath.Join(q.Dir, id+ext)
+}
+
+// newQuarantineID returns a new identifier of record, sorting by time.
+func newQuarantineID() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(random), nil
+}
+
+// validQuarantineID tells whether the identifier is one of newQuarantineID,
+// so that it cannot name files out of the directory.
+func validQuarantineID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// writeFileAtomic writes the file through a temporary file, so that it is
+// complete once it exists.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// containsReason tells whether the reason is among the reasons.
+func containsReason(reasons []Reason, reason Reason) bool {
+	for _, r := range reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package filechecker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingQuarantine is a store failing to put files.
+type failingQuarantine struct{}
+
+func (failingQuarantine) Put(context.Context, *QuarantineRecord, io.Reader) error {
+	return errors.New("disk full")
+}
+
+func (failingQuarantine) Cleanup(context.Context, time.Duration) (int, error) { return 0, nil }
+
+func TestFSQuarantine_Put(t *testing.T) {
+	store, err := NewFSQuarantine(filepath.Join(t.TempDir(), "quarantine"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := &QuarantineRecord{
+		Filename: "evil.exe",
+		Size:     7,
+		Verdict:  &Verdict{Reason: ReasonExecutable, Filename: "evil.exe", Size: 7},
+		Metadata: map[string]string{"field": "avatar"},
+	}
+	if err = store.Put(context.Background(), record, strings.NewReader("MZ evil")); err != nil {
+		t.Fatal(err)
+	}
+	if record.ID == "" || record.Time.IsZero() || record.Hashes == nil || record.Hashes.SHA256 == "" {
+		t.Fatalf("Put() record = %+v, want ID, time and hashes set", record)
+	}
+
+	got, err := store.Get(record.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Filename != "evil.exe" || got.Verdict.Reason != ReasonExecutable || got.Metadata["field"] != "avatar" || *got.Hashes != *record.Hashes {
+		t.Errorf("Get() = %+v, want %+v", got, record)
+	}
+
+	file, err := store.Open(record.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if data, _ := io.ReadAll(file); string(data) != "MZ evil" {
+		t.Errorf("Open() = %q, want the content", data)
+	}
+	if info, err := file.Stat(); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Open() mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	for _, id := range []string{"missing", "../quarantine", ""} {
+		if _, err = store.Get(id); !errors.Is(err, ErrQuarantineNotFound) {
+			t.Errorf("Get(%q) = %v, want ErrQuarantineNotFound", id, err)
+		}
+		if _, err = store.Open(id); !errors.Is(err, ErrQuarantineNotFound) {
+			t.Errorf("Open(%q) = %v, want ErrQuarantineNotFound", id, err)
+		}
+	}
+}
+
+func TestFSQuarantine_Cleanup(t *testing.T) {
+	var (
+		dir = t.TempDir()
+		old = time.Now().Add(-48 * time.Hour)
+		ctx = context.Background()
+	)
+
+	store, err := NewFSQuarantine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := &QuarantineRecord{Time: old, Verdict: &Verdict{}}
+	recent := &QuarantineRecord{Verdict: &Verdict{}}
+	for _, record := range []*QuarantineRecord{expired, recent} {
+		if err = store.Put(ctx, record, strings.NewReader("content")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// left over by interrupted puts
+	for _, name := range []string{".tmp-1", "orphan.bin", ".tmp-2"} {
+		if err = os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{".tmp-1", "orphan.bin"} {
+		if err = os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := store.Cleanup(ctx, 24*time.Hour)
+	if err != nil || removed != 1 {
+		t.Fatalf("Cleanup() = %d, %v, want 1", removed, err)
+	}
+
+	if _, err = store.Get(expired.ID); !errors.Is(err, ErrQuarantineNotFound) {
+		t.Errorf("Get(expired) = %v, want ErrQuarantineNotFound", err)
+	}
+	if _, err = store.Open(recent.ID); err != nil {
+		t.Errorf("Open(recent) = %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{".tmp-2", recent.ID + ".bin", recent.ID + ".json"}; strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %v, want %v", names, want)
+	}
+}
+
+func TestFileChecker_Check_Quarantine(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		policy      Policy
+		quarantined bool
+	}{
+		{name: "authorised", path: pngPath},
+		{name: "rejected", path: pdfPath, quarantined: true},
+		{name: "reason-quarantined", path: pdfPath, policy: Policy{QuarantineReasons: []Reason{ReasonTypeNotAuthorised}}, quarantined: true},
+		{name: "reason-not-quarantined", path: pdfPath, policy: Policy{QuarantineReasons: []Reason{ReasonMalware}}},
+		{name: "too-large", path: pdfPath, policy: Policy{MaxFileSize: 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewFSQuarantine(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			policy := tt.policy
+			policy.UnsetExtensions = []string{ExtArchivePDF}
+			policy.Quarantine = store
+
+			fc := GetFileChecker(getMultipartFileHeaderOrFail(t, tt.path))
+			fc.SetPolicy(policy)
+
+			ctx := WithQuarantineMetadata(context.Background(), map[string]string{"user": "alice"})
+			verdict := fc.CheckContext(ctx)
+			if (verdict.Quarantined != "") != tt.quarantined {
+				t.Fatalf("Check() = %+v, want quarantined %v", verdict, tt.quarantined)
+			}
+			if !tt.quarantined {
+				return
+			}
+
+			record, err := store.Get(verdict.Quarantined)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.Filename != filepath.Base(tt.path) || record.Verdict.Reason != verdict.Reason || record.Metadata["user"] != "alice" {
+				t.Errorf("record = %+v, want the verdict and metadata", record)
+			}
+		})
+	}
+}
+
+func TestFileChecker_Check_QuarantineFailed(t *testing.T) {
+	fc := GetFileChecker(getMultipartFileHeaderOrFail(t, pdfPath))
+	fc.SetPolicy(Policy{UnsetExtensions: []string{ExtArchivePDF}, Quarantine: failingQuarantine{}})
+
+	// still rejected, with the error
+	if verdict := fc.Check(); verdict.Reason != ReasonTypeNotAuthorised || verdict.Err == nil || verdict.Quarantined != "" {
+		t.Errorf("Check() = %+v, want rejected with the error of the quarantine", verdict)
+	}
+}
+
+func TestMiddleware_Quarantine(t *testing.T) {
+	store, err := NewFSQuarantine(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		w       = httptest.NewRecorder()
+		options = MiddlewareOptions{Fields: map[string]Policy{"doc": {UnsetExtensions: []string{ExtArchivePDF}, Quarantine: store}}}
+		handler = Middleware(options)(http.NotFoundHandler())
+		pdf, _  = os.ReadFile(pdfPath)
+		r       = testMultipartRequest(t, formFile{field: "doc", filename: "report.pdf", data: pdf})
+	)
+
+	r.URL.RawQuery = "token=secret"
+	r.Header.Set("User-Agent", "tests")
+	r.Header.Set("X-Request-Id", "42")
+	handler.ServeHTTP(w, r)
+
+	entries, err := os.ReadDir(store.Dir)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("quarantine = %v, %v, want a record", entries, err)
+	}
+
+	record, err := store.Get(strings.TrimSuffix(entries[0].Name(), ".bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"field": "doc", "method": http.MethodPost, "path": "/upload", "remote_addr": r.RemoteAddr, "user_agent": "tests", "request_id": "42"}
+	for key, value := range want {
+		if record.Metadata[key] != value {
+			t.Errorf("Metadata[%s] = %q, want %q", key, record.Metadata[key], value)
+		}
+	}
+	for key, value := range record.Metadata {
+		if strings.Contains(value, "secret") {
+			t.Errorf("Metadata[%s] = %q, want no query", key, value)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package filechecker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+const (
+	// images larger than this (width x height) are not reconstructed, as
+	// decoding them would use too much memory
+	maxReconstructPixels = 64 * 1024 * 1024
+
+	// quality used when reconstructing to JPEG
+	reconstructJPEGQuality = 90
+)
+
+// ErrTooLarge is returned when an image is too large to be reconstructed.
+var ErrTooLarge = errors.New("filechecker: image too large")
+
+// Reconstruction is a sanitised image, rebuilt from the pixels of the file.
+type Reconstruction struct {
+	// the reconstructed file
+	Reader io.Reader
+
+	// extension and MIME type of the reconstructed file
+	Extension string
+	MIME      string
+}
+
+// Reconstruct decodes the (authorised) JPG, PNG or GIF image and re-encodes it
+// to ext (ExtImgPNG or ExtImgJPG), which leaves behind anything that isn't
+// pixels: metadata, trailing data, payloads hidden in unused chunks, etc.
+// Only the first frame of animated images is kept.
+func (fc *FileChecker) Reconstruct(ext string) (*Reconstruction, error) {
+	var (
+		err     error
+		data    []byte
+		config  image.Config
+		img     image.Image
+		out     bytes.Buffer
+		verdict = fc.Check()
+	)
+
+	if !verdict.Authorised {
+		return nil, fmt.Errorf("%w: %s", ErrNotAuthorised, verdict.Reason)
+	}
+
+	switch verdict.Extension {
+	case ExtImgJPG, ExtImgPNG, ExtImgAPNG, ExtImgGIF:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, verdict.Extension)
+	}
+
+	if data, err = fc.contents(); err != nil {
+		return nil, err
+	}
+
+	// check dimensions before decoding, to not be fooled by decompression bombs
+	if config, _, err = image.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if config.Width*config.Height > maxReconstructPixels {
+		return nil, ErrTooLarge
+	}
+
+	if img, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	switch ext {
+	case ExtImgPNG:
+		err = png.Encode(&out, img)
+	case ExtImgJPG:
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: reconstructJPEGQuality})
+	default:
+		return nil, fmt.Errorf("%w: cannot reconstruct to %s", ErrUnsupportedFormat, ext)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reconstruction{
+		Reader:    &out,
+		Extension: ext,
+		MIME:      reconstructMIME[ext],
+	}, nil
+}
+
+var reconstructMIME = map[string]string{
+	ExtImgJPG: "image/jpeg",
+	ExtImgPNG: "image/png",
+}
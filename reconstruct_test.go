@@ -0,0 +1,116 @@
+package filechecker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func TestFileChecker_Reconstruct(t *testing.T) {
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		ext      string
+		mime     string
+	}{
+		{
+			name:     "JPG-to-PNG",
+			filename: "photo.jpg",
+			data:     testJPEG(t),
+			ext:      ExtImgPNG,
+			mime:     "image/png",
+		},
+		{
+			name:     "PNG-to-JPG",
+			filename: "photo.png",
+			// payload smuggled after the end of the image
+			data: append(testPNG(t), []byte("<script>alert(1)</script>")...),
+			ext:  ExtImgJPG,
+			mime: "image/jpeg",
+		},
+		{
+			name:     "GIF-to-PNG",
+			filename: "photo.gif",
+			data:     gifData.Bytes(),
+			ext:      ExtImgPNG,
+			mime:     "image/png",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mpFileHeader, err := getMultipartFileHeaderFromBytes(tt.filename, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fc := GetFileChecker(mpFileHeader)
+			fc.SetExtensions([]string{ExtImgGIF})
+
+			got, err := fc.Reconstruct(tt.ext)
+			if err != nil {
+				t.Fatalf("Reconstruct() error = %v", err)
+			}
+			if got.Extension != tt.ext || got.MIME != tt.mime {
+				t.Errorf("Reconstruct() = %s (%s), want %s (%s)", got.Extension, got.MIME, tt.ext, tt.mime)
+			}
+
+			out, _ := io.ReadAll(got.Reader)
+			for _, leak := range []string{"GPS", "nadim", "script"} {
+				if bytes.Contains(out, []byte(leak)) {
+					t.Errorf("Reconstruct() kept %q", leak)
+				}
+			}
+
+			img, format, err := image.Decode(bytes.NewReader(out))
+			if err != nil || img.Bounds() != testImage().Bounds() {
+				t.Errorf("Reconstruct() produced an invalid %s image (err: %v)", format, err)
+			}
+		})
+	}
+}
+
+func TestFileChecker_Reconstruct_Errors(t *testing.T) {
+	// authorised, but not an image
+	mpFileHeader, err := getMultipartFileHeader(pdfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetFileChecker(mpFileHeader).Reconstruct(ExtImgPNG); err == nil {
+		t.Errorf("Reconstruct() on PDF: expected error")
+	}
+
+	// unsupported target format
+	if mpFileHeader, err = getMultipartFileHeader(pngPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetFileChecker(mpFileHeader).Reconstruct(ExtImgWEBP); err == nil {
+		t.Errorf("Reconstruct(webp): expected error")
+	}
+
+	// decompression bomb: huge dimensions announced in the header
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	copy(data[16:24], []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}) // 65536 x 65536
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	if mpFileHeader, err = getMultipartFileHeaderFromBytes("bomb.png", data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetFileChecker(mpFileHeader).Reconstruct(ExtImgPNG); err != ErrTooLarge {
+		t.Errorf("Reconstruct() on bomb: error = %v, want %v", err, ErrTooLarge)
+	}
+}
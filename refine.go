@@ -0,0 +1,116 @@
+package filechecker
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/h2non/filetype/types"
+)
+
+var (
+	kindAPNG = types.Type{MIME: types.NewMIME("image/apng"), Extension: ExtImgAPNG}
+	kindAVIF = types.Type{MIME: types.NewMIME("image/avif"), Extension: ExtImgAVIF}
+	kindHEIC = types.Type{MIME: types.NewMIME("image/heic"), Extension: ExtImgHEIC}
+	kindHEIF = types.Type{MIME: types.NewMIME("image/heif"), Extension: ExtImgHEIF}
+	kindJXL  = types.Type{MIME: types.NewMIME("image/jxl"), Extension: ExtImgJXL}
+
+	// ISOBMFF brands of AVIF and HEIC images; images of other codecs in a
+	// HEIF container only have the generic mif1/msf1 brands
+	avifBrands = map[string]bool{"avif": true, "avis": true}
+	heicBrands = map[string]bool{
+		"heic": true, "heix": true, "heim": true, "heis": true,
+		"hevc": true, "hevx": true, "hevm": true, "hevs": true,
+	}
+	heifBrands = map[string]bool{"mif1": true, "msf1": true}
+
+	// JPEG XL, bare codestream and ISOBMFF-like container
+	jxlCodestream = []byte{0xFF, 0x0A}
+	jxlContainer  = []byte{0x00, 0x00, 0x00, 0x0C, 'J', 'X', 'L', ' ', 0x0D, 0x0A, 0x87, 0x0A}
+)
+
+// refineKind tells apart the formats filetype doesn't know or mixes up:
+// animated PNG (APNG) from PNG, AVIF, HEIC and other HEIF images by their
+// ISOBMFF brands, and JPEG XL. It returns the refined kind and true, or kind
+// untouched and false.
+func refineKind(header []byte, kind types.Type) (types.Type, bool) {
+	switch {
+	case bytes.HasPrefix(header, jxlCodestream), bytes.HasPrefix(header, jxlContainer):
+		return kindJXL, true
+
+	case kind.Extension == ExtImgPNG && isAPNG(header):
+		return kindAPNG, true
+	}
+
+	if refined, found := isobmffImageKind(header); found {
+		return refined, refined != kind
+	}
+
+	return kind, false
+}
+
+// isobmffImageKind reads the major and compatible brands of the ftyp box to
+// tell AVIF, HEIC and other HEIF images apart.
+func isobmffImageKind(header []byte) (types.Type, bool) {
+	if len(header) < 16 || string(header[4:8]) != "ftyp" {
+		return types.Unknown, false
+	}
+
+	var (
+		size       = int(binary.BigEndian.Uint32(header))
+		major      = string(header[8:12])
+		compatible = make(map[string]bool)
+	)
+
+	// brands past the header, if any, are ignored
+	for i := 16; i+4 <= size && i+4 <= len(header); i += 4 {
+		compatible[string(header[i:i+4])] = true
+	}
+
+	switch {
+	case avifBrands[major]:
+		return kindAVIF, true
+	case heicBrands[major]:
+		return kindHEIC, true
+	case !heifBrands[major] && !hasAny(compatible, heifBrands):
+		// not an image (e.g. MP4 video)
+		return types.Unknown, false
+	case hasAny(compatible, avifBrands):
+		return kindAVIF, true
+	case hasAny(compatible, heicBrands):
+		return kindHEIC, true
+	}
+
+	return kindHEIF, true
+}
+
+// hasAny tells whether any of brands is in set.
+func hasAny(set, brands map[string]bool) bool {
+	for brand := range brands {
+		if set[brand] {
+			return true
+		}
+	}
+	return false
+}
+
+// isAPNG tells whether an animation control chunk (acTL) comes before the
+// image data of the PNG. PNGs whose acTL is past the header are not told
+// apart.
+func isAPNG(header []byte) bool {
+	for i := 8; i+8 <= len(header); {
+		length := int(binary.BigEndian.Uint32(header[i:]))
+
+		switch string(header[i+4 : i+8]) {
+		case "acTL":
+			return true
+		case "IDAT", "IEND":
+			return false
+		}
+
+		if length < 0 || length > len(header) {
+			return false
+		}
+		i += 12 + length
+	}
+	return false
+}
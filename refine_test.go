@@ -0,0 +1,86 @@
+package filechecker
+
+import (
+	"testing"
+
+	"github.com/h2non/filetype"
+)
+
+func ftyp(major string, compatible ...string) []byte {
+	brands := []byte(major + "\x00\x00\x00\x00")
+	for _, brand := range compatible {
+		brands = append(brands, brand...)
+	}
+	return append(box("ftyp", brands), box("meta", make([]byte, 32))...)
+}
+
+func TestRefineKind(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []byte
+		want    string
+		refined bool
+	}{
+		{name: "HEIC", header: ftyp("heic", "mif1", "heic"), want: ExtImgHEIC, refined: true},
+		{name: "HEIC-generic-brand", header: ftyp("mif1", "mif1", "heic"), want: ExtImgHEIC, refined: true},
+		{name: "HEIC-sequence", header: ftyp("hevc", "msf1"), want: ExtImgHEIC, refined: true},
+		{name: "HEIF", header: ftyp("mif1", "mif1", "miaf"), want: ExtImgHEIF, refined: true},
+		{name: "AVIF", header: ftyp("avif", "mif1", "miaf"), want: ExtImgAVIF, refined: true},
+		{name: "AVIF-generic-brand", header: ftyp("mif1", "avif", "mif1"), want: ExtImgAVIF, refined: true},
+		{name: "AVIF-sequence", header: ftyp("avis", "msf1"), want: ExtImgAVIF, refined: true},
+		{name: "MP4", header: ftyp("isom", "isom", "avc1"), want: ExtVideoMP4},
+		{name: "JXL-codestream", header: []byte{0xFF, 0x0A, 0xFA, 0x7F}, want: ExtImgJXL, refined: true},
+		{name: "JXL-container", header: append(append([]byte{}, jxlContainer...), box("ftyp", []byte("jxl "))...), want: ExtImgJXL, refined: true},
+		{name: "APNG", header: testAPNG(t, 2), want: ExtImgAPNG, refined: true},
+		{name: "PNG", header: testPNG(t), want: ExtImgPNG},
+		{name: "JPG", header: testJPEG(t), want: ExtImgJPG},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, _ := filetype.Match(tt.header)
+			got, refined := refineKind(tt.header, kind)
+			if got.Extension != tt.want || refined != tt.refined {
+				t.Errorf("refineKind() = %s, %v, want %s, %v", got.Extension, refined, tt.want, tt.refined)
+			}
+		})
+	}
+}
+
+func TestFileChecker_Check_ModernImages(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		setExt   []string
+		unsetExt []string
+		want     Reason
+		mime     string
+	}{
+		{name: "AVIF", filename: "photo.avif", data: ftyp("avif", "mif1"), setExt: []string{ExtImgAVIF}, mime: "image/avif"},
+		{name: "AVIF-unauthorised", filename: "photo.avif", data: ftyp("avif", "mif1"), want: ReasonExtensionNotAuthorised, mime: "image/avif"},
+		{name: "HEIC", filename: "IMG_0001.HEIC", data: ftyp("heic", "mif1"), setExt: []string{ExtImgHEIC}, mime: "image/heic"},
+		{name: "HEIC-only-HEIF-authorised", filename: "IMG_0001.HEIC", data: ftyp("heic", "mif1"), setExt: []string{ExtImgHEIF}, want: ReasonExtensionNotAuthorised, mime: "image/heic"},
+		{name: "JXL", filename: "photo.jxl", data: []byte{0xFF, 0x0A, 0xFA, 0x7F}, setExt: []string{ExtImgJXL}, mime: "image/jxl"},
+		{name: "APNG-only-PNG-authorised", filename: "anim.png", data: testAPNG(t, 2), unsetExt: []string{ExtImgJPG}, mime: "image/apng"},
+		{name: "APNG-unset", filename: "anim.png", data: testAPNG(t, 2), unsetExt: []string{ExtImgAPNG}, want: ReasonExtensionNotAuthorised, mime: "image/apng"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mpFileHeader, err := getMultipartFileHeaderFromBytes(tt.filename, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fc := GetFileChecker(mpFileHeader)
+			fc.SetExtensions(tt.setExt)
+			fc.UnsetExtensions(tt.unsetExt)
+
+			got := fc.Check()
+			if got.Reason != tt.want || got.MIME != tt.mime || got.Type != TypeIMAGE {
+				t.Errorf("Check() = %s (%s, %s), want %s (%s)", got.Reason, got.Type, got.MIME, tt.want, tt.mime)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package report
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// junitTestSuites is the JUnit XML written, as read by most test reporters.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the files as the test cases of a JUnit XML report, named
+// after their path. Rejected files are failures, or errors when they could
+// not be read.
+func WriteJUnit(w io.Writer, results []Result) error {
+	suite := junitTestSuite{Name: toolName, Tests: len(results), Cases: make([]junitTestCase, 0, len(results))}
+
+	for _, r := range results {
+		c := junitTestCase{Name: r.Path, ClassName: toolName}
+
+		if !r.Verdict.Authorised {
+			problem := &junitProblem{Message: describe(r.Verdict.Reason), Type: string(r.Verdict.Reason), Text: message(r)}
+
+			// the file could not be checked at all
+			if r.Verdict.Err != nil {
+				c.Error = problem
+				suite.Errors++
+			} else {
+				c.Failure = problem
+				suite.Failures++
+			}
+		}
+
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err := encoder.Encode(junitTestSuites{
+		Name:     toolName,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Suites:   []junitTestSuite{suite},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
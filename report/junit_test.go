@@ -0,0 +1,37 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteJUnit(&buf, testResults()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="filechecker" tests="5" failures="3" errors="1">
+  <testsuite name="filechecker" tests="5" failures="3" errors="1">
+    <testcase name="img/me.png" classname="filechecker"></testcase>
+    <testcase name="img/me.gif" classname="filechecker">
+      <failure message="The extension of the file is not authorised." type="extension_not_authorised">img/me.gif: The extension of the file is not authorised. (gif, image/gif)</failure>
+    </testcase>
+    <testcase name="img/you.gif" classname="filechecker">
+      <failure message="The extension of the file is not authorised." type="extension_not_authorised">img/you.gif: The extension of the file is not authorised. (gif, image/gif)</failure>
+    </testcase>
+    <testcase name="bin/run" classname="filechecker">
+      <failure message="The file holds executable content." type="executable">bin/run: The file holds executable content.</failure>
+    </testcase>
+    <testcase name="/tmp/my file" classname="filechecker">
+      <error message="The file could not be read." type="unreadable">/tmp/my file: The file could not be read. permission denied</error>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteJUnit() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+// Package report writes the verdicts on a batch of files in formats read by
+// CI pipelines: SARIF 2.1.0 for code-scanning dashboards, and JUnit XML for
+// test reporters.
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nadimattari/filechecker"
+)
+
+// toolName is the name of the tool in reports.
+const toolName = "filechecker"
+
+// Result is the verdict on a file, and its path.
+type Result struct {
+	Path    string
+	Verdict *filechecker.Verdict
+}
+
+// descriptions of the reasons for rejecting files
+var descriptions = map[filechecker.Reason]string{
+	filechecker.ReasonNoFile:                 "No file was provided.",
+	filechecker.ReasonUnreadable:             "The file could not be read.",
+	filechecker.ReasonTooLarge:               "The file is larger than authorised.",
+	filechecker.ReasonUnknownType:            "The type of the file is not recognised.",
+	filechecker.ReasonExecutable:             "The file holds executable content.",
+	filechecker.ReasonHTML:                   "The file would be rendered as HTML by browsers.",
+	filechecker.ReasonTypeNotAuthorised:      "The type of the file is not authorised.",
+	filechecker.ReasonExtensionNotAuthorised: "The extension of the file is not authorised.",
+	filechecker.ReasonMalformed:              "The file is malformed.",
+	filechecker.ReasonAnimated:               "The image is animated.",
+	filechecker.ReasonTooManyFrames:          "The image has more frames than authorised.",
+	filechecker.ReasonDecodedTooLarge:        "The image is larger than authorised once decoded.",
+	filechecker.ReasonTooLong:                "The audio or video is longer than authorised.",
+	filechecker.ReasonTooManyTracks:          "The audio or video has more tracks than authorised.",
+	filechecker.ReasonResolutionTooLarge:     "The resolution of the video is larger than authorised.",
+	filechecker.ReasonCodecNotAllowed:        "A codec of the audio or video is not authorised.",
+	filechecker.ReasonMalware:                "Malware was detected in the file.",
+	filechecker.ReasonScanFailed:             "The file could not be scanned.",
+	filechecker.ReasonHashDenied:             "The file is in the deny list.",
+	filechecker.ReasonEICAR:                  "The file is the EICAR antivirus test file.",
+}
+
+// describe returns the description of the reason.
+func describe(reason filechecker.Reason) string {
+	if description, found := descriptions[reason]; found {
+		return description
+	}
+
+	// e.g. "Too few files."
+	text := strings.ReplaceAll(string(reason), "_", " ")
+	if text == "" {
+		return ""
+	}
+	return strings.ToUpper(text[:1]) + text[1:] + "."
+}
+
+// message explains why the file was rejected, e.g. "docs/me.gif: The
+// extension of the file is not authorised. (gif, image/gif)".
+func message(r Result) string {
+	var (
+		v    = r.Verdict
+		text = fmt.Sprintf("%s: %s", r.Path, describe(v.Reason))
+	)
+
+	if v.Extension != "" {
+		text += fmt.Sprintf(" (%s, %s)", v.Extension, v.MIME)
+	}
+	if v.Err != nil {
+		text += " " + v.Err.Error()
+	}
+	return text
+}
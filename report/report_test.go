@@ -0,0 +1,60 @@
+package report
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nadimattari/filechecker"
+)
+
+// testResults are the verdicts on a batch of files: authorised, rejected
+// twice for the same reason, rejected for another one and unreadable.
+func testResults() []Result {
+	return []Result{
+		{Path: "img/me.png", Verdict: &filechecker.Verdict{Authorised: true, Filename: "me.png", Extension: "png", MIME: "image/png"}},
+		{Path: "img/me.gif", Verdict: &filechecker.Verdict{Reason: filechecker.ReasonExtensionNotAuthorised, Filename: "me.gif", Extension: "gif", MIME: "image/gif"}},
+		{Path: "img/you.gif", Verdict: &filechecker.Verdict{Reason: filechecker.ReasonExtensionNotAuthorised, Filename: "you.gif", Extension: "gif", MIME: "image/gif"}},
+		{Path: "bin/run", Verdict: &filechecker.Verdict{Reason: filechecker.ReasonExecutable, Filename: "run", Executable: filechecker.ExecELF}},
+		{Path: "/tmp/my file", Verdict: &filechecker.Verdict{Reason: filechecker.ReasonUnreadable, Filename: "my file", Err: errors.New("permission denied")}},
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		reason filechecker.Reason
+		want   string
+	}{
+		{reason: filechecker.ReasonHTML, want: "The file would be rendered as HTML by browsers."},
+		{reason: filechecker.ReasonTooFewFiles, want: "Too few files."},
+		{reason: filechecker.ReasonNone, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.reason), func(t *testing.T) {
+			if got := describe(tt.reason); got != tt.want {
+				t.Errorf("describe() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessage(t *testing.T) {
+	results := testResults()
+
+	tests := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{name: "detected", result: results[1], want: "img/me.gif: The extension of the file is not authorised. (gif, image/gif)"},
+		{name: "error", result: results[4], want: "/tmp/my file: The file could not be read. permission denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := message(tt.result); got != tt.want {
+				t.Errorf("message() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+
+	"github.com/nadimattari/filechecker"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolURI = "https://github.com/nadimattari/filechecker"
+)
+
+// sarifLog is the subset of SARIF 2.1.0 written.
+// see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// WriteSARIF writes the rejected files as the results of a SARIF 2.1.0 log,
+// with a rule per reason for rejecting them (the rule ID being the reason,
+// e.g. "extension_not_authorised"). Authorised files are left out.
+func WriteSARIF(w io.Writer, results []Result) error {
+	var (
+		reasons []filechecker.Reason
+		indexes = make(map[filechecker.Reason]int)
+		run     = sarifRun{
+			Tool:    sarifTool{Driver: sarifDriver{Name: toolName, InformationURI: sarifToolURI, Rules: []sarifRule{}}},
+			Results: []sarifResult{},
+		}
+	)
+
+	// a rule per reason found, sorted
+	for _, r := range results {
+		if _, found := indexes[r.Verdict.Reason]; !r.Verdict.Authorised && !found {
+			indexes[r.Verdict.Reason] = 0
+			reasons = append(reasons, r.Verdict.Reason)
+		}
+	}
+	sort.Slice(reasons, func(i, j int) bool { return reasons[i] < reasons[j] })
+
+	for i, reason := range reasons {
+		indexes[reason] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   string(reason),
+			ShortDescription:     sarifMessage{Text: describe(reason)},
+			DefaultConfiguration: sarifConfiguration{Level: "error"},
+		})
+	}
+
+	for _, r := range results {
+		if r.Verdict.Authorised {
+			continue
+		}
+
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    string(r.Verdict.Reason),
+			RuleIndex: indexes[r.Verdict.Reason],
+			Level:     "error",
+			Message:   sarifMessage{Text: message(r)},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: artifactURI(r.Path)}}}},
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}})
+}
+
+// artifactURI returns the URI of the file: relative paths are kept relative
+// (to the root of the repository, for code-scanning dashboards), absolute
+// ones are file URIs.
+func artifactURI(path string) string {
+	u := &url.URL{Path: filepath.ToSlash(path)}
+	if filepath.IsAbs(path) {
+		u.Scheme = "file"
+	}
+	return u.String()
+}
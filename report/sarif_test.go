@@ -0,0 +1,84 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		log sarifLog
+	)
+
+	if err := WriteSARIF(&buf, testResults()); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || log.Runs[0].Tool.Driver.Name != "filechecker" {
+		t.Fatalf("log = %+v, want a run of filechecker", log)
+	}
+
+	var (
+		run   = log.Runs[0]
+		rules []string
+	)
+	for _, rule := range run.Tool.Driver.Rules {
+		rules = append(rules, rule.ID)
+	}
+	if want := []string{"executable", "extension_not_authorised", "unreadable"}; !equal(rules, want) {
+		t.Errorf("rules = %v, want %v", rules, want)
+	}
+
+	tests := []struct {
+		uri       string
+		ruleID    string
+		ruleIndex int
+	}{
+		{uri: "img/me.gif", ruleID: "extension_not_authorised", ruleIndex: 1},
+		{uri: "img/you.gif", ruleID: "extension_not_authorised", ruleIndex: 1},
+		{uri: "bin/run", ruleID: "executable", ruleIndex: 0},
+		{uri: "file:///tmp/my%20file", ruleID: "unreadable", ruleIndex: 2},
+	}
+
+	if len(run.Results) != len(tests) {
+		t.Fatalf("results = %+v, want %d", run.Results, len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			got := run.Results[i]
+			if uri := got.Locations[0].PhysicalLocation.ArtifactLocation.URI; uri != tt.uri || got.RuleID != tt.ruleID || got.RuleIndex != tt.ruleIndex || got.Level != "error" {
+				t.Errorf("result = %+v (%s), want %s (%d) on %s", got, uri, tt.ruleID, tt.ruleIndex, tt.uri)
+			}
+		})
+	}
+}
+
+func TestWriteSARIF_Empty(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteSARIF(&buf, testResults()[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// results and rules are empty arrays, not null
+	if !bytes.Contains(buf.Bytes(), []byte(`"results": []`)) || !bytes.Contains(buf.Bytes(), []byte(`"rules": []`)) {
+		t.Errorf("WriteSARIF() = %s, want no results", buf.String())
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package filechecker
+
+import (
+	"bufio"
+	"io"
+)
+
+const (
+	// bytes of the file read for detectors to peek at, by default
+	defaultSniffWindow = 4096
+
+	// largest sniff window that may be set
+	maxSniffWindow = 1 << 20
+)
+
+// Ranger is a Peeker which can also read ranges at any offset of the file,
+// for signatures past its first bytes. Detectors are given a Ranger when
+// checking a file.
+type Ranger interface {
+	Peeker
+
+	// ReadRange reads n bytes at offset, fewer (with io.EOF) past the end of
+	// the file.
+	ReadRange(offset int64, n int) ([]byte, error)
+
+	// Tail reads the last n bytes of the file, all of it if shorter.
+	Tail(n int) ([]byte, error)
+
+	// Size returns the size of the file.
+	Size() int64
+}
+
+// Sample is the Ranger detectors are given: the first bytes of the file, read
+// once up to the sniff window, and ranges read on demand.
+type Sample struct {
+	header []byte
+	r      io.ReaderAt
+	size   int64
+}
+
+// NewSample reads the first bytes of r (of the given size), up to window.
+func NewSample(r io.ReaderAt, size int64, window int) (*Sample, error) {
+	if window <= 0 {
+		window = defaultSniffWindow
+	} else if window > maxSniffWindow {
+		window = maxSniffWindow
+	}
+
+	if size < int64(window) {
+		window = int(size)
+	}
+
+	var (
+		header = make([]byte, window)
+		n, err = io.ReadFull(io.NewSectionReader(r, 0, size), header)
+	)
+
+	// file shorter than announced
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sample{header: header[:n], r: r, size: size}, nil
+}
+
+// Peek implements Peeker, within the sniff window.
+func (s *Sample) Peek(n int) ([]byte, error) {
+	switch {
+	case n <= len(s.header):
+		return s.header[:n], nil
+	case int64(len(s.header)) >= s.size:
+		return s.header, io.EOF
+	}
+	return s.header, bufio.ErrBufferFull
+}
+
+// ReadRange implements Ranger.
+func (s *Sample) ReadRange(offset int64, n int) ([]byte, error) {
+	if offset < 0 || offset >= s.size || n <= 0 {
+		return nil, io.EOF
+	}
+
+	// ranges within the header are not read again
+	if offset+int64(n) <= int64(len(s.header)) {
+		return s.header[offset : offset+int64(n)], nil
+	}
+
+	if remaining := s.size - offset; int64(n) > remaining {
+		n = int(remaining)
+	}
+
+	data := make([]byte, n)
+	read, err := s.r.ReadAt(data, offset)
+	if read == n {
+		err = nil
+	}
+	return data[:read], err
+}
+
+// Tail implements Ranger.
+func (s *Sample) Tail(n int) ([]byte, error) {
+	offset := s.size - int64(n)
+	if offset < 0 {
+		offset = 0
+	}
+	return s.ReadRange(offset, int(s.size-offset))
+}
+
+// Size implements Ranger.
+func (s *Sample) Size() int64 {
+	return s.size
+}
+
+// readAt reads n bytes at offset, fewer if the file is shorter, telling
+// whether all of them were read.
+func readAt(r io.ReaderAt, offset int64, n int) ([]byte, bool) {
+	if offset < 0 || n < 0 {
+		return nil, false
+	}
+
+	data := make([]byte, n)
+	read, _ := r.ReadAt(data, offset)
+	return data[:read], read == n
+}
@@ -0,0 +1,150 @@
+package filechecker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/h2non/filetype/types"
+)
+
+func testISO() []byte {
+	data := make([]byte, 36*1024)
+	copy(data[32768:], "\x01CD001\x01")
+	return data
+}
+
+func testTAR(t *testing.T) []byte {
+	var (
+		buf    bytes.Buffer
+		writer = tar.NewWriter(&buf)
+	)
+
+	if err := writer.WriteHeader(&tar.Header{Name: "notes.txt", Mode: 0600, Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = writer.Write([]byte("hello"))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// trailerDetector tells files ending with a trailer.
+type trailerDetector string
+
+func (d trailerDetector) Detect(r Peeker) ([]Candidate, error) {
+	ranger, ok := r.(Ranger)
+	if !ok {
+		return nil, nil
+	}
+
+	tail, err := ranger.Tail(len(d))
+	if err != nil || string(tail) != string(d) {
+		return nil, err
+	}
+	return []Candidate{{Type: types.Type{Extension: ExtImgPNG}, Category: TypeIMAGE, Confidence: 1}}, nil
+}
+
+func TestNewSample(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	tests := []struct {
+		name   string
+		window int
+		want   int
+	}{
+		{name: "default", window: 0, want: defaultSniffWindow},
+		{name: "small", window: 16, want: 16},
+		{name: "larger-than-file", window: 64 * 1024, want: len(data)},
+		{name: "capped", window: maxSniffWindow * 2, want: len(data)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sample, err := NewSample(bytes.NewReader(data), int64(len(data)), tt.window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := peek(sample, maxSniffWindow); len(got) != tt.want {
+				t.Errorf("NewSample() window = %d, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestSample(t *testing.T) {
+	var (
+		data      = []byte("0123456789")
+		sample, _ = NewSample(bytes.NewReader(data), int64(len(data)), 4)
+	)
+
+	tests := []struct {
+		name string
+		read func() ([]byte, error)
+		want string
+		err  error
+	}{
+		{name: "peek", read: func() ([]byte, error) { return sample.Peek(2) }, want: "01"},
+		{name: "peek-past-window", read: func() ([]byte, error) { return sample.Peek(8) }, want: "0123", err: bufio.ErrBufferFull},
+		{name: "range-in-window", read: func() ([]byte, error) { return sample.ReadRange(1, 2) }, want: "12"},
+		{name: "range-past-window", read: func() ([]byte, error) { return sample.ReadRange(6, 3) }, want: "678"},
+		{name: "range-past-end", read: func() ([]byte, error) { return sample.ReadRange(8, 5) }, want: "89"},
+		{name: "range-out-of-file", read: func() ([]byte, error) { return sample.ReadRange(10, 1) }, err: io.EOF},
+		{name: "tail", read: func() ([]byte, error) { return sample.Tail(3) }, want: "789"},
+		{name: "tail-whole-file", read: func() ([]byte, error) { return sample.Tail(64) }, want: "0123456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.read()
+			if string(got) != tt.want || err != tt.err {
+				t.Errorf("read() = %q, %v, want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+
+	if got, err := (&Sample{}).Peek(1); len(got) != 0 || err != io.EOF {
+		t.Errorf("Peek() on empty file = %q, %v, want EOF", got, err)
+	}
+}
+
+func TestFileChecker_Check_SniffWindow(t *testing.T) {
+	tests := []struct {
+		name      string
+		filename  string
+		data      []byte
+		window    int
+		detector  Detector
+		extension string
+		reason    Reason
+	}{
+		{name: "TAR", filename: "notes.tar", data: testTAR(t), extension: ExtArchiveTAR},
+		{name: "TAR-past-window", filename: "notes.tar", data: testTAR(t), window: 64, extension: ExtArchiveTAR},
+		{name: "ISO", filename: "disc.iso", data: testISO(), extension: ExtArchiveISO},
+		{name: "ISO-in-window", filename: "disc.iso", data: testISO(), window: 64 * 1024, extension: ExtArchiveISO},
+		{name: "PNG-window-too-small", filename: "photo.png", data: testPNG(t), window: 2, reason: ReasonUnknownType},
+		{name: "tail", filename: "photo.png", data: []byte("anything, really TRAILER"), detector: trailerDetector("TRAILER"), extension: ExtImgPNG},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mpFileHeader, err := getMultipartFileHeaderFromBytes(tt.filename, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fc := GetFileChecker(mpFileHeader)
+			fc.SetExtensions([]string{ExtArchiveTAR, ExtArchiveISO})
+			fc.SetDetector(tt.detector)
+			fc.SetPolicy(Policy{SniffWindow: tt.window})
+
+			got := fc.Check()
+			if got.Reason != tt.reason || got.Extension != tt.extension {
+				t.Errorf("Check() = %s (%s), want %s (%s)", got.Reason, got.Extension, tt.reason, tt.extension)
+			}
+		})
+	}
+}
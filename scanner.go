@@ -0,0 +1,55 @@
+package filechecker
+
+import (
+	"context"
+	"io"
+)
+
+// Scanner scans the content of files, e.g. for malware.
+type Scanner interface {
+	// Name names the scanner in verdicts, e.g. "clamav".
+	Name() string
+
+	// Scan scans the content of the file. Findings (e.g. a virus) are
+	// results, errors are failures to scan (e.g. unreachable daemon).
+	Scan(ctx context.Context, r io.ReaderAt, size int64) (*ScanResult, error)
+}
+
+// ScanResult is the outcome of scanning a file.
+type ScanResult struct {
+	// name of the scanner
+	Scanner string `json:"scanner"`
+
+	// whether something was detected, and what (e.g. the name of the
+	// signature, "Win.Test.EICAR_HDB-1")
+	Detected  bool   `json:"detected"`
+	Signature string `json:"signature,omitempty"`
+
+	// why the scan failed, if it did
+	Error string `json:"error,omitempty"`
+	err   error
+}
+
+// scan is a private method. Runs the pipeline of the policy, and merges the
+// results into the verdict: files in which something was detected are
+// rejected (ReasonMalware), as are files that could not be scanned
+// (ReasonScanFailed).
+func (fc *FileChecker) scan(ctx context.Context, verdict *Verdict, r io.ReaderAt) *Verdict {
+	var failed *ScanResult
+
+	verdict.Scans = fc.policy.pipeline().Run(ctx, r, verdict.Size)
+
+	for _, result := range verdict.Scans {
+		if result.Detected {
+			return verdict.reject(ReasonMalware, nil)
+		}
+		if result.Error != "" && failed == nil {
+			failed = result
+		}
+	}
+
+	if failed != nil {
+		return verdict.reject(ReasonScanFailed, failed.err)
+	}
+	return verdict
+}
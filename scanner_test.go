@@ -0,0 +1,107 @@
+package filechecker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"testing"
+)
+
+// testScanner detects files containing its signature.
+type testScanner struct {
+	name      string
+	signature []byte
+	err       error
+
+	// sizes of the files scanned
+	scanned []int64
+}
+
+func (s *testScanner) Name() string { return s.name }
+
+func (s *testScanner) Scan(_ context.Context, r io.ReaderAt, size int64) (*ScanResult, error) {
+	s.scanned = append(s.scanned, size)
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data, s.signature) {
+		return &ScanResult{Detected: true, Signature: string(s.signature)}, nil
+	}
+	return &ScanResult{}, nil
+}
+
+func TestFileChecker_Check_Scanners(t *testing.T) {
+	tests := []struct {
+		name     string
+		scanners []*testScanner
+		reason   Reason
+		scans    int
+		skipped  int
+	}{
+		{name: "clean", scanners: []*testScanner{{name: "a", signature: []byte("virus")}, {name: "b", signature: []byte("worm")}}, scans: 2},
+		{name: "detected", scanners: []*testScanner{{name: "a", signature: []byte("IEND")}, {name: "b", signature: []byte("worm")}}, reason: ReasonMalware, scans: 1, skipped: 1},
+		{name: "failed", scanners: []*testScanner{{name: "a", err: errors.New("unreachable")}, {name: "b", signature: []byte("worm")}}, reason: ReasonScanFailed, scans: 1, skipped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				header   = getMultipartFileHeaderOrFail(t, pngPath)
+				scanners []Scanner
+			)
+
+			for _, scanner := range tt.scanners {
+				scanners = append(scanners, scanner)
+			}
+
+			fc := GetFileChecker(header)
+			fc.SetPolicy(Policy{Scanners: scanners})
+
+			verdict := fc.Check()
+			if verdict.Authorised != (tt.reason == ReasonNone) || verdict.Reason != tt.reason || len(verdict.Scans) != tt.scans {
+				t.Fatalf("Check() = %+v, want %q after %d scans", verdict, tt.reason, tt.scans)
+			}
+			if verdict.Scans[0].Scanner != "a" {
+				t.Errorf("Scans[0].Scanner = %q, want a", verdict.Scans[0].Scanner)
+			}
+
+			// scanners after a detection or failure do not run
+			if last := tt.scanners[len(tt.scanners)-1]; (len(last.scanned) == 0) != (tt.skipped == 1) {
+				t.Errorf("last scanner scanned %v", last.scanned)
+			}
+			if tt.scanners[0].scanned[0] != header.Size {
+				t.Errorf("scanned %d bytes, want %d", tt.scanners[0].scanned[0], header.Size)
+			}
+		})
+	}
+}
+
+func TestFileChecker_Check_ScannersNotRun(t *testing.T) {
+	var (
+		scanner = &testScanner{name: "a"}
+		header  = getMultipartFileHeaderOrFail(t, jpgPath)
+	)
+
+	// rejected files are not scanned
+	fc := GetFileChecker(header)
+	fc.SetPolicy(Policy{UnsetExtensions: []string{ExtImgJPG}, Scanners: []Scanner{scanner}})
+
+	if verdict := fc.Check(); verdict.Reason != ReasonExtensionNotAuthorised || len(scanner.scanned) != 0 {
+		t.Errorf("Check() = %+v, scanned %v, want rejected unscanned", verdict, scanner.scanned)
+	}
+}
+
+func getMultipartFileHeaderOrFail(t *testing.T, path string) *multipart.FileHeader {
+	header, err := getMultipartFileHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
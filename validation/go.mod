@@ -0,0 +1,21 @@
+module github.com/nadimattari/filechecker/validation
+
+go 1.19
+
+require (
+	github.com/go-playground/validator/v10 v10.20.0
+	github.com/nadimattari/filechecker v1.0.0
+)
+
+require (
+	github.com/gabriel-vasile/mimetype v1.4.3 // indirect
+	github.com/go-playground/locales v0.14.1 // indirect
+	github.com/go-playground/universal-translator v0.18.1 // indirect
+	github.com/h2non/filetype v1.1.3 // indirect
+	github.com/leodido/go-urn v1.4.0 // indirect
+	github.com/stretchr/testify v1.9.0 // indirect
+	golang.org/x/crypto v0.23.0 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
+)
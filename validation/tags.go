@@ -0,0 +1,153 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/nadimattari/filechecker"
+)
+
+// Tags checking files, e.g. `validate:"filetype=jpg;png,maxsize=5MB,strict"`.
+const (
+	// the file is of one of the extensions, separated by ";"
+	TagFileType = "filetype"
+
+	// the file is at most this large: a number of bytes, optionally followed
+	// by a unit (B, KB, MB, GB, binary multiples)
+	TagMaxSize = "maxsize"
+
+	// the extension of the filename is the one of the content
+	TagStrict = "strict"
+)
+
+var (
+	// other names of extensions
+	extensionAliases = map[string]string{
+		"jpeg": filechecker.ExtImgJPG,
+		"jpe":  filechecker.ExtImgJPG,
+		"tiff": filechecker.ExtImgTIF,
+	}
+
+	// units of sizes, longest first
+	sizeUnits = []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	}
+)
+
+// RegisterTags registers TagFileType, TagMaxSize and TagStrict on v.
+func RegisterTags(v *validator.Validate) error {
+	validations := map[string]validator.Func{
+		TagFileType: func(fl validator.FieldLevel) bool {
+			return isFileType(fl, strings.Split(fl.Param(), ";"))
+		},
+		TagMaxSize: isMaxSize,
+		TagStrict:  isStrict,
+	}
+
+	for tag, fn := range validations {
+		if err := v.RegisterValidation(tag, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isFileType tells whether the files are of one of the extensions (and
+// pass the other checks of the default policy).
+func isFileType(fl validator.FieldLevel, extensions []string) bool {
+	all := make([]string, 0, len(filechecker.AvailableExtensions()))
+	for ext := range filechecker.AvailableExtensions() {
+		all = append(all, ext)
+	}
+
+	for i, ext := range extensions {
+		extensions[i] = normaliseExtension(strings.TrimSpace(ext))
+	}
+
+	for _, file := range files(fl.Field()) {
+		fc := filechecker.GetFileChecker(file)
+		fc.UnsetExtensions(all)
+		fc.SetExtensions(extensions)
+		if !fc.IsAuthorised() {
+			return false
+		}
+	}
+	return true
+}
+
+// isMaxSize tells whether the files are at most as large as the parameter.
+// It panics on invalid sizes, as validator does on invalid parameters.
+func isMaxSize(fl validator.FieldLevel) bool {
+	limit, err := parseSize(fl.Param())
+	if err != nil {
+		panic(fmt.Sprintf("Bad param %q for %s: %v", fl.Param(), TagMaxSize, err))
+	}
+
+	for _, file := range files(fl.Field()) {
+		if file.Size > limit {
+			return false
+		}
+	}
+	return true
+}
+
+// isStrict tells whether the extension of the filename of the files is the
+// one of their content.
+func isStrict(fl validator.FieldLevel) bool {
+	for _, file := range files(fl.Field()) {
+		var (
+			verdict  = filechecker.GetFileChecker(file).Check()
+			declared = normaliseExtension(strings.TrimPrefix(filepath.Ext(file.Filename), "."))
+		)
+
+		if verdict.Extension == "" || declared != verdict.Extension {
+			return false
+		}
+	}
+	return true
+}
+
+// normaliseExtension lower-cases the extension and resolves its aliases.
+func normaliseExtension(ext string) string {
+	// Z (compress) is the only upper-case extension
+	if ext == filechecker.ExtArchiveZ {
+		return ext
+	}
+
+	ext = strings.ToLower(ext)
+	if alias, found := extensionAliases[ext]; found {
+		return alias
+	}
+	return ext
+}
+
+// parseSize parses sizes such as 512, 300KB or 5MB.
+func parseSize(s string) (int64, error) {
+	var (
+		upper      = strings.ToUpper(strings.TrimSpace(s))
+		multiplier = int64(1)
+	)
+
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper, multiplier = strings.TrimSpace(strings.TrimSuffix(upper, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseFloat(upper, 64)
+	if err != nil || math.IsNaN(size) || size < 0 || size*float64(multiplier) >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(size * float64(multiplier)), nil
+}
@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"mime/multipart"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/nadimattari/filechecker/internal/fctest"
+)
+
+type tagged struct {
+	Image *multipart.FileHeader `validate:"filetype=jpeg;png,maxsize=1KB,strict"`
+	Other *multipart.FileHeader `validate:"omitempty,filetype=gif"`
+}
+
+func TestRegisterTags(t *testing.T) {
+	var (
+		v     = validator.New()
+		png   = fctest.FileHeader(t, "me.png", fctest.PNG(t))
+		gif   = fctest.FileHeader(t, "me.gif", fctest.GIF(t))
+		named = fctest.FileHeader(t, "me.jpg", fctest.PNG(t))
+		large = fctest.FileHeader(t, "me.png", append(fctest.PNG(t), make([]byte, 2048)...))
+	)
+
+	if err := RegisterTags(v); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		value  tagged
+		failed string
+		tag    string
+	}{
+		{name: "authorised", value: tagged{Image: png}},
+		{name: "authorised-GIF", value: tagged{Image: png, Other: gif}},
+		{name: "file-type", value: tagged{Image: gif}, failed: "Image", tag: TagFileType},
+		{name: "max-size", value: tagged{Image: large}, failed: "Image", tag: TagMaxSize},
+		{name: "strict", value: tagged{Image: named}, failed: "Image", tag: TagStrict},
+		{name: "other", value: tagged{Image: png, Other: png}, failed: "Other", tag: TagFileType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Struct(tt.value)
+			if tt.failed == "" {
+				if err != nil {
+					t.Errorf("Struct() = %v, want nil", err)
+				}
+				return
+			}
+
+			errs, ok := err.(validator.ValidationErrors)
+			if !ok || len(errs) != 1 || errs[0].Field() != tt.failed || errs[0].Tag() != tt.tag {
+				t.Errorf("Struct() = %v, want %s error on %s", err, tt.tag, tt.failed)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "512", want: 512},
+		{size: "512B", want: 512},
+		{size: "300KB", want: 300 << 10},
+		{size: "5MB", want: 5 << 20},
+		{size: "1.5 mib", want: 3 << 19},
+		{size: "2G", want: 2 << 30},
+		{size: "MB", wantErr: true},
+		{size: "-1", wantErr: true},
+		{size: "five", wantErr: true},
+		{size: "NaN", wantErr: true},
+		{size: "Inf", wantErr: true},
+		{size: "-Inf", wantErr: true},
+		{size: "1e30GB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := parseSize(tt.size)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseSize(%q) = %d, %v, want %d", tt.size, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package validation integrates filechecker with go-playground/validator, so
+// file fields (*multipart.FileHeader, or slices of) of request structs can be
+// checked declaratively.
+package validation
+
+import (
+	"mime/multipart"
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/nadimattari/filechecker"
+)
+
+// Tag checks files against the policy of a profile, e.g.
+// `binding:"required,filecheck=images"`.
+const Tag = "filecheck"
+
+// Register registers Tag on v, checking files against the policies of the
+// given profiles (by name). Unknown profiles reject every file.
+func Register(v *validator.Validate, profiles map[string]filechecker.Policy) error {
+	return v.RegisterValidation(Tag, func(fl validator.FieldLevel) bool {
+		policy, found := profiles[fl.Param()]
+		if !found {
+			return false
+		}
+
+		for _, file := range files(fl.Field()) {
+			fc := filechecker.GetFileChecker(file)
+			fc.SetPolicy(policy)
+			if !fc.IsAuthorised() {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// files returns the files of a field: *multipart.FileHeader (which validator
+// hands over dereferenced) or slices of.
+func files(field reflect.Value) []*multipart.FileHeader {
+	var headers []*multipart.FileHeader
+
+	switch field.Kind() {
+	case reflect.Struct:
+		if header, ok := addr(field).(*multipart.FileHeader); ok {
+			headers = append(headers, header)
+		}
+
+	case reflect.Ptr:
+		if header, ok := field.Interface().(*multipart.FileHeader); ok && header != nil {
+			headers = append(headers, header)
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < field.Len(); i++ {
+			headers = append(headers, files(field.Index(i))...)
+		}
+	}
+
+	return headers
+}
+
+// addr returns the address of the field, or of a copy if it cannot be
+// addressed.
+func addr(field reflect.Value) interface{} {
+	if field.CanAddr() {
+		return field.Addr().Interface()
+	}
+
+	copied := reflect.New(field.Type())
+	copied.Elem().Set(field)
+	return copied.Interface()
+}
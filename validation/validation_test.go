@@ -0,0 +1,62 @@
+package validation
+
+import (
+	"mime/multipart"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/internal/fctest"
+)
+
+type upload struct {
+	Avatar      *multipart.FileHeader   `validate:"required,filecheck=images"`
+	Attachments []*multipart.FileHeader `validate:"omitempty,filecheck=documents"`
+	Other       *multipart.FileHeader   `validate:"omitempty,filecheck=unknown"`
+}
+
+func TestRegister(t *testing.T) {
+	var (
+		v        = validator.New()
+		png      = fctest.FileHeader(t, "me.png", fctest.PNG(t))
+		gif      = fctest.FileHeader(t, "me.gif", fctest.GIF(t))
+		profiles = map[string]filechecker.Policy{
+			"images":    {SetExtensions: []string{filechecker.ExtImgGIF}},
+			"documents": {UnsetExtensions: []string{filechecker.ExtImgGIF, filechecker.ExtImgJPG, filechecker.ExtImgPNG}},
+		}
+	)
+
+	if err := Register(v, profiles); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		upload upload
+		failed string
+	}{
+		{name: "authorised", upload: upload{Avatar: png}},
+		{name: "authorised-GIF", upload: upload{Avatar: gif}},
+		{name: "missing", upload: upload{}, failed: "Avatar"},
+		{name: "slice", upload: upload{Avatar: png, Attachments: []*multipart.FileHeader{png}}, failed: "Attachments"},
+		{name: "unknown-profile", upload: upload{Avatar: png, Other: png}, failed: "Other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Struct(tt.upload)
+			if tt.failed == "" {
+				if err != nil {
+					t.Errorf("Struct() = %v, want nil", err)
+				}
+				return
+			}
+
+			errs, ok := err.(validator.ValidationErrors)
+			if !ok || len(errs) != 1 || errs[0].Field() != tt.failed {
+				t.Errorf("Struct() = %v, want error on %s", err, tt.failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package filechecker
+
+// Reason is a machine-readable code explaining why a file was rejected.
+type Reason string
+
+const (
+	ReasonNone                   Reason = ""
+	ReasonNoFile                 Reason = "no_file"
+	ReasonUnreadable             Reason = "unreadable"
+	ReasonTooLarge               Reason = "too_large"
+	ReasonUnknownType            Reason = "unknown_type"
+	ReasonExecutable             Reason = "executable"
+	ReasonHTML                   Reason = "html"
+	ReasonTypeNotAuthorised      Reason = "type_not_authorised"
+	ReasonExtensionNotAuthorised Reason = "extension_not_authorised"
+	ReasonMalformed              Reason = "malformed"
+	ReasonAnimated               Reason = "animated"
+	ReasonTooManyFrames          Reason = "too_many_frames"
+	ReasonDecodedTooLarge        Reason = "decoded_too_large"
+	ReasonTooLong                Reason = "too_long"
+	ReasonTooManyTracks          Reason = "too_many_tracks"
+	ReasonResolutionTooLarge     Reason = "resolution_too_large"
+	ReasonCodecNotAllowed        Reason = "codec_not_allowed"
+
+	// reasons of content scanners (see Policy.Scanners)
+	ReasonMalware    Reason = "malware"
+	ReasonScanFailed Reason = "scan_failed"
+
+	// reason of hash lists (see Policy.DenyList)
+	ReasonHashDenied Reason = "hash_denied"
+
+	// reason of the EICAR test file, raw or in zip archives, rejected
+	// whatever the policy so that upload pipelines can be tested end to end
+	ReasonEICAR Reason = "eicar"
+
+	// reasons for rejecting the files of a form field (see CheckForm)
+	ReasonUnexpectedField Reason = "unexpected_field"
+	ReasonTooFewFiles     Reason = "too_few_files"
+	ReasonTooManyFiles    Reason = "too_many_files"
+	ReasonTotalTooLarge   Reason = "total_too_large"
+	ReasonFileRejected    Reason = "file_rejected"
+
+	// reasons for rejecting uploads as a whole (see Middleware)
+	ReasonBodyTooLarge    Reason = "body_too_large"
+	ReasonMalformedUpload Reason = "malformed_upload"
+)
+
+// Verdict is the outcome of checking a file.
+type Verdict struct {
+	// whether the file is authorised (type and extension)
+	Authorised bool `json:"authorised"`
+
+	// why the file was rejected, ReasonNone when authorised
+	Reason Reason `json:"reason,omitempty"`
+
+	// original filename and size, as uploaded
+	Filename string `json:"filename,omitempty"`
+	Size     int64  `json:"size"`
+
+	// what the file was detected as (e.g. TypeIMAGE, ExtImgPNG, "image/png")
+	Type      string `json:"type,omitempty"`
+	Extension string `json:"extension,omitempty"`
+	MIME      string `json:"mime,omitempty"`
+
+	// kind of executable content found (e.g. ExecPE, ExecScript), if any
+	Executable string `json:"executable,omitempty"`
+
+	// frames of the image, when inspected (see Policy.Frames)
+	Frames *FrameInfo `json:"frames,omitempty"`
+
+	// duration and tracks of audio and video files, when probed (see
+	// Policy.Media)
+	Media *MediaInfo `json:"media,omitempty"`
+
+	// results of the content scanners, in the order they ran (see
+	// Policy.Scanners)
+	Scans []*ScanResult `json:"scans,omitempty"`
+
+	// digests of the file, when computed (see Policy.Hashes), and whether
+	// it is in the allow list of the policy, and so was not inspected
+	// further
+	Hashes      *Hashes `json:"hashes,omitempty"`
+	Allowlisted bool    `json:"allowlisted,omitempty"`
+
+	// identifier of the record of the file in the quarantine of the
+	// policy, when rejected and quarantined (see Policy.Quarantine)
+	Quarantined string `json:"quarantined,omitempty"`
+
+	// underlying error, if any (e.g. file could not be read)
+	Err error `json:"-"`
+}
+
+// reject marks the verdict as unauthorised for the given reason.
+func (v *Verdict) reject(reason Reason, err error) *Verdict {
+	v.Authorised = false
+	v.Reason = reason
+	v.Err = err
+	return v
+}
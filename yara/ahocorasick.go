@@ -0,0 +1,92 @@
+package yara
+
+// automaton is an Aho-Corasick automaton, finding all the literals in a
+// single pass over the data. It matches case-insensitively (ASCII), hits
+// being verified against the literals afterwards.
+type automaton struct {
+	// transitions of the states, on folded bytes
+	next [][256]int32
+
+	// literals ending at the states, by index
+	out [][]int
+}
+
+// fold maps bytes to their lower case (ASCII).
+var fold [256]byte
+
+func init() {
+	for i := range fold {
+		fold[i] = byte(i)
+		if 'A' <= i && i <= 'Z' {
+			fold[i] = byte(i) + 'a' - 'A'
+		}
+	}
+}
+
+// newAutomaton builds the automaton of the literals.
+func newAutomaton(literals [][]byte) *automaton {
+	var (
+		a     = &automaton{next: make([][256]int32, 1), out: make([][]int, 1)}
+		fail  = []int32{0}
+		queue []int32
+	)
+
+	// trie, -1 standing for missing transitions
+	for i := range a.next[0] {
+		a.next[0][i] = -1
+	}
+	for index, literal := range literals {
+		state := int32(0)
+		for _, b := range literal {
+			c := fold[b]
+			if a.next[state][c] < 0 {
+				var next [256]int32
+				for i := range next {
+					next[i] = -1
+				}
+				a.next = append(a.next, next)
+				a.out = append(a.out, nil)
+				fail = append(fail, 0)
+				a.next[state][c] = int32(len(a.next) - 1)
+			}
+			state = a.next[state][c]
+		}
+		a.out[state] = append(a.out[state], index)
+	}
+
+	// failure links, breadth first, turning the trie into a DFA
+	for c := 0; c < 256; c++ {
+		if next := a.next[0][c]; next < 0 {
+			a.next[0][c] = 0
+		} else {
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		a.out[state] = append(a.out[state], a.out[fail[state]]...)
+		for c := 0; c < 256; c++ {
+			if next := a.next[state][c]; next < 0 {
+				a.next[state][c] = a.next[fail[state]][c]
+			} else {
+				fail[next] = a.next[fail[state]][c]
+				queue = append(queue, next)
+			}
+		}
+	}
+	return a
+}
+
+// find calls hit with the index of the literals found, and the offset of
+// their last byte.
+func (a *automaton) find(data []byte, hit func(index, end int)) {
+	state := int32(0)
+	for i, b := range data {
+		state = a.next[state][fold[b]]
+		for _, index := range a.out[state] {
+			hit(index, i)
+		}
+	}
+}
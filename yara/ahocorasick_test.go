@@ -0,0 +1,23 @@
+package yara
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAutomaton_Find(t *testing.T) {
+	var (
+		literals = [][]byte{[]byte("he"), []byte("She"), []byte("his"), []byte("hers")}
+		hits     [][2]int
+	)
+
+	newAutomaton(literals).find([]byte("ushers HIS"), func(index, end int) {
+		hits = append(hits, [2]int{index, end})
+	})
+
+	// case-insensitively, overlapping
+	want := [][2]int{{1, 3}, {0, 3}, {3, 5}, {2, 9}}
+	if !reflect.DeepEqual(hits, want) {
+		t.Errorf("find() = %v, want %v", hits, want)
+	}
+}
@@ -0,0 +1,158 @@
+package yara
+
+import "encoding/binary"
+
+// state is the state of a scan: the file, and the offsets of the strings
+// matched.
+type state struct {
+	data    []byte
+	matches map[*pattern][]int
+}
+
+// cond is a condition of a rule.
+type cond interface {
+	eval(s *state) bool
+}
+
+// num is an integer of a condition.
+type num interface {
+	value(s *state) int64
+}
+
+type (
+	boolCond bool
+	andCond  struct{ left, right cond }
+	orCond   struct{ left, right cond }
+	notCond  struct{ c cond }
+	cmpCond  struct {
+		op          string
+		left, right num
+	}
+
+	// $a
+	stringCond struct{ pattern *pattern }
+
+	// $a at 0
+	atCond struct {
+		pattern *pattern
+		at      num
+	}
+
+	// $a in (0..1024)
+	inCond struct {
+		pattern *pattern
+		lo, hi  num
+	}
+
+	// any of them, all of ($a*), 2 of ($a, $b)
+	ofCond struct {
+		n        num
+		all      bool
+		patterns []*pattern
+	}
+)
+
+func (c boolCond) eval(*state) bool     { return bool(c) }
+func (c andCond) eval(s *state) bool    { return c.left.eval(s) && c.right.eval(s) }
+func (c orCond) eval(s *state) bool     { return c.left.eval(s) || c.right.eval(s) }
+func (c notCond) eval(s *state) bool    { return !c.c.eval(s) }
+func (c stringCond) eval(s *state) bool { return len(s.matches[c.pattern]) > 0 }
+
+func (c cmpCond) eval(s *state) bool {
+	left, right := c.left.value(s), c.right.value(s)
+	switch c.op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	default:
+		return left >= right
+	}
+}
+
+func (c atCond) eval(s *state) bool {
+	at := c.at.value(s)
+	for _, offset := range s.matches[c.pattern] {
+		if int64(offset) == at {
+			return true
+		}
+	}
+	return false
+}
+
+func (c inCond) eval(s *state) bool {
+	lo, hi := c.lo.value(s), c.hi.value(s)
+	for _, offset := range s.matches[c.pattern] {
+		if lo <= int64(offset) && int64(offset) <= hi {
+			return true
+		}
+	}
+	return false
+}
+
+func (c ofCond) eval(s *state) bool {
+	var (
+		matched int64
+		want    = int64(1)
+	)
+
+	switch {
+	case c.all:
+		want = int64(len(c.patterns))
+	case c.n != nil:
+		want = c.n.value(s)
+	}
+
+	for _, pattern := range c.patterns {
+		if len(s.matches[pattern]) > 0 {
+			matched++
+		}
+	}
+	return matched >= want
+}
+
+type (
+	intNum      int64
+	filesizeNum struct{}
+
+	// #a
+	countNum struct{ pattern *pattern }
+
+	// uint16(0), uint32be(4), 0 past the end of the file
+	uintNum struct {
+		size      int
+		bigEndian bool
+		offset    num
+	}
+)
+
+func (n intNum) value(*state) int64      { return int64(n) }
+func (filesizeNum) value(s *state) int64 { return int64(len(s.data)) }
+func (n countNum) value(s *state) int64  { return int64(len(s.matches[n.pattern])) }
+
+func (n uintNum) value(s *state) int64 {
+	offset := n.offset.value(s)
+	if offset < 0 || offset+int64(n.size) > int64(len(s.data)) {
+		return 0
+	}
+
+	b := s.data[offset : offset+int64(n.size)]
+	switch {
+	case n.size == 1:
+		return int64(b[0])
+	case n.size == 2 && n.bigEndian:
+		return int64(binary.BigEndian.Uint16(b))
+	case n.size == 2:
+		return int64(binary.LittleEndian.Uint16(b))
+	case n.bigEndian:
+		return int64(binary.BigEndian.Uint32(b))
+	default:
+		return int64(binary.LittleEndian.Uint32(b))
+	}
+}
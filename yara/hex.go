@@ -0,0 +1,206 @@
+package yara
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// kinds of tokens of hex strings
+const (
+	hexByte = iota
+	hexJump
+	hexAlt
+)
+
+// hexToken is a token of a hex string: a byte (possibly with wildcard
+// nibbles), a jump over min to max bytes (max < 0 when unbounded), or
+// alternatives.
+type hexToken struct {
+	kind        int
+	value, mask byte
+	min, max    int
+	alts        [][]hexToken
+}
+
+// parseHex parses the content of a hex string, e.g. "4D 5A ?? [2-4] (00|FF)".
+func parseHex(src string) ([]hexToken, error) {
+	tokens, rest, err := parseHexSeq(strings.TrimSpace(src), false)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected %q in hex string", rest[:1])
+	}
+	if len(tokens) == 0 || tokens[0].kind == hexJump || tokens[len(tokens)-1].kind == hexJump {
+		return nil, fmt.Errorf("hex strings start and end with bytes")
+	}
+	return tokens, nil
+}
+
+// parseHexSeq parses tokens until the end of the source, or of the
+// alternative (| or closing parenthesis) when nested.
+func parseHexSeq(src string, nested bool) ([]hexToken, string, error) {
+	var tokens []hexToken
+
+	for {
+		src = strings.TrimLeft(src, " \t\r\n")
+		if src == "" || nested && (src[0] == '|' || src[0] == ')') {
+			return tokens, src, nil
+		}
+
+		switch src[0] {
+		case '[':
+			end := strings.IndexByte(src, ']')
+			if end < 0 {
+				return nil, "", fmt.Errorf("unterminated jump in hex string")
+			}
+			token, err := parseJump(src[1:end])
+			if err != nil {
+				return nil, "", err
+			}
+			tokens, src = append(tokens, token), src[end+1:]
+		case '(':
+			token := hexToken{kind: hexAlt}
+			src = src[1:]
+			for {
+				alt, rest, err := parseHexSeq(src, true)
+				if err != nil {
+					return nil, "", err
+				}
+				if len(alt) == 0 || rest == "" {
+					return nil, "", fmt.Errorf("malformed alternative in hex string")
+				}
+				token.alts = append(token.alts, alt)
+				if src = rest[1:]; rest[0] == ')' {
+					break
+				}
+			}
+			tokens = append(tokens, token)
+		default:
+			if len(src) < 2 {
+				return nil, "", fmt.Errorf("odd number of digits in hex string")
+			}
+			token, err := parseHexByte(src[:2])
+			if err != nil {
+				return nil, "", err
+			}
+			tokens, src = append(tokens, token), src[2:]
+		}
+	}
+}
+
+// parseHexByte parses a byte, e.g. "4D", "4?", "??".
+func parseHexByte(s string) (hexToken, error) {
+	token := hexToken{kind: hexByte}
+	for i, shift := range []uint{4, 0} {
+		if s[i] == '?' {
+			continue
+		}
+		n, err := strconv.ParseUint(s[i:i+1], 16, 8)
+		if err != nil {
+			return token, fmt.Errorf("invalid hex digit %q", s[i:i+1])
+		}
+		token.value |= byte(n) << shift
+		token.mask |= 0xF << shift
+	}
+	return token, nil
+}
+
+// parseJump parses the content of a jump, e.g. "4", "2-4", "2-", "-".
+func parseJump(s string) (hexToken, error) {
+	var (
+		err   error
+		token = hexToken{kind: hexJump, max: -1}
+	)
+
+	lo, hi, ranged := strings.TrimSpace(s), "", false
+	if i := strings.Index(lo, "-"); i >= 0 {
+		lo, hi, ranged = lo[:i], lo[i+1:], true
+	}
+	lo, hi = strings.TrimSpace(lo), strings.TrimSpace(hi)
+
+	if lo != "" {
+		if token.min, err = strconv.Atoi(lo); err != nil {
+			return token, fmt.Errorf("invalid jump [%s]", s)
+		}
+	}
+	switch {
+	case !ranged:
+		token.max = token.min
+	case hi != "":
+		if token.max, err = strconv.Atoi(hi); err != nil || token.max < token.min {
+			return token, fmt.Errorf("invalid jump [%s]", s)
+		}
+	}
+	return token, nil
+}
+
+// hexAtom returns the longest run of exact bytes in the tokens before the
+// first jump or alternative, and its offset, so that candidates found by the
+// automaton start at a known offset.
+func hexAtom(tokens []hexToken) ([]byte, int) {
+	var (
+		atom   []byte
+		offset int
+		start  int
+	)
+
+	for i, token := range tokens {
+		if token.kind != hexByte {
+			break
+		}
+		if token.mask != 0xFF {
+			start = i + 1
+			continue
+		}
+		if i+1-start > len(atom) {
+			atom, offset = make([]byte, 0, i+1-start), start
+			for _, t := range tokens[start : i+1] {
+				atom = append(atom, t.value)
+			}
+		}
+	}
+	return atom, offset
+}
+
+// matchHex tells whether the tokens match the data at the offset.
+func matchHex(tokens []hexToken, data []byte, offset int) bool {
+	return matchHexThen(tokens, data, offset, func(int) bool { return true })
+}
+
+// matchHexThen matches the tokens at the offset, then calls then with the
+// offset following them, backtracking over jumps and alternatives.
+func matchHexThen(tokens []hexToken, data []byte, offset int, then func(int) bool) bool {
+	for i, token := range tokens {
+		switch token.kind {
+		case hexByte:
+			if offset >= len(data) || data[offset]&token.mask != token.value {
+				return false
+			}
+			offset++
+		case hexJump:
+			max := len(data) - offset
+			if token.max >= 0 && token.max < max {
+				max = token.max
+			}
+			for n := token.min; n <= max; n++ {
+				if matchHexThen(tokens[i+1:], data, offset+n, then) {
+					return true
+				}
+			}
+			return false
+		case hexAlt:
+			for _, alt := range token.alts {
+				rest := tokens[i+1:]
+				if matchHexThen(alt, data, offset, func(next int) bool {
+					return matchHexThen(rest, data, next, then)
+				}) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return then(offset)
+}
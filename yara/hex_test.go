@@ -0,0 +1,68 @@
+package yara
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMatchHex(t *testing.T) {
+	tests := []struct {
+		hex  string
+		data string
+		want bool
+	}{
+		{hex: "4D 5A", data: "MZ", want: true},
+		{hex: "4D 5A", data: "M"},
+		{hex: "4D ?? 5A", data: "M_Z", want: true},
+		{hex: "4? 5A", data: "OZ", want: true},
+		{hex: "4? 5A", data: "ZZ"},
+		{hex: "?D 5A", data: "]Z", want: true},
+		{hex: "41 [2] 42", data: "A__B", want: true},
+		{hex: "41 [2] 42", data: "A_B"},
+		{hex: "41 [1-3] 42", data: "A___B", want: true},
+		{hex: "41 [1-3] 42", data: "A____B"},
+		{hex: "41 [2-] 42", data: "A______B", want: true},
+		{hex: "41 [-] 42", data: "AB", want: true},
+		{hex: "41 (42 | 43 44) 45", data: "ACDE", want: true},
+		{hex: "41 (42 | 43 44) 45", data: "ABE", want: true},
+		{hex: "41 (42 | 43 44) 45", data: "ACE"},
+		{hex: "41 (42 (43 | 44) | 45) 46", data: "ABDF", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hex+"/"+tt.data, func(t *testing.T) {
+			tokens, err := parseHex(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matchHex(tokens, []byte(tt.data), 0); got != tt.want {
+				t.Errorf("matchHex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHexAtom(t *testing.T) {
+	tests := []struct {
+		hex    string
+		atom   []byte
+		offset int
+	}{
+		{hex: "4D 5A 90", atom: []byte{0x4D, 0x5A, 0x90}},
+		{hex: "4D ?? 5A 90 [2] 01 02 03 04", atom: []byte{0x5A, 0x90}, offset: 2},
+		{hex: "?? 31 C0", atom: []byte{0x31, 0xC0}, offset: 1},
+		{hex: "?? ?5 (01 | 02)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hex, func(t *testing.T) {
+			tokens, err := parseHex(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if atom, offset := hexAtom(tokens); !bytes.Equal(atom, tt.atom) || offset != tt.offset {
+				t.Errorf("hexAtom() = %x, %d, want %x, %d", atom, offset, tt.atom, tt.offset)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package yara
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// kinds of tokens
+const (
+	tokEOF = iota
+	tokIdent
+	tokString // $a, $a*
+	tokCount  // #a
+	tokInt
+	tokText
+	tokPunct
+)
+
+// token is a token of the source of rules.
+type token struct {
+	kind  int
+	text  string
+	value int64
+	line  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of rules"
+	}
+	return strconv.Quote(t.text)
+}
+
+// lexer splits the source of rules into tokens. Strings (text, hex and
+// regular expressions) are read by the parser, with stringValue.
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+// errorf returns a syntax error, at the current line.
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("yara: line %d: %s", l.line, fmt.Sprintf(format, args...))
+}
+
+// skip skips spaces and comments.
+func (l *lexer) skip() {
+	for l.pos < len(l.src) {
+		switch {
+		case l.src[l.pos] == '\n':
+			l.line++
+			l.pos++
+		case l.src[l.pos] == ' ' || l.src[l.pos] == '\t' || l.src[l.pos] == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				l.pos = len(l.src)
+				return
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+end+4], "\n")
+			l.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+// next returns the next token.
+func (l *lexer) next() (token, error) {
+	l.skip()
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, line: l.line}, nil
+	}
+
+	var (
+		start = l.pos
+		c     = l.src[l.pos]
+	)
+
+	switch {
+	case isIdentByte(c) && !isDigit(c):
+		l.pos = identEnd(l.src, l.pos)
+		return token{kind: tokIdent, text: l.src[start:l.pos], line: l.line}, nil
+	case c == '$' || c == '#':
+		l.pos = identEnd(l.src, l.pos+1)
+		if l.pos == start+1 {
+			return token{}, l.errorf("anonymous strings are not supported")
+		}
+		kind := tokCount
+		if c == '$' {
+			kind = tokString
+			if l.pos < len(l.src) && l.src[l.pos] == '*' {
+				l.pos++
+			}
+		}
+		return token{kind: kind, text: l.src[start:l.pos], line: l.line}, nil
+	case isDigit(c):
+		return l.number()
+	case c == '"':
+		text, err := l.text()
+		return token{kind: tokText, text: text, line: l.line}, err
+	}
+
+	for _, punct := range []string{"..", "==", "!=", "<=", ">=", "{", "}", "(", ")", "[", "]", ":", "=", ",", "<", ">"} {
+		if strings.HasPrefix(l.src[l.pos:], punct) {
+			l.pos += len(punct)
+			return token{kind: tokPunct, text: punct, line: l.line}, nil
+		}
+	}
+	return token{}, l.errorf("unexpected %q", c)
+}
+
+// number reads an integer: decimal or hexadecimal (0x), with an optional KB
+// or MB suffix.
+func (l *lexer) number() (token, error) {
+	var (
+		err   error
+		value uint64
+		start = l.pos
+	)
+
+	l.pos = identEnd(l.src, l.pos)
+	text := l.src[start:l.pos]
+
+	switch {
+	case strings.HasPrefix(text, "0x"):
+		value, err = strconv.ParseUint(text[2:], 16, 63)
+	case strings.HasSuffix(text, "KB"):
+		value, err = strconv.ParseUint(strings.TrimSuffix(text, "KB"), 10, 53)
+		value <<= 10
+	case strings.HasSuffix(text, "MB"):
+		value, err = strconv.ParseUint(strings.TrimSuffix(text, "MB"), 10, 43)
+		value <<= 20
+	default:
+		value, err = strconv.ParseUint(text, 10, 63)
+	}
+	if err != nil {
+		return token{}, l.errorf("invalid number %q", text)
+	}
+	return token{kind: tokInt, text: text, value: int64(value), line: l.line}, nil
+}
+
+// text reads a text string, with the escape sequences \" \\ \t \n \r \xHH.
+func (l *lexer) text() (string, error) {
+	var b strings.Builder
+
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		switch c := l.src[l.pos]; c {
+		case '"':
+			l.pos++
+			return b.String(), nil
+		case '\n':
+			return "", l.errorf("unterminated string")
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return "", l.errorf("unterminated string")
+			}
+			l.pos++
+			switch l.src[l.pos] {
+			case '"', '\\':
+				b.WriteByte(l.src[l.pos])
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 'x':
+				if l.pos+2 >= len(l.src) {
+					return "", l.errorf("invalid escape sequence")
+				}
+				n, err := strconv.ParseUint(l.src[l.pos+1:l.pos+3], 16, 8)
+				if err != nil {
+					return "", l.errorf("invalid escape sequence \\x%s", l.src[l.pos+1:l.pos+3])
+				}
+				b.WriteByte(byte(n))
+				l.pos += 2
+			default:
+				return "", l.errorf("invalid escape sequence \\%c", l.src[l.pos])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", l.errorf("unterminated string")
+}
+
+// stringValue reads the value of a string definition: a text string ("..."),
+// a hex string ({...}) or a regular expression (/.../), and returns its
+// delimiter and content.
+func (l *lexer) stringValue() (byte, string, error) {
+	l.skip()
+	if l.pos >= len(l.src) {
+		return 0, "", l.errorf("missing string value")
+	}
+
+	switch delim := l.src[l.pos]; delim {
+	case '"':
+		text, err := l.text()
+		return delim, text, err
+	case '{':
+		end := strings.IndexByte(l.src[l.pos:], '}')
+		if end < 0 {
+			return 0, "", l.errorf("unterminated hex string")
+		}
+		hex := l.src[l.pos+1 : l.pos+end]
+		l.line += strings.Count(hex, "\n")
+		l.pos += end + 1
+		return delim, hex, nil
+	case '/':
+		for i := l.pos + 1; i < len(l.src) && l.src[i] != '\n'; i++ {
+			switch l.src[i] {
+			case '\\':
+				i++
+			case '/':
+				re := l.src[l.pos+1 : i]
+				l.pos = i + 1
+				return delim, re, nil
+			}
+		}
+		return 0, "", l.errorf("unterminated regular expression")
+	default:
+		return 0, "", l.errorf("unexpected %q, want a string", delim)
+	}
+}
+
+// regexpFlags reads the flags following a regular expression (i, s).
+func (l *lexer) regexpFlags() string {
+	start := l.pos
+	for l.pos < len(l.src) && (l.src[l.pos] == 'i' || l.src[l.pos] == 's') {
+		l.pos++
+	}
+	return l.src[start:l.pos]
+}
+
+// identEnd returns the end of the identifier starting at i.
+func identEnd(s string, i int) int {
+	for i < len(s) && isIdentByte(s[i]) {
+		i++
+	}
+	return i
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
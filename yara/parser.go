@@ -0,0 +1,538 @@
+package yara
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rule is a compiled rule.
+type rule struct {
+	name     string
+	tags     []string
+	meta     map[string]string
+	patterns []*pattern
+	cond     cond
+}
+
+// pattern is a string of a rule: a text, a hex string or a regular
+// expression.
+type pattern struct {
+	id string
+
+	// text strings, and their modifiers
+	text                          []byte
+	nocase, wide, ascii, fullword bool
+
+	hex []hexToken
+	re  *regexp.Regexp
+}
+
+// parser parses rules, with a token of lookahead.
+type parser struct {
+	lex *lexer
+	tok token
+
+	// strings of the rule being parsed
+	patterns []*pattern
+}
+
+// parse parses the source of rules.
+func parse(src string) ([]*rule, error) {
+	var (
+		rules []*rule
+		names = make(map[string]bool)
+		p     = &parser{lex: &lexer{src: src, line: 1}}
+	)
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	for p.tok.kind != tokEOF {
+		r, err := p.rule()
+		if err != nil {
+			return nil, err
+		}
+		if names[r.name] {
+			return nil, fmt.Errorf("yara: duplicate rule %s", r.name)
+		}
+		names[r.name] = true
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// advance reads the next token.
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+// errorf returns a syntax error, at the line of the current token.
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("yara: line %d: %s", p.tok.line, fmt.Sprintf(format, args...))
+}
+
+// is tells whether the current token is the keyword or punctuation.
+func (p *parser) is(text string) bool {
+	return (p.tok.kind == tokIdent || p.tok.kind == tokPunct) && p.tok.text == text
+}
+
+// expect reads the keyword or punctuation.
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return p.errorf("unexpected %s, want %q", p.tok, text)
+	}
+	return p.advance()
+}
+
+// ident reads an identifier.
+func (p *parser) ident() (string, error) {
+	if p.tok.kind != tokIdent {
+		return "", p.errorf("unexpected %s, want an identifier", p.tok)
+	}
+	name := p.tok.text
+	return name, p.advance()
+}
+
+// rule parses a rule:
+//
+//	rule name : tags {
+//	  meta:
+//	    key = "value"
+//	  strings:
+//	    $a = "text" nocase
+//	  condition:
+//	    $a
+//	}
+func (p *parser) rule() (*rule, error) {
+	var (
+		err error
+		r   = &rule{meta: make(map[string]string)}
+	)
+
+	p.patterns = nil
+
+	if err = p.expect("rule"); err != nil {
+		return nil, err
+	}
+	if r.name, err = p.ident(); err != nil {
+		return nil, err
+	}
+
+	if p.is(":") {
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		for p.tok.kind == tokIdent {
+			r.tags = append(r.tags, p.tok.text)
+			if err = p.advance(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	if p.is("meta") {
+		if err = p.meta(r); err != nil {
+			return nil, err
+		}
+	}
+	if p.is("strings") {
+		if err = p.strings(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = p.expect("condition"); err != nil {
+		return nil, err
+	}
+	if err = p.expect(":"); err != nil {
+		return nil, err
+	}
+	if r.cond, err = p.or(); err != nil {
+		return nil, err
+	}
+	if err = p.expect("}"); err != nil {
+		return nil, err
+	}
+
+	r.patterns = p.patterns
+	return r, nil
+}
+
+// meta parses the meta section.
+func (p *parser) meta(r *rule) error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+
+	for p.tok.kind == tokIdent && !p.is("strings") && !p.is("condition") {
+		key, err := p.ident()
+		if err != nil {
+			return err
+		}
+		if err = p.expect("="); err != nil {
+			return err
+		}
+		if p.tok.kind != tokText && p.tok.kind != tokInt && !p.is("true") && !p.is("false") {
+			return p.errorf("unexpected %s, want a meta value", p.tok)
+		}
+		r.meta[key] = p.tok.text
+		if err = p.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// strings parses the strings section.
+func (p *parser) strings() error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+
+	for p.tok.kind == tokString {
+		pt, err := p.pattern()
+		if err != nil {
+			return err
+		}
+		p.patterns = append(p.patterns, pt)
+	}
+	if len(p.patterns) == 0 {
+		return p.errorf("empty strings section")
+	}
+	return nil
+}
+
+// pattern parses the definition of a string, its identifier being the
+// current token. Its value is read from the lexer directly.
+func (p *parser) pattern() (*pattern, error) {
+	pt := &pattern{id: p.tok.text}
+
+	if strings.HasSuffix(pt.id, "*") {
+		return nil, p.errorf("invalid string identifier %s", pt.id)
+	}
+	if p.lookup(pt.id) != nil {
+		return nil, p.errorf("duplicate string %s", pt.id)
+	}
+
+	// = value
+	p.lex.skip()
+	if !strings.HasPrefix(p.lex.src[p.lex.pos:], "=") {
+		return nil, p.lex.errorf("missing = after %s", pt.id)
+	}
+	p.lex.pos++
+
+	delim, value, err := p.lex.stringValue()
+	if err != nil {
+		return nil, err
+	}
+
+	switch delim {
+	case '"':
+		if value == "" {
+			return nil, p.lex.errorf("empty string %s", pt.id)
+		}
+		pt.text = []byte(value)
+	case '{':
+		if pt.hex, err = parseHex(value); err != nil {
+			return nil, p.lex.errorf("%s: %v", pt.id, err)
+		}
+	case '/':
+		expr := "(?s)" + value
+		if flags := p.lex.regexpFlags(); flags != "" {
+			expr = "(?" + flags + ")" + expr
+		}
+		if pt.re, err = regexp.Compile(expr); err != nil {
+			return nil, p.lex.errorf("%s: %v", pt.id, err)
+		}
+	}
+
+	if err = p.advance(); err != nil {
+		return nil, err
+	}
+	return pt, p.modifiers(pt)
+}
+
+// modifiers parses the modifiers of a string.
+func (p *parser) modifiers(pt *pattern) error {
+	for p.tok.kind == tokIdent {
+		switch modifier := p.tok.text; {
+		case pt.text != nil && modifier == "nocase":
+			pt.nocase = true
+		case pt.text != nil && modifier == "wide":
+			pt.wide = true
+		case pt.text != nil && modifier == "ascii":
+			pt.ascii = true
+		case pt.text != nil && modifier == "fullword":
+			pt.fullword = true
+		case pt.re != nil && modifier == "nocase":
+			pt.re = regexp.MustCompile("(?i)" + pt.re.String())
+		case modifier == "condition":
+			return nil
+		default:
+			return p.errorf("invalid modifier %s of %s", modifier, pt.id)
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns the string of the rule with the identifier.
+func (p *parser) lookup(id string) *pattern {
+	for _, pt := range p.patterns {
+		if pt.id == id {
+			return pt
+		}
+	}
+	return nil
+}
+
+// or parses a condition: conditions joined with or.
+func (p *parser) or() (cond, error) {
+	left, err := p.and()
+	for err == nil && p.is("or") {
+		var right cond
+		if err = p.advance(); err != nil {
+			break
+		}
+		if right, err = p.and(); err == nil {
+			left = orCond{left, right}
+		}
+	}
+	return left, err
+}
+
+// and parses conditions joined with and.
+func (p *parser) and() (cond, error) {
+	left, err := p.not()
+	for err == nil && p.is("and") {
+		var right cond
+		if err = p.advance(); err != nil {
+			break
+		}
+		if right, err = p.not(); err == nil {
+			left = andCond{left, right}
+		}
+	}
+	return left, err
+}
+
+// not parses a condition, possibly negated.
+func (p *parser) not() (cond, error) {
+	if !p.is("not") {
+		return p.primary()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	c, err := p.not()
+	return notCond{c}, err
+}
+
+// primary parses a condition: parenthesised, a boolean, a string (possibly at
+// an offset or in a range), a set of strings, or a comparison.
+func (p *parser) primary() (cond, error) {
+	switch {
+	case p.is("("):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	case p.is("true") || p.is("false"):
+		value := p.is("true")
+		return boolCond(value), p.advance()
+	case p.tok.kind == tokString:
+		return p.stringCond()
+	case p.is("any") || p.is("all"):
+		all := p.is("all")
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return p.ofCond(nil, all)
+	}
+
+	left, err := p.num()
+	if err != nil {
+		return nil, err
+	}
+	if p.is("of") {
+		return p.ofCond(left, false)
+	}
+
+	op := p.tok.text
+	switch {
+	case p.tok.kind != tokPunct:
+		return nil, p.errorf("unexpected %s, want a comparison", p.tok)
+	case op != "==" && op != "!=" && op != "<" && op != "<=" && op != ">" && op != ">=":
+		return nil, p.errorf("unexpected %s, want a comparison", p.tok)
+	}
+	if err = p.advance(); err != nil {
+		return nil, err
+	}
+
+	right, err := p.num()
+	if err != nil {
+		return nil, err
+	}
+	return cmpCond{op: op, left: left, right: right}, nil
+}
+
+// stringCond parses a string, possibly at an offset ($a at 0) or in a range
+// ($a in (0..1024)).
+func (p *parser) stringCond() (cond, error) {
+	var (
+		err error
+		pt  = p.lookup(p.tok.text)
+	)
+
+	if pt == nil {
+		return nil, p.errorf("undefined string %s", p.tok.text)
+	}
+	if err = p.advance(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.is("at"):
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		at, err := p.num()
+		return atCond{pattern: pt, at: at}, err
+	case p.is("in"):
+		var lo, hi num
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		if err = p.expect("("); err != nil {
+			return nil, err
+		}
+		if lo, err = p.num(); err != nil {
+			return nil, err
+		}
+		if err = p.expect(".."); err != nil {
+			return nil, err
+		}
+		if hi, err = p.num(); err != nil {
+			return nil, err
+		}
+		return inCond{pattern: pt, lo: lo, hi: hi}, p.expect(")")
+	}
+	return stringCond{pt}, nil
+}
+
+// ofCond parses the set of strings of "any of", "all of" or "n of": them, or
+// identifiers (possibly wildcards, $a*) between parentheses.
+func (p *parser) ofCond(n num, all bool) (cond, error) {
+	var (
+		c    = ofCond{n: n, all: all}
+		seen = make(map[*pattern]bool)
+	)
+
+	if err := p.expect("of"); err != nil {
+		return nil, err
+	}
+
+	if p.is("them") {
+		if len(p.patterns) == 0 {
+			return nil, p.errorf("no strings for them")
+		}
+		c.patterns = p.patterns
+		return c, p.advance()
+	}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		if p.tok.kind != tokString {
+			return nil, p.errorf("unexpected %s, want a string", p.tok)
+		}
+
+		matched := false
+		for _, pt := range p.patterns {
+			prefix := strings.TrimSuffix(p.tok.text, "*")
+			if pt.id == p.tok.text || prefix != p.tok.text && strings.HasPrefix(pt.id, prefix) {
+				matched = true
+				if !seen[pt] {
+					seen[pt] = true
+					c.patterns = append(c.patterns, pt)
+				}
+			}
+		}
+		if !matched {
+			return nil, p.errorf("undefined string %s", p.tok.text)
+		}
+
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if !p.is(",") {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	return c, p.expect(")")
+}
+
+// num parses an integer: a number, filesize, the count of a string (#a), or
+// an integer read in the file (uint8, uint16, uint32, uint16be, uint32be).
+func (p *parser) num() (num, error) {
+	switch {
+	case p.tok.kind == tokInt:
+		value := p.tok.value
+		return intNum(value), p.advance()
+	case p.is("filesize"):
+		return filesizeNum{}, p.advance()
+	case p.tok.kind == tokCount:
+		pt := p.lookup("$" + p.tok.text[1:])
+		if pt == nil {
+			return nil, p.errorf("undefined string $%s", p.tok.text[1:])
+		}
+		return countNum{pt}, p.advance()
+	case p.tok.kind == tokIdent && strings.HasPrefix(p.tok.text, "uint"):
+		var (
+			name      = p.tok.text
+			bigEnd    = strings.HasSuffix(name, "be")
+			bits, err = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "uint"), "be"))
+		)
+		if err != nil || bits != 8 && bits != 16 && bits != 32 || bits == 8 && bigEnd {
+			return nil, p.errorf("unknown function %s", name)
+		}
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		if err = p.expect("("); err != nil {
+			return nil, err
+		}
+		offset, err := p.num()
+		if err != nil {
+			return nil, err
+		}
+		return uintNum{size: bits / 8, bigEndian: bigEnd, offset: offset}, p.expect(")")
+	}
+	return nil, p.errorf("unexpected %s, want a condition", p.tok)
+}
@@ -0,0 +1,80 @@
+package yara
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{name: "missing-condition", src: `rule A { strings: $a = "a" }`, err: `want "condition"`},
+		{name: "undefined-string", src: `rule A { strings: $a = "a" condition: $b }`, err: "undefined string $b"},
+		{name: "undefined-count", src: `rule A { condition: #b > 1 }`, err: "undefined string $b"},
+		{name: "undefined-wildcard", src: `rule A { strings: $a = "a" condition: any of ($b*) }`, err: "undefined string $b*"},
+		{name: "them-without-strings", src: `rule A { condition: any of them }`, err: "no strings"},
+		{name: "duplicate-rule", src: `rule A { condition: true } rule A { condition: true }`, err: "duplicate rule A"},
+		{name: "duplicate-string", src: `rule A { strings: $a = "a" $a = "b" condition: $a }`, err: "duplicate string $a"},
+		{name: "empty-string", src: `rule A { strings: $a = "" condition: $a }`, err: "empty string"},
+		{name: "bad-hex", src: `rule A { strings: $a = { 4D 5G } condition: $a }`, err: "invalid hex digit"},
+		{name: "hex-starting-with-jump", src: `rule A { strings: $a = { [2] 4D } condition: $a }`, err: "start and end with bytes"},
+		{name: "bad-regexp", src: `rule A { strings: $a = /a(/ condition: $a }`, err: "missing closing )"},
+		{name: "bad-modifier", src: `rule A { strings: $a = { 4D } wide condition: $a }`, err: "invalid modifier wide"},
+		{name: "unterminated-string", src: "rule A { strings: $a = \"a\n condition: $a }", err: "line 1: unterminated string"},
+		{name: "bad-escape", src: `rule A { strings: $a = "\q" condition: $a }`, err: `invalid escape sequence \q`},
+		{name: "bad-function", src: `rule A { condition: uint64(0) == 1 }`, err: "unknown function uint64"},
+		{name: "bad-comparison", src: `rule A { condition: filesize }`, err: "want a comparison"},
+		{name: "line", src: "rule A {\n  condition:\n    filesize <\n}", err: "line 4:"},
+		{name: "anonymous", src: `rule A { strings: $ = "a" condition: all of them }`, err: "anonymous strings"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compile(tt.src); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Compile() = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCompile_Conditions(t *testing.T) {
+	tests := []struct {
+		cond string
+		data string
+		want bool
+	}{
+		{cond: "true", want: true},
+		{cond: "not false and (false or true)", want: true},
+		{cond: "$a and not $b", data: "a", want: true},
+		{cond: "$a or $b", data: "c"},
+		{cond: "#a == 3", data: "aaa", want: true},
+		{cond: "$a at 2", data: "bba", want: true},
+		{cond: "$a at 1", data: "bba"},
+		{cond: "$a in (1..2)", data: "bba", want: true},
+		{cond: "$a in (0..1)", data: "bba"},
+		{cond: "2 of them", data: "ab", want: true},
+		{cond: "2 of them", data: "a"},
+		{cond: "all of ($a, $b)", data: "ba", want: true},
+		{cond: "any of ($b*)", data: "b", want: true},
+		{cond: "filesize == 0x10", data: "0123456789abcdef", want: true},
+		{cond: "filesize <= 1KB and filesize > 2", data: "abc", want: true},
+		{cond: "filesize >= 1MB", data: "abc"},
+		{cond: "uint8(0) == 97 and uint16(1) == 0x6362", data: "abc", want: true},
+		{cond: "uint32(0) != 0", data: "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			rules, err := Compile(`rule A { strings: $a = "a" $b = "b" condition: ` + tt.cond + ` }`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(rules.Match([]byte(tt.data))) == 1; got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+// Package yara matches files against signature rules written in a subset of
+// the YARA syntax, in pure Go. Compiled rules are scanners of filechecker
+// policies (see filechecker.Policy.Scanners), run once the type of files is
+// authorised.
+//
+// Supported are:
+//
+//   - text strings ("..."), with the nocase, wide, ascii and fullword
+//     modifiers
+//   - hex strings ({ 4D 5A ?? 9? [2-4] (00 | FF) })
+//   - regular expressions (/.../ with the i and s flags, RE2 syntax, matched
+//     against the content as UTF-8 text)
+//   - conditions with and, or, not, $a, #a, $a at n, $a in (n..m),
+//     filesize, any/all/n of them (or of ($a, $b*)), comparisons, and
+//     uint8, uint16, uint32 (uint16be, uint32be) at an offset
+//   - meta and tags, reported in matches
+//
+// Literals (text strings, and the fixed bytes of hex strings) are all looked
+// for in a single pass, with an Aho-Corasick automaton.
+package yara
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/nadimattari/filechecker"
+)
+
+const (
+	// name of the scanner in verdicts
+	scannerName = "yara"
+
+	// maximum size of the files scanned by default
+	defaultMaxSize = 32 << 20
+
+	// offsets recorded per string at most
+	maxMatches = 10000
+)
+
+// ErrTooLarge is returned when files are larger than MaxSize.
+var ErrTooLarge = errors.New("yara: file too large to be scanned")
+
+// Rules are compiled rules.
+type Rules struct {
+	// maximum size of the files scanned, larger ones are not (32 MiB by
+	// default)
+	MaxSize int64
+
+	rules []*rule
+
+	// literals of the automaton, by index
+	literals []literal
+	ac       *automaton
+
+	// hex strings without fixed bytes to look for, and regular expressions,
+	// matched on their own
+	hexes   []*pattern
+	regexps []*pattern
+}
+
+// literal is a literal looked for by the automaton: a text string (or its
+// wide form), or the fixed bytes of a hex string, at an offset of it.
+type literal struct {
+	pattern *pattern
+	bytes   []byte
+	wide    bool
+	offset  int
+}
+
+// Match is a rule matching a file.
+type Match struct {
+	Rule string            `json:"rule"`
+	Tags []string          `json:"tags,omitempty"`
+	Meta map[string]string `json:"meta,omitempty"`
+
+	// offsets of the strings matched, by identifier
+	Strings map[string][]int `json:"strings,omitempty"`
+}
+
+// Compile compiles rules.
+func Compile(src string) (*Rules, error) {
+	var (
+		r         = &Rules{}
+		sequences [][]byte
+	)
+
+	rules, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	r.rules = rules
+
+	for _, rule := range rules {
+		for _, pt := range rule.patterns {
+			switch {
+			case pt.re != nil:
+				r.regexps = append(r.regexps, pt)
+			case pt.hex != nil:
+				if atom, offset := hexAtom(pt.hex); len(atom) > 0 {
+					r.literals = append(r.literals, literal{pattern: pt, bytes: atom, offset: offset})
+				} else {
+					r.hexes = append(r.hexes, pt)
+				}
+			default:
+				if !pt.wide || pt.ascii {
+					r.literals = append(r.literals, literal{pattern: pt, bytes: pt.text})
+				}
+				if pt.wide {
+					r.literals = append(r.literals, literal{pattern: pt, bytes: widen(pt.text), wide: true})
+				}
+			}
+		}
+	}
+
+	for _, lit := range r.literals {
+		sequences = append(sequences, lit.bytes)
+	}
+	r.ac = newAutomaton(sequences)
+
+	return r, nil
+}
+
+// MustCompile is like Compile, but panics if the rules cannot be compiled.
+func MustCompile(src string) *Rules {
+	r, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Name implements filechecker.Scanner.
+func (r *Rules) Name() string {
+	return scannerName
+}
+
+// Scan implements filechecker.Scanner. Files matching rules are detected,
+// the signature being the names of the rules, comma-separated.
+func (r *Rules) Scan(ctx context.Context, reader io.ReaderAt, size int64) (*filechecker.ScanResult, error) {
+	var (
+		maxSize = r.MaxSize
+		names   []string
+	)
+
+	if maxSize == 0 {
+		maxSize = defaultMaxSize
+	}
+	if size > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(reader, 0, size), data); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, match := range r.Match(data) {
+		names = append(names, match.Rule)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return &filechecker.ScanResult{Detected: len(names) > 0, Signature: strings.Join(names, ",")}, nil
+}
+
+// Match returns the rules matching the data, in order.
+func (r *Rules) Match(data []byte) []Match {
+	var (
+		matches []Match
+		s       = &state{data: data, matches: make(map[*pattern][]int)}
+	)
+
+	r.ac.find(data, func(index, end int) {
+		var (
+			lit   = r.literals[index]
+			pt    = lit.pattern
+			start = end - len(lit.bytes) + 1
+		)
+
+		if len(s.matches[pt]) >= maxMatches {
+			return
+		}
+
+		if pt.hex != nil {
+			if start -= lit.offset; start >= 0 && matchHex(pt.hex, data, start) {
+				s.matches[pt] = append(s.matches[pt], start)
+			}
+			return
+		}
+
+		// the automaton matched case-insensitively
+		if !pt.nocase && !bytes.Equal(data[start:end+1], lit.bytes) {
+			return
+		}
+		if pt.fullword && !fullword(data, start, end, lit.wide) {
+			return
+		}
+		s.matches[pt] = append(s.matches[pt], start)
+	})
+
+	for _, pt := range r.hexes {
+		for offset := range data {
+			if matchHex(pt.hex, data, offset) {
+				if s.matches[pt] = append(s.matches[pt], offset); len(s.matches[pt]) >= maxMatches {
+					break
+				}
+			}
+		}
+	}
+	for _, pt := range r.regexps {
+		for _, loc := range pt.re.FindAllIndex(data, maxMatches) {
+			s.matches[pt] = append(s.matches[pt], loc[0])
+		}
+	}
+
+	// the ascii and wide forms of strings are found in any order
+	for pt, offsets := range s.matches {
+		sort.Ints(offsets)
+		s.matches[pt] = dedup(offsets)
+	}
+
+	for _, rule := range r.rules {
+		if !rule.cond.eval(s) {
+			continue
+		}
+
+		match := Match{Rule: rule.name, Tags: rule.tags}
+		if len(rule.meta) > 0 {
+			match.Meta = rule.meta
+		}
+		for _, pt := range rule.patterns {
+			if offsets := s.matches[pt]; len(offsets) > 0 {
+				if match.Strings == nil {
+					match.Strings = make(map[string][]int)
+				}
+				match.Strings[pt.id] = offsets
+			}
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+// widen returns the wide (UTF-16LE) form of a text.
+func widen(text []byte) []byte {
+	wide := make([]byte, 0, 2*len(text))
+	for _, c := range text {
+		wide = append(wide, c, 0)
+	}
+	return wide
+}
+
+// fullword tells whether the string found from start to end is delimited by
+// non-alphanumeric characters.
+func fullword(data []byte, start, end int, wide bool) bool {
+	before := start - 1
+	if wide {
+		before = start - 2
+	}
+	if before >= 0 && isAlnum(data[before]) {
+		return false
+	}
+	return end+1 >= len(data) || !isAlnum(data[end+1])
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// dedup removes the duplicates of sorted offsets.
+func dedup(offsets []int) []int {
+	out := offsets[:0]
+	for i, offset := range offsets {
+		if i == 0 || offset != offsets[i-1] {
+			out = append(out, offset)
+		}
+	}
+	return out
+}
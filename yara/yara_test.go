@@ -0,0 +1,177 @@
+package yara
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/nadimattari/filechecker"
+	"github.com/nadimattari/filechecker/internal/fctest"
+)
+
+const testRules = `
+// rules of the tests
+rule MZ_Header : pe windows {
+  meta:
+    author = "security"
+    severity = 3
+  strings:
+    $mz = { 4D 5A }
+    $stub = "This program cannot be run in DOS mode"
+  condition:
+    $mz at 0 and $stub in (0..512)
+}
+
+rule Wide_Password {
+  strings:
+    $a = "password" wide nocase
+  condition:
+    $a
+}
+
+rule Many_Evals {
+  strings:
+    $e = "eval" fullword
+  condition:
+    #e >= 2 and filesize < 1KB
+}
+
+/* hex strings with wildcards, jumps and alternatives */
+rule Shellcode {
+  strings:
+    $a = { 90 90 ?? E8 [2-4] (C3 | CC 5?) }
+    $b = { ?? 31 C0 }
+  condition:
+    all of them
+}
+
+rule Regexp {
+  strings:
+    $url = /https?:\/\/[a-z]+\.evil\/[a-z]*/i
+    $x1 = "xx1"
+    $x2 = "xx2"
+  condition:
+    $url and 1 of ($x*)
+}
+
+rule Magic {
+  condition:
+    uint32be(0) == 0x25504446 or uint16(0) == 0xD8FF
+}
+`
+
+func TestRules_Match(t *testing.T) {
+	rules, err := Compile(testRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		data  string
+		rules []string
+	}{
+		{name: "empty", data: ""},
+		{name: "clean", data: "nothing to see here"},
+		{name: "pe", data: "MZ\x90\x00 This program cannot be run in DOS mode.", rules: []string{"MZ_Header"}},
+		{name: "pe-not-at-0", data: " MZ This program cannot be run in DOS mode.", rules: nil},
+		{name: "case-sensitive", data: "MZ this program cannot be run in DOS mode.", rules: nil},
+		{name: "wide-nocase", data: "u\x00s\x00e\x00r\x00 P\x00A\x00s\x00S\x00w\x00o\x00r\x00d\x00", rules: []string{"Wide_Password"}},
+		{name: "not-wide", data: "password", rules: nil},
+		{name: "fullword", data: "eval(a); eval(b);", rules: []string{"Many_Evals"}},
+		{name: "not-fullword", data: "eval(a); medieval(b);", rules: nil},
+		{name: "hex", data: "\x90\x90\x01\xE8\x00\x00\x00\xCC\x51 \x00\x31\xC0", rules: []string{"Shellcode"}},
+		{name: "hex-alternative", data: "\x90\x90\x01\xE8\x00\x00\xC3 \x00\x31\xC0", rules: []string{"Shellcode"}},
+		{name: "hex-jump-too-long", data: "\x90\x90\x01\xE8\x00\x00\x00\x00\x00\xC3 \x00\x31\xC0", rules: nil},
+		{name: "regexp", data: "see HTTPS://www.evil/payload xx2", rules: []string{"Regexp"}},
+		{name: "regexp-without-x", data: "see https://www.evil/payload", rules: nil},
+		{name: "uint", data: "%PDF-1.7", rules: []string{"Magic"}},
+		{name: "uint-short", data: "%P", rules: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, match := range rules.Match([]byte(tt.data)) {
+				names = append(names, match.Rule)
+			}
+			if !reflect.DeepEqual(names, tt.rules) {
+				t.Errorf("Match() = %v, want %v", names, tt.rules)
+			}
+		})
+	}
+}
+
+func TestRules_Match_Details(t *testing.T) {
+	rules := MustCompile(testRules)
+
+	matches := rules.Match([]byte("MZ This program cannot be run in DOS mode. MZ"))
+	if len(matches) != 1 {
+		t.Fatalf("Match() = %+v, want 1 match", matches)
+	}
+
+	want := Match{
+		Rule:    "MZ_Header",
+		Tags:    []string{"pe", "windows"},
+		Meta:    map[string]string{"author": "security", "severity": "3"},
+		Strings: map[string][]int{"$mz": {0, 43}, "$stub": {3}},
+	}
+	if !reflect.DeepEqual(matches[0], want) {
+		t.Errorf("Match() = %+v, want %+v", matches[0], want)
+	}
+}
+
+func TestRules_Scan(t *testing.T) {
+	var (
+		rules = MustCompile(`rule Test_Marker { strings: $a = "IEND" condition: $a }`)
+		png   = fctest.PNG(t)
+	)
+
+	tests := []struct {
+		name      string
+		maxSize   int64
+		data      []byte
+		detected  bool
+		signature string
+		err       error
+	}{
+		{name: "detected", data: png, detected: true, signature: "Test_Marker"},
+		{name: "clean", data: []byte("clean")},
+		{name: "too-large", maxSize: 8, data: png, err: ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules.MaxSize = tt.maxSize
+
+			result, err := rules.Scan(context.Background(), bytes.NewReader(tt.data), int64(len(tt.data)))
+			switch {
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Errorf("Scan() = %v, want %v", err, tt.err)
+				}
+			case err != nil:
+				t.Errorf("Scan() = %v", err)
+			case result.Detected != tt.detected || result.Signature != tt.signature:
+				t.Errorf("Scan() = %+v, want %v (%s)", result, tt.detected, tt.signature)
+			}
+		})
+	}
+}
+
+func TestRules_Policy(t *testing.T) {
+	rules := MustCompile(`
+rule PNG_Trailer { strings: $a = { 49 45 4E 44 AE 42 60 82 } condition: $a }
+rule Other { strings: $a = "other" condition: $a }
+`)
+
+	fc := filechecker.GetFileChecker(fctest.FileHeader(t, "me.png", fctest.PNG(t)))
+	fc.SetPolicy(filechecker.Policy{Scanners: []filechecker.Scanner{rules}})
+
+	verdict := fc.Check()
+	if verdict.Reason != filechecker.ReasonMalware || len(verdict.Scans) != 1 || verdict.Scans[0].Signature != "PNG_Trailer" {
+		t.Errorf("Check() = %+v (%+v), want malware", verdict, verdict.Scans)
+	}
+}